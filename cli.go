@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mohammadanang/uploads-api/handler"
+)
+
+// Command line flags. Without any the server starts.
+var (
+	catUpload   = flag.String("cat", "", "write the assembled chunks of the named upload (file name or upload ID) to stdout and exit")
+	totalChunks = flag.Int("total-chunks", 0, "with -cat, the number of chunks to assemble; 0 assembles every chunk recorded")
+)
+
+// runCat implements -cat, writing the chunks of an upload in the temp
+// directory to stdout without starting the server.
+func runCat(cfg handler.Config) int {
+	if _, err := handler.AssembleChunks(cfg, os.Stdout, *catUpload, *totalChunks); err != nil {
+		fmt.Fprintf(os.Stderr, "cat %s: %v\n", *catUpload, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohammadanang/uploads-api/handler"
+	"github.com/mohammadanang/uploads-api/publisher/redis"
+)
+
+// loadConfig builds the handler configuration from environment variables.
+func loadConfig() handler.Config {
+	var mirror handler.Storage
+	if dir := os.Getenv("MIRROR_DIR"); dir != "" {
+		mirror = handler.DirStorage{Dir: dir}
+	}
+
+	// Merged files keep the server's user and group unless FILE_UID or
+	// FILE_GID names others
+	var owner *handler.FileOwner
+	if uid, gid := envInt("FILE_UID", -1), envInt("FILE_GID", -1); uid >= 0 || gid >= 0 {
+		owner = &handler.FileOwner{UID: uid, GID: gid}
+	}
+
+	var publisher handler.Publisher
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		publisher = &redis.Publisher{
+			Addr:     addr,
+			Password: os.Getenv("REDIS_PASSWORD"),
+			Key:      envString("REDIS_QUEUE", "uploads:stored"),
+		}
+	}
+
+	return handler.Config{
+		WebhookURL:     os.Getenv("WEBHOOK_URL"),
+		WebhookSecret:  os.Getenv("WEBHOOK_SECRET"),
+		WebhookTimeout: envDuration("WEBHOOK_TIMEOUT", 5*time.Second),
+		WebhookRetries: envInt("WEBHOOK_RETRIES", 2),
+		AuditLogPath:   envString("AUDIT_LOG_PATH", "./audit.log"),
+
+		CollisionPolicy:      envString("COLLISION_POLICY", handler.CollisionOverwrite),
+		CaseInsensitiveNames: os.Getenv("CASE_INSENSITIVE_NAMES") == "true",
+		ExtensionPolicy:      envString("EXTENSION_POLICY", handler.ExtensionKeep),
+		NameTransformer:      handler.NameTransforms(envList("NAME_TRANSFORMS")),
+		MultipleFiles:        envString("MULTIPLE_FILES", handler.MultipleFilesReject),
+		AllowedContentTypes:  envList("ALLOWED_CONTENT_TYPES"),
+		DuplicateChunks:      envString("DUPLICATE_CHUNKS", handler.DuplicateChunksWrite),
+		IdempotentChunks:     os.Getenv("IDEMPOTENT_CHUNKS") == "true",
+		PreallocateMerges:    os.Getenv("PREALLOCATE_MERGES") == "true",
+		StorageLayout:        envString("STORAGE_LAYOUT", handler.StorageLayoutNames),
+		StorageRoutes:        handler.StorageRoutes(envList("STORAGE_ROUTES")),
+		FileOwner:            owner,
+		HashAlgorithms:       envList("HASH_ALGORITHMS"),
+		BufferSize:           envInt("BUFFER_SIZE", 1*1024*1024),
+		ChunkRetention:       envDuration("CHUNK_RETENTION", 0),
+		ChunkBase:            envInt("CHUNK_BASE", 0),
+		MaxChunkSize:         int64(envInt("MAX_CHUNK_SIZE", 0)),
+		ChunkSize:            int64(envInt("CHUNK_SIZE", 2*1024*1024)),
+		MultipartMemory:      int64(envInt("MULTIPART_MEMORY", 0)),
+		MaxTempSize:          int64(envInt("MAX_TEMP_SIZE", 0)),
+		MaxActiveUploads:     envInt("MAX_ACTIVE_UPLOADS", 0),
+		MaxRangeUploadSize:   int64(envInt("MAX_RANGE_UPLOAD_SIZE", 0)),
+		MaxDecompressedSize:  int64(envInt("MAX_DECOMPRESSED_SIZE", 0)),
+		MaxCompressionRatio:  envInt("MAX_COMPRESSION_RATIO", 100),
+
+		MaxConcurrentMerges: envInt("MAX_CONCURRENT_MERGES", 4),
+		MaxOpenChunks:       envInt("MAX_OPEN_CHUNKS", 64),
+		MergeReadAhead:      envInt("MERGE_READ_AHEAD", 8),
+		MergeRetries:        envInt("MERGE_RETRIES", 2),
+		MergeRetryBackoff:   envDuration("MERGE_RETRY_BACKOFF", 100*time.Millisecond),
+
+		MirrorStorage:    mirror,
+		MirrorBestEffort: os.Getenv("MIRROR_MODE") == "best-effort",
+
+		CompressThreshold: envInt("COMPRESS_THRESHOLD", 1024),
+		GzipDownloads:     os.Getenv("GZIP_DOWNLOADS") == "true",
+
+		DownloadSigningKey:     os.Getenv("DOWNLOAD_SIGNING_KEY"),
+		ChunkSigningKey:        os.Getenv("CHUNK_SIGNING_KEY"),
+		RequireChunkSignatures: os.Getenv("REQUIRE_CHUNK_SIGNATURES") == "true",
+
+		MergeLog:         os.Getenv("MERGE_LOG") == "true",
+		MergeReportTTL:   envDuration("MERGE_REPORT_TTL", 24*time.Hour),
+		HideErrorDetails: os.Getenv("ERROR_DETAILS") == "hidden",
+		RequireUploadID:  os.Getenv("REQUIRE_UPLOAD_ID") == "true",
+
+		MaintenanceMode:       os.Getenv("MAINTENANCE_MODE") == "true",
+		MaintenanceRetryAfter: envDuration("MAINTENANCE_RETRY_AFTER", time.Minute),
+
+		Publisher: publisher,
+	}
+}
+
+// serverTimeouts returns the read, write and idle timeouts of the HTTP
+// server. The read timeout must cover the upload of one chunk by the slowest
+// supported client, the write timeout the longest merge or download.
+func serverTimeouts() (read, write, idle time.Duration) {
+	return envDuration("READ_TIMEOUT", 2*time.Minute),
+		envDuration("WRITE_TIMEOUT", 10*time.Minute),
+		envDuration("IDLE_TIMEOUT", 2*time.Minute)
+}
+
+// routingPolicy returns how the router matches request paths to routes:
+// STRICT_ROUTING tells "/files" and "/files/" apart, CASE_SENSITIVE_ROUTES
+// "/files" and "/Files". Both are off by default, so a client appending a
+// slash or capitalizing a path still reaches the route. Path parameters keep
+// the case they were sent in either way.
+func routingPolicy() (strict, caseSensitive bool) {
+	return os.Getenv("STRICT_ROUTING") == "true", os.Getenv("CASE_SENSITIVE_ROUTES") == "true"
+}
+
+// sameRoute reports whether the router would match path to the static
+// route under the routing policy, for middlewares running before it.
+func sameRoute(path, route string, strict, caseSensitive bool) bool {
+	if !strict && len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if !caseSensitive {
+		return strings.EqualFold(path, route)
+	}
+	return path == route
+}
+
+// tracingEnabled reports whether the standard OpenTelemetry variables name an
+// OTLP endpoint to export spans to.
+func tracingEnabled() bool {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// logConfig emits the effective configuration as a single structured log
+// line so operators can confirm what is active. Secrets are never logged.
+func logConfig(cfg handler.Config, port string, apiKeys, trustedProxies []string) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	readTimeout, writeTimeout, idleTimeout := serverTimeouts()
+	strictRouting, caseSensitiveRoutes := routingPolicy()
+	logger.Info("effective configuration",
+		slog.String("version", version),
+		slog.String("commit", commit),
+		slog.String("port", port),
+		slog.String("upload_dir", handler.UploadDir),
+		slog.String("temp_dir", handler.TempDir),
+		slog.Int("rate_limit_max", rateLimitMax),
+		slog.String("rate_limit_window", rateLimitWindow.String()),
+		slog.String("grpc_port", os.Getenv("GRPC_PORT")),
+		slog.Int("api_keys", len(apiKeys)),
+		slog.Any("trusted_proxies", trustedProxies),
+		slog.Any("allowed_content_types", cfg.AllowedContentTypes),
+		slog.Float64("log_sample_rate", envFloat("LOG_SAMPLE_RATE", 1)),
+		slog.Bool("strict_routing", strictRouting),
+		slog.Bool("case_sensitive_routes", caseSensitiveRoutes),
+		slog.Group("timeouts",
+			slog.String("read", readTimeout.String()),
+			slog.String("write", writeTimeout.String()),
+			slog.String("idle", idleTimeout.String()),
+		),
+		slog.String("audit_log", cfg.AuditLogPath),
+		slog.String("merge_db", os.Getenv("MERGE_DB_PATH")),
+		slog.String("s3_bucket", os.Getenv("S3_BUCKET")),
+		slog.Bool("tracing", tracingEnabled()),
+		slog.String("collision_policy", cfg.CollisionPolicy),
+		slog.Bool("case_insensitive_names", cfg.CaseInsensitiveNames),
+		slog.String("extension_policy", cfg.ExtensionPolicy),
+		slog.Any("name_transforms", envList("NAME_TRANSFORMS")),
+		slog.String("multiple_files", cfg.MultipleFiles),
+		slog.String("duplicate_chunks", cfg.DuplicateChunks),
+		slog.Bool("idempotent_chunks", cfg.IdempotentChunks),
+		slog.Bool("preallocate_merges", cfg.PreallocateMerges),
+		slog.String("storage_layout", cfg.StorageLayout),
+		slog.Any("storage_routes", cfg.StorageRoutes),
+		slog.Any("file_owner", cfg.FileOwner),
+		slog.Any("hash_algorithms", cfg.HashAlgorithms),
+		slog.Int("buffer_size", cfg.BufferSize),
+		slog.String("chunk_retention", cfg.ChunkRetention.String()),
+		slog.Int("chunk_base", cfg.ChunkBase),
+		slog.Int64("max_chunk_size", cfg.MaxChunkSize),
+		slog.Int64("chunk_size", cfg.ChunkSize),
+		slog.Int64("multipart_memory", cfg.MultipartMemory),
+		slog.Int64("max_temp_size", cfg.MaxTempSize),
+		slog.Int("max_active_uploads", cfg.MaxActiveUploads),
+		slog.Int64("max_decompressed_size", cfg.MaxDecompressedSize),
+		slog.Int("max_compression_ratio", cfg.MaxCompressionRatio),
+		slog.Int("max_concurrent_merges", cfg.MaxConcurrentMerges),
+		slog.Int("max_open_chunks", cfg.MaxOpenChunks),
+		slog.Int("merge_read_ahead", cfg.MergeReadAhead),
+		slog.Int("merge_retries", cfg.MergeRetries),
+		slog.String("merge_retry_backoff", cfg.MergeRetryBackoff.String()),
+		slog.Int("compress_threshold", cfg.CompressThreshold),
+		slog.Bool("gzip_downloads", cfg.GzipDownloads),
+		slog.String("download_signing_key", redact(cfg.DownloadSigningKey)),
+		slog.String("chunk_signing_key", redact(cfg.ChunkSigningKey)),
+		slog.Bool("require_chunk_signatures", cfg.RequireChunkSignatures),
+		slog.Bool("merge_log", cfg.MergeLog),
+		slog.String("merge_report_ttl", cfg.MergeReportTTL.String()),
+		slog.Bool("maintenance_mode", cfg.MaintenanceMode),
+		slog.String("maintenance_retry_after", cfg.MaintenanceRetryAfter.String()),
+		slog.Bool("hide_error_details", cfg.HideErrorDetails),
+		slog.Bool("require_upload_id", cfg.RequireUploadID),
+		slog.Group("mirror",
+			slog.String("dir", os.Getenv("MIRROR_DIR")),
+			slog.Bool("best_effort", cfg.MirrorBestEffort),
+		),
+		slog.Group("queue",
+			slog.String("redis_addr", os.Getenv("REDIS_ADDR")),
+			slog.String("redis_password", redact(os.Getenv("REDIS_PASSWORD"))),
+			slog.String("redis_queue", envString("REDIS_QUEUE", "uploads:stored")),
+		),
+		slog.Group("webhook",
+			slog.Bool("enabled", cfg.WebhookURL != ""),
+			slog.String("url", redactURL(cfg.WebhookURL)),
+			slog.String("secret", redact(cfg.WebhookSecret)),
+			slog.String("timeout", cfg.WebhookTimeout.String()),
+			slog.Int("retries", cfg.WebhookRetries),
+		),
+	)
+}
+
+// redact hides a secret while still showing whether it is set.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return "[REDACTED]"
+}
+
+// redactURL strips credentials embedded in a URL.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redact(raw)
+	}
+
+	return u.Redacted()
+}
+
+func envString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// envList splits a comma separated variable, ignoring empty entries.
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func envInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+
+	return n
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("invalid %s %q, using %g", key, value, fallback)
+		return fallback
+	}
+
+	return f
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+
+	return d
+}
@@ -1,10 +1,388 @@
 package domain
 
+import "time"
+
 type UploadFileRequest struct {
 	ChunkIndex int `json:"chunk_index" query:"chunk_index" form:"chunk_index"`
+	// UploadID is the session from POST /upload/init the chunk belongs to
+	UploadID string `json:"upload_id" query:"upload_id" form:"upload_id"`
+	// Sequence, when sent, must be greater than every sequence sent before
+	// for the same upload; stale or repeated values are rejected as replays
+	Sequence *int64 `json:"sequence" query:"sequence" form:"sequence"`
+	// Progress streams NDJSON progress lines while the chunk is written
+	Progress bool `json:"progress" query:"progress" form:"progress"`
+	// TotalChunks, when known, lets the response report the upload complete
+	TotalChunks int `json:"total_chunks" query:"total_chunks" form:"total_chunks"`
+	// Checksum is the chunk's hex encoded SHA-256; with idempotent chunks a
+	// chunk already stored with it is not written again
+	Checksum string `json:"checksum" query:"checksum" form:"checksum"`
+	// ChunkEncoding is the compression of the file parts, taken from the
+	// Chunk-Encoding header; empty when they are sent as is
+	ChunkEncoding string `json:"-" query:"-" form:"-"`
+}
+
+// StoreChunkRequest is one chunk of an upload received over a transport
+// other than HTTP, e.g. gRPC.
+type StoreChunkRequest struct {
+	FileName   string
+	UploadID   string
+	ChunkIndex int
+	Data       []byte
+	// Signature is the chunk's HMAC signature, as sent in the
+	// X-Chunk-Signature header over HTTP
+	Signature string
+	// Sequence, when set, must be greater than every sequence sent before
+	// for the same upload, as for the sequence field over HTTP
+	Sequence *int64
+	// Client identifies the sender for the audit log
+	Client string
+}
+
+// StoredChunk is the outcome of a StoreChunkRequest.
+type StoredChunk struct {
+	FileName      string
+	ChunkIndex    int
+	Size          int64
+	Checksum      string
+	ReceivedBytes int64
+	NextChunk     int
+	// Complete is set once every chunk of an upload with a known
+	// total_chunks is in
+	Complete bool
+}
+
+type InitUploadRequest struct {
+	FileName string `json:"file_name" query:"file_name" form:"file_name"`
+}
+
+// FailUploadRequest abandons the upload of FileName, or of the session
+// UploadID, before it is merged.
+type FailUploadRequest struct {
+	FileName string `json:"file_name"`
+	UploadID string `json:"upload_id"`
+	// Reason is logged with the cleanup, e.g. "source file deleted"
+	Reason string `json:"reason"`
+}
+
+// MaintenanceRequest turns maintenance mode on or off.
+type MaintenanceRequest struct {
+	Enabled *bool `json:"enabled"`
+	// RetryAfter, in seconds, replaces MAINTENANCE_RETRY_AFTER in the 503s
+	RetryAfter *int64 `json:"retry_after"`
+	// Message replaces the message of the 503s, e.g. to announce an end time
+	Message string `json:"message"`
+}
+
+type DeleteFilesRequest struct {
+	FileNames []string `json:"file_names"`
+}
+
+// ActiveUpload is an upload with chunks in the temp directory that has not
+// been merged yet.
+type ActiveUpload struct {
+	FileName string `json:"file_name"`
+	// UploadID is set for uploads opened through POST /upload/init
+	UploadID    string    `json:"upload_id,omitempty"`
+	Chunks      int       `json:"chunks"`
+	Size        int64     `json:"size"`
+	LastChunkAt time.Time `json:"last_chunk_at"`
+}
+
+// StorageStats summarizes storage usage, as reported by GET /stats.
+type StorageStats struct {
+	Files             int64 `json:"files"`
+	FileBytes         int64 `json:"file_bytes"`
+	TempChunks        int64 `json:"temp_chunks"`
+	TempBytes         int64 `json:"temp_bytes"`
+	UploadsInProgress int   `json:"uploads_in_progress"`
+	// MeasuredAt is when the counts were last recomputed from disk
+	MeasuredAt time.Time `json:"measured_at"`
+}
+
+// Capabilities describes what the server supports and the limits uploads
+// must keep to, as reported by GET /capabilities. Sizes are in bytes, zero
+// meaning no limit.
+type Capabilities struct {
+	ChunkBase int `json:"chunk_base"`
+	// ChunkSize is the suggested chunk size
+	ChunkSize    int64 `json:"chunk_size"`
+	MaxChunkSize int64 `json:"max_chunk_size"`
+	MaxFileSize  int64 `json:"max_file_size"`
+	// MaxChunks bounds the chunks of one upload, zero when unbounded
+	MaxChunks           int      `json:"max_chunks"`
+	HashAlgorithms      []string `json:"hash_algorithms"`
+	AllowedContentTypes []string `json:"allowed_content_types"`
+	// ChunkSignatures is "off", "optional" or "required"
+	ChunkSignatures   string               `json:"chunk_signatures"`
+	Uploads           UploadCapabilities   `json:"uploads"`
+	Merges            MergeCapabilities    `json:"merges"`
+	Downloads         DownloadCapabilities `json:"downloads"`
+	ResponseEncodings []string             `json:"response_encodings"`
+	// ChunkEncodings lists the Chunk-Encoding values chunks may be sent in
+	ChunkEncodings []string `json:"chunk_encodings"`
+}
+
+// UploadCapabilities lists the ways chunks can be uploaded.
+type UploadCapabilities struct {
+	Chunked  bool `json:"chunked"`
+	Sessions bool `json:"sessions"`
+	// RequireUploadID is set when chunks must belong to a session
+	RequireUploadID bool   `json:"require_upload_id"`
+	Range           bool   `json:"range"`
+	Tus             bool   `json:"tus"`
+	Manifests       bool   `json:"manifests"`
+	MultipleFiles   string `json:"multiple_files"`
+	DuplicateChunks string `json:"duplicate_chunks"`
+	// MultipartStorage is set when chunks go straight to object storage
+	MultipartStorage bool `json:"multipart_storage"`
+}
+
+// MergeCapabilities describes how uploads are assembled and named.
+type MergeCapabilities struct {
+	Append               bool   `json:"append"`
+	CollisionPolicy      string `json:"collision_policy"`
+	CaseInsensitiveNames bool   `json:"case_insensitive_names"`
+	ExtensionPolicy      string `json:"extension_policy"`
+	NameTransform        bool   `json:"name_transform"`
+	StorageLayout        string `json:"storage_layout"`
+}
+
+// DownloadCapabilities describes how stored files can be fetched.
+type DownloadCapabilities struct {
+	Ranges     bool `json:"ranges"`
+	Gzip       bool `json:"gzip"`
+	SignedURLs bool `json:"signed_urls"`
+	// Objects is set when content can be fetched by checksum
+	Objects bool `json:"objects"`
+}
+
+// SignDownloadRequest asks for a download URL of FileName valid for
+// ExpiresIn seconds, one hour when zero.
+type SignDownloadRequest struct {
+	FileName  string `json:"file_name"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// RenameFileRequest renames the merged file FileName to NewName.
+type RenameFileRequest struct {
+	FileName string `json:"file_name"`
+	NewName  string `json:"new_name"`
+}
+
+// MergeExternalRequest assembles FileName from chunk files placed in the temp
+// directory out-of-band, e.g. by rsync during a migration. The chunks are
+// either listed by name in order, or matched with a glob Pattern and ordered
+// by the number each name ends in.
+type MergeExternalRequest struct {
+	FileName string   `json:"file_name"`
+	Chunks   []string `json:"chunks"`
+	Pattern  string   `json:"pattern"`
+	// TotalSize, when set, must equal the sum of the chunk sizes exactly
+	TotalSize *int64            `json:"total_size"`
+	Metadata  map[string]string `json:"metadata"`
+	// RetainChunks keeps the chunk files after a successful merge
+	RetainChunks bool `json:"retain_chunks"`
+}
+
+// ChunkManifestRequest lists the expected SHA-256 of every chunk of an
+// upload, in index order, for the merge to verify.
+type ChunkManifestRequest struct {
+	FileName string   `json:"file_name"`
+	UploadID string   `json:"upload_id"`
+	Chunks   []string `json:"chunks"`
 }
 
 type MergeChunksRequest struct {
 	TotalChunks int    `json:"total_chunks" query:"total_chunks"`
 	FileName    string `json:"file_name" query:"file_name"`
+	// UploadID merges the chunks of a session; FileName may then be omitted
+	UploadID string `json:"upload_id" query:"upload_id"`
+	// Append streams the chunks onto the end of an existing file instead of replacing it
+	Append bool `json:"append" query:"append"`
+	// DryRun runs every validation and reports the outcome without writing anything
+	DryRun bool `json:"dry_run" query:"dry_run"`
+	// RetainChunks keeps the chunks after a successful merge; they are removed
+	// by the sweeper once the configured chunk retention expires
+	RetainChunks bool `json:"retain_chunks" query:"retain_chunks"`
+	// TotalSize, when set, must equal the sum of the chunk sizes exactly
+	TotalSize *int64 `json:"total_size" query:"total_size"`
+	// Metadata is arbitrary client context (original path, user ID, tags)
+	// stored in the file's sidecar
+	Metadata map[string]string `json:"metadata"`
+	// DownloadOnce deletes the merged file after its first complete download
+	DownloadOnce bool `json:"download_once" query:"download_once"`
+	// From and To select an inclusive range of chunks to assemble into a
+	// preview file; the chunks are kept and the upload stays open
+	From *int `json:"from" query:"from"`
+	To   *int `json:"to" query:"to"`
+	// Sources assembles the output, named by FileName, from the chunks of
+	// several uploads, one after the other in the order listed
+	Sources []MergeSource `json:"sources"`
+	// IfMatch and IfNoneMatch are preconditions on the file being replaced,
+	// as sent in the If-Match and If-None-Match headers over HTTP
+	IfMatch     string `json:"-" query:"-" form:"-"`
+	IfNoneMatch string `json:"-" query:"-" form:"-"`
+	// Client identifies the sender for the audit log
+	Client string `json:"-" query:"-" form:"-"`
+}
+
+// MergeSource is one upload whose chunks are part of a multi-source merge.
+type MergeSource struct {
+	FileName    string `json:"file_name"`
+	TotalChunks int    `json:"total_chunks"`
+}
+
+// MergeResult is the outcome of assembling the chunks of an upload.
+type MergeResult struct {
+	// FileName is the name the file was stored under, which the collision
+	// policy may have changed
+	FileName string
+	// Size is the number of bytes of the stored file
+	Size int64
+	// Appended is the number of bytes the merge assembled; it only differs
+	// from Size for appends
+	Appended int64
+	// Digests holds the hex encoded digests of the stored file by
+	// algorithm; sha256 is always present
+	Digests map[string]string
+	// ETag is the object store's ETag of the file with multipart storage,
+	// which computes no digests
+	ETag string
+	// Metadata is the client metadata stored with the file
+	Metadata map[string]string
+	// Warnings lists the chunks that were only read or written after retries
+	Warnings []string
+}
+
+// MergeEvent is the payload sent to the webhook when a merge finishes.
+type MergeEvent struct {
+	FileName  string    `json:"file_name"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+const (
+	MergeStatusSuccess = "success"
+	MergeStatusFailed  = "failed"
+)
+
+// AuditEvent is a single record of the append-only audit log.
+type AuditEvent struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	FileName   string    `json:"file_name"`
+	ChunkIndex *int      `json:"chunk_index,omitempty"`
+	Bytes      int64     `json:"bytes"`
+	Client     string    `json:"client"`
+	Status     string    `json:"status,omitempty"`
+}
+
+const (
+	AuditChunkReceived = "chunk_received"
+	AuditMerge         = "merge"
+	AuditDelete        = "delete"
+	AuditRename        = "rename"
+	AuditAbandon       = "abandon"
+)
+
+// FileMetadata is the content of a stored file's ".meta.json" sidecar.
+type FileMetadata struct {
+	FileName string `json:"file_name"`
+	// OriginalName is the name the client sent, when the naming policy or
+	// a collision stored the file under another one
+	OriginalName string `json:"original_name,omitempty"`
+	Size         int64  `json:"size"`
+	Checksum     string `json:"checksum"`
+	// Digests holds the hex encoded digest per configured hash algorithm,
+	// including the SHA-256 in Checksum
+	Digests  map[string]string `json:"digests,omitempty"`
+	StoredAt time.Time         `json:"stored_at"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// DownloadOnce deletes the file after its first complete download
+	DownloadOnce bool `json:"download_once,omitempty"`
+}
+
+// MergeLog is the content of a stored file's ".merge.json" sidecar, a record
+// of how its last merge assembled it.
+type MergeLog struct {
+	FileName   string    `json:"file_name"`
+	ChunkCount int       `json:"chunk_count"`
+	ChunkSizes []int64   `json:"chunk_sizes"`
+	Appended   int64     `json:"appended"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Append     bool      `json:"append"`
+	UploadID   string    `json:"upload_id,omitempty"`
+}
+
+// MergeReport records the integrity checks of one merge, retrievable through
+// GET /merge-report/:file_name for a while after the merge, e.g. when its
+// response was lost.
+type MergeReport struct {
+	FileName    string `json:"file_name"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	UploadID    string `json:"upload_id,omitempty"`
+	TotalChunks int    `json:"total_chunks"`
+	// Chunks lists every chunk that was present, in index order
+	Chunks []ChunkReport `json:"chunks"`
+	// ManifestVerified is set when every chunk was checked against a manifest
+	ManifestVerified bool `json:"manifest_verified"`
+	// ChunkSize is the session's chunk size the chunks were checked against
+	ChunkSize    int64  `json:"chunk_size,omitempty"`
+	ExpectedSize *int64 `json:"expected_size,omitempty"`
+	Size         int64  `json:"size"`
+	SizeMatched  *bool  `json:"size_matched,omitempty"`
+	Checksum     string `json:"checksum,omitempty"`
+	// Warnings are problems that did not fail the merge
+	Warnings   []string  `json:"warnings"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// ChunkReport is the entry of one chunk in a MergeReport. Checksum is the
+// SHA-256 recorded at upload, or computed for the manifest check; Expected is
+// the manifest's and Matched their comparison.
+type ChunkReport struct {
+	Index    int    `json:"index"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Matched  *bool  `json:"matched,omitempty"`
+}
+
+// FileStoredEvent is published to the post-processing queue for every newly
+// stored file.
+type FileStoredEvent struct {
+	FileName string    `json:"file_name"`
+	Size     int64     `json:"size"`
+	Checksum string    `json:"checksum,omitempty"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// MergeCompletion describes a successful merge to Config.OnMergeComplete.
+type MergeCompletion struct {
+	FileName string
+	// Path is where the file is stored, empty when it went to object storage
+	Path     string
+	Size     int64
+	Checksum string
+}
+
+// MergeRecord is a completed merge as stored by a merge recorder.
+type MergeRecord struct {
+	FileName string    `json:"file_name"`
+	Size     int64     `json:"size"`
+	Checksum string    `json:"checksum"`
+	MergedAt time.Time `json:"merged_at"`
+}
+
+type ZipDownloadRequest struct {
+	FileNames []string `json:"file_names"`
 }
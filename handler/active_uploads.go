@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// ActiveUploads handles GET /uploads/active, listing every upload with chunks
+// in the temp directory that has not been merged, with the number and total
+// size of its chunks and when the newest one arrived. Uploads longest without
+// a new chunk come first, so stalled ones top the list.
+func (h *ApiHandler) ActiveUploads(c *fiber.Ctx) error {
+	uploads := []domain.ActiveUpload{}
+	for key, names := range h.chunks.uploads() {
+		upload := domain.ActiveUpload{FileName: key}
+		if session, ok := h.sessions.get(key); ok {
+			upload.FileName = session.FileName
+			upload.UploadID = key
+		}
+
+		for _, name := range names {
+			info, err := os.Stat(filepath.Join(TempDir, name))
+			if os.IsNotExist(err) {
+				continue // Merged or swept since the names were taken
+			}
+			if err != nil {
+				return RespondError(c, ErrInternal.WithMessage("Failed to inspect chunks").Wrap(err))
+			}
+			upload.Chunks++
+			upload.Size += info.Size()
+			if info.ModTime().After(upload.LastChunkAt) {
+				upload.LastChunkAt = info.ModTime()
+			}
+		}
+		if upload.Chunks > 0 {
+			uploads = append(uploads, upload)
+		}
+	}
+
+	slices.SortFunc(uploads, func(a, b domain.ActiveUpload) int {
+		return a.LastChunkAt.Compare(b.LastChunkAt)
+	})
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":   false,
+		"uploads": uploads,
+	})
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"maps"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Error is an error with the HTTP status and machine-readable code of the
+// response it leads to. Code is stable across releases so clients can branch
+// on it; Message is meant for humans and may change.
+//
+// The package-level Err values are the sentinels; handlers derive the error
+// they answer with from one of them, adding a more specific message, the
+// underlying cause or extra response fields, and errors.Is still matches the
+// sentinel:
+//
+//	return RespondError(c, ErrInternal.WithMessage("Failed to read manifest").Wrap(err))
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	// Err is the underlying cause, sent as "details" unless
+	// Config.HideErrorDetails is set
+	Err error
+	// Fields are extra response fields, e.g. the indices of missing chunks
+	Fields fiber.Map
+}
+
+var (
+	ErrInvalidRequest     = &Error{Status: fiber.StatusBadRequest, Code: "invalid_request", Message: "Invalid request data"}
+	ErrInvalidFileName    = &Error{Status: fiber.StatusBadRequest, Code: "invalid_file_name", Message: "Invalid file name"}
+	ErrSessionMismatch    = &Error{Status: fiber.StatusBadRequest, Code: "session_mismatch", Message: "File name does not match the upload session"}
+	ErrSessionRequired    = &Error{Status: fiber.StatusBadRequest, Code: "session_required", Message: "upload_id is required"}
+	ErrUnauthorized       = &Error{Status: fiber.StatusUnauthorized, Code: "unauthorized", Message: "Invalid or missing API key"}
+	ErrChunkUnsigned      = &Error{Status: fiber.StatusUnauthorized, Code: "chunk_signature_required", Message: "Chunk signature required"}
+	ErrBadChunkSignature  = &Error{Status: fiber.StatusUnauthorized, Code: "invalid_chunk_signature", Message: "Chunk signature does not match"}
+	ErrSignatureInvalid   = &Error{Status: fiber.StatusForbidden, Code: "invalid_signature", Message: "Invalid download signature"}
+	ErrSignatureExpired   = &Error{Status: fiber.StatusForbidden, Code: "signature_expired", Message: "Download link has expired"}
+	ErrNotFound           = &Error{Status: fiber.StatusNotFound, Code: "not_found", Message: "Not found"}
+	ErrFileNotFound       = &Error{Status: fiber.StatusNotFound, Code: "file_not_found", Message: "File not found"}
+	ErrSessionNotFound    = &Error{Status: fiber.StatusNotFound, Code: "session_not_found", Message: "Unknown upload session"}
+	ErrConflict           = &Error{Status: fiber.StatusConflict, Code: "conflict", Message: "Conflict"}
+	ErrFileExists         = &Error{Status: fiber.StatusConflict, Code: "file_exists", Message: "File already exists"}
+	ErrChunkMissing       = &Error{Status: fiber.StatusConflict, Code: "chunk_missing", Message: "Missing chunks"}
+	ErrStaleSequence      = &Error{Status: fiber.StatusConflict, Code: "stale_sequence", Message: "Stale or duplicate sequence number"}
+	ErrChunkInFlight      = &Error{Status: fiber.StatusConflict, Code: "chunk_in_flight", Message: "Chunk is already being uploaded"}
+	ErrRangeOverlap       = &Error{Status: fiber.StatusConflict, Code: "range_overlap", Message: "Range overlaps bytes already received"}
+	ErrPreconditionFailed = &Error{Status: fiber.StatusPreconditionFailed, Code: "precondition_failed", Message: "Precondition failed"}
+	ErrChunkTooLarge      = &Error{Status: fiber.StatusRequestEntityTooLarge, Code: "chunk_too_large", Message: "Chunk is too large"}
+	ErrBodyTooLarge       = &Error{Status: fiber.StatusRequestEntityTooLarge, Code: "body_too_large", Message: "Request body is too large"}
+	ErrUploadTooLarge     = &Error{Status: fiber.StatusRequestEntityTooLarge, Code: "upload_too_large", Message: "Upload is larger than allowed"}
+	ErrDecompressionLimit = &Error{Status: fiber.StatusRequestEntityTooLarge, Code: "decompressed_too_large", Message: "Request body decompresses beyond the allowed size"}
+	ErrUnsupportedType    = &Error{Status: fiber.StatusUnsupportedMediaType, Code: "unsupported_media_type", Message: "Content type not allowed"}
+	ErrRangeNotSatisfied  = &Error{Status: fiber.StatusRequestedRangeNotSatisfiable, Code: "range_not_satisfiable", Message: "Range not satisfiable"}
+	ErrChecksumMismatch   = &Error{Status: fiber.StatusUnprocessableEntity, Code: "checksum_mismatch", Message: "Chunks do not match the manifest"}
+	ErrManifestMismatch   = &Error{Status: fiber.StatusUnprocessableEntity, Code: "manifest_mismatch", Message: "Manifest does not match total_chunks"}
+	ErrSizeMismatch       = &Error{Status: fiber.StatusUnprocessableEntity, Code: "size_mismatch", Message: "Chunk sizes do not add up to total_size"}
+	ErrChunkSizeMismatch  = &Error{Status: fiber.StatusUnprocessableEntity, Code: "chunk_size_mismatch", Message: "Only the last chunk may be smaller than the chunk size"}
+	ErrRateLimited        = &Error{Status: fiber.StatusTooManyRequests, Code: "rate_limited", Message: "Too many requests"}
+	ErrInternal           = &Error{Status: fiber.StatusInternalServerError, Code: "internal_error", Message: "Internal server error"}
+	ErrNotImplemented     = &Error{Status: fiber.StatusNotImplemented, Code: "not_implemented", Message: "Not implemented"}
+	ErrUpstream           = &Error{Status: fiber.StatusBadGateway, Code: "upstream_error", Message: "Object storage request failed"}
+	ErrBusy               = &Error{Status: fiber.StatusServiceUnavailable, Code: "busy", Message: "Too many merges in progress, retry shortly"}
+	ErrMaintenance        = &Error{Status: fiber.StatusServiceUnavailable, Code: "maintenance", Message: "The server is in maintenance, uploads and merges are paused"}
+	ErrTooManyUploads     = &Error{Status: fiber.StatusServiceUnavailable, Code: "too_many_uploads", Message: "Too many uploads in progress, complete or abort one first"}
+	ErrTooManyOpenFiles   = &Error{Status: fiber.StatusServiceUnavailable, Code: "too_many_open_files", Message: "Too many open files, retry shortly"}
+	ErrStorageUnavailable = &Error{Status: fiber.StatusServiceUnavailable, Code: "storage_unavailable", Message: "Storage is not writable"}
+	ErrStorageFull        = &Error{Status: fiber.StatusInsufficientStorage, Code: "storage_full", Message: "Temporary storage is full"}
+)
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors with the same code, so an error derived from a sentinel
+// still is that sentinel.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage returns a copy of e with a more specific message.
+func (e *Error) WithMessage(message string) *Error {
+	derived := *e
+	derived.Message = message
+	return &derived
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	derived := *e
+	derived.Err = err
+	return &derived
+}
+
+// With returns a copy of e with fields added to its response.
+func (e *Error) With(fields fiber.Map) *Error {
+	derived := *e
+	derived.Fields = make(fiber.Map, len(e.Fields)+len(fields))
+	maps.Copy(derived.Fields, e.Fields)
+	maps.Copy(derived.Fields, fields)
+	return &derived
+}
+
+// body returns the response envelope of e.
+func (e *Error) body() fiber.Map {
+	body := fiber.Map{
+		"error":   true,
+		"code":    e.Code,
+		"message": e.Message,
+	}
+	if e.Err != nil {
+		body["details"] = e.Err.Error()
+	}
+	for key, value := range e.Fields {
+		body[key] = value
+	}
+	return body
+}
+
+// RespondError answers the request with err: an *Error with its status,
+// code and fields, anything else as an internal error with err as details.
+// Every failing endpoint answers through it, so error responses always carry
+// the same fields.
+func RespondError(c *fiber.Ctx, err error) error {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrInternal.Wrap(err)
+	}
+	return Respond(c, apiErr.Status, apiErr.body())
+}
@@ -1,206 +1,758 @@
 package handler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime/multipart"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mohammadanang/uploads-api/domain"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// UploadDir holds the merged files.
+	UploadDir = "./uploads"
+	// TempDir holds the uploaded chunks until they are merged.
+	TempDir = "./temp"
 )
 
 type Handler interface {
 	UploadFile(c *fiber.Ctx) error
 	MergeChunks(c *fiber.Ctx) error
+	AuditLog(c *fiber.Ctx) error
+	UploadRange(c *fiber.Ctx) error
+	RangeStatus(c *fiber.Ctx) error
+	Ready(c *fiber.Ctx) error
+	InitUpload(c *fiber.Ctx) error
+	FileInfo(c *fiber.Ctx) error
+	RecentUploads(c *fiber.Ctx) error
+	Middleware(c *fiber.Ctx) error
+	Download(c *fiber.Ctx) error
+	DeleteFiles(c *fiber.Ctx) error
+	FileExists(c *fiber.Ctx) error
+	UploadManifest(c *fiber.Ctx) error
+	RenameFile(c *fiber.Ctx) error
+	MergeReport(c *fiber.Ctx) error
+	MergeExternal(c *fiber.Ctx) error
+	SignDownload(c *fiber.Ctx) error
+	DownloadObject(c *fiber.Ctx) error
+	DownloadZip(c *fiber.Ctx) error
+	ActiveUploads(c *fiber.Ctx) error
+	Stats(c *fiber.Ctx) error
+	Capabilities(c *fiber.Ctx) error
+	VerifyFile(c *fiber.Ctx) error
+	FailUpload(c *fiber.Ctx) error
+	Maintenance(c *fiber.Ctx) error
+	SetMaintenance(c *fiber.Ctx) error
+	StoreChunk(ctx context.Context, req domain.StoreChunkRequest) (domain.StoredChunk, error)
+	MergeFile(ctx context.Context, req domain.MergeChunksRequest) (domain.MergeResult, error)
+	Close() error
 }
 
-type ApiHandler struct{}
+type ApiHandler struct {
+	cfg       Config
+	fileLocks *keyedMutex
+	ranges    *rangeRegistry
+	progress  *progressRegistry
+	sessions  *sessionRegistry
+	multipart *multipartRegistry
+	sequences *sequenceRegistry
+	chunks    *chunkNames
+	// mergeSlots is a semaphore holding one token per running merge
+	mergeSlots chan struct{}
+	// openChunks is a semaphore holding one token per chunk file a merge
+	// has open
+	openChunks chan struct{}
+	tempUsage  *tempUsage
+	inflight   *inflightRegistry
+	stats      *storageStats
+	tracer     trace.Tracer
+	// downloads holds the one-time files currently being downloaded
+	downloads sync.Map
+	reports   *reportRegistry
+	// maintenance pauses the endpoints that write when enabled
+	maintenance *maintenanceMode
+	// closed stops the background refresher and sweeper once Close is called
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewAPIHandler(cfg Config) Handler {
+	// A fresh server has its directories before the first request, so a merge
+	// never depends on an upload having created them; the handlers still
+	// recreate one deleted while the server runs
+	for _, dir := range []string{UploadDir, TempDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			log.Printf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	h := &ApiHandler{
+		cfg:       cfg.withDefaults(),
+		fileLocks: newKeyedMutex(),
+		ranges:    newRangeRegistry(),
+		progress:  newProgressRegistry(),
+		sessions:  newSessionRegistry(),
+		multipart: newMultipartRegistry(),
+		sequences: newSequenceRegistry(),
+		chunks:    loadChunkNames(),
+		inflight:  newInflightRegistry(),
+		closed:    make(chan struct{}),
+	}
+	h.mergeSlots = make(chan struct{}, h.cfg.MaxConcurrentMerges)
+	h.openChunks = make(chan struct{}, h.cfg.MaxOpenChunks)
+	h.tempUsage = newTempUsage(h.cfg.MaxTempSize)
+	h.chunks.maxKeys = h.cfg.MaxActiveUploads
+	h.stats = newStorageStats(h.storageDirs())
+	h.tracer = h.cfg.TracerProvider.Tracer(tracerName)
+	h.reports = newReportRegistry(h.cfg.MergeReportTTL)
+	h.maintenance = newMaintenanceMode(h.cfg.MaintenanceMode, h.cfg.MaintenanceRetryAfter)
+	h.startRefresher()
+	if h.cfg.ChunkRetention > 0 {
+		h.startChunkSweeper()
+	}
+
+	return h
+}
 
-func NewAPIHandler() Handler {
-	return &ApiHandler{}
+// Close stops the background work of the handler: the refreshes of the
+// cached temp usage and storage stats and the chunk sweeper. Requests in
+// progress are not waited for. It is safe to call more than once.
+func (h *ApiHandler) Close() error {
+	h.closeOnce.Do(func() { close(h.closed) })
+	return nil
 }
 
 func (h *ApiHandler) UploadFile(c *fiber.Ctx) error {
+	span := h.startSpan(c, "UploadFile")
+	defer endSpan(c, span)
+
+	// Writes are paused while the server is in maintenance
+	if err := h.checkMaintenance(c); err != nil {
+		return RespondError(c, err)
+	}
+
 	// Ensure the uploads directory exists
-	if _, err := os.Stat("./uploads"); os.IsNotExist(err) {
+	if _, err := os.Stat(UploadDir); os.IsNotExist(err) {
 		// Create the uploads directory if it does not exist
 		// This is necessary to avoid errors when saving uploaded files
 		// os.MkdirAll creates a directory named path, along with any necessary parents,
 		// and returns nil, or else returns an error.
 		// os.ModePerm sets the permissions for the directory
 		// to the default mode (read, write, and execute for owner, and read and execute for others).
-		os.MkdirAll("./uploads", os.ModePerm)
+		os.MkdirAll(UploadDir, os.ModePerm)
 	}
 
 	// Ensure the temp directory exists
-	if _, err := os.Stat("./temp"); os.IsNotExist(err) {
+	if _, err := os.Stat(TempDir); os.IsNotExist(err) {
 		// Create the temp directory if it does not exist
 		// This directory can be used for temporary file storage during the upload process
-		os.MkdirAll("./temp", os.ModePerm)
+		os.MkdirAll(TempDir, os.ModePerm)
+	}
+
+	// Reject oversized chunks from the declared length before the multipart
+	// body is parsed. Bodies sent without a Content-Length (chunked transfer
+	// encoding) report -1 and are bounded while copying instead. A request
+	// of sequential chunks may carry several, each checked on its own below
+	if h.cfg.MaxChunkSize > 0 && h.cfg.MultipleFiles != MultipleFilesSequential &&
+		int64(c.Request().Header.ContentLength()) > h.cfg.MaxChunkSize+maxMultipartOverhead {
+		return chunkTooLarge(c, h.cfg.MaxChunkSize)
 	}
 
 	body := new(domain.UploadFileRequest)
-	if err := c.BodyParser(body); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "Invalid request data",
-			"details": err.Error(),
-		})
+	if err := bodyParser(c, body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
 	}
 
-	file, err := c.FormFile("file")
+	// Indices below the configured base mean the client uses the other
+	// convention; mixing them would leave chunks the merge never reads
+	if body.ChunkIndex < h.cfg.ChunkBase {
+		return RespondError(c, ErrInvalidRequest.WithMessage(fmt.Sprintf("chunk_index must be at least %d", h.cfg.ChunkBase)))
+	}
+	encoding, apiErr := chunkEncoding(c.Get(ChunkEncodingHeader))
+	if apiErr != nil {
+		return RespondError(c, apiErr)
+	}
+	body.ChunkEncoding = encoding
+	// Parts go to object storage with their size, which an encoded chunk
+	// only has once decoded
+	if encoding != "" && h.cfg.MultipartStorage != nil {
+		return RespondError(c, ErrNotImplemented.WithMessage("Encoded chunks are not available with multipart storage"))
+	}
+
+	file, err := formFile(c, "file")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "File upload failed",
-			"details": err.Error(),
-		})
+		return RespondError(c, ErrInvalidRequest.WithMessage("File upload failed").Wrap(err))
+	}
+	span.SetAttributes(attrChunkIndex.Int(body.ChunkIndex), attrChunkSize.Int64(file.Size))
+	// formFile only returns the first of several files; the rest would
+	// silently go missing and only surface as missing chunks at the merge
+	files, err := h.chunkFiles(c, file)
+	if err != nil {
+		return RespondError(c, err)
+	}
+	if len(files) > 1 && body.Progress {
+		return RespondError(c, ErrInvalidRequest.WithMessage("Progress streaming takes one chunk per request"))
+	}
+	if encoding != "" && body.Progress {
+		return RespondError(c, ErrInvalidRequest.WithMessage("Progress streaming takes unencoded chunks"))
+	}
+	for _, file := range files {
+		if h.cfg.MaxChunkSize > 0 && file.Size > h.cfg.MaxChunkSize {
+			return chunkTooLarge(c, h.cfg.MaxChunkSize)
+		}
+	}
+	// Signed chunks are checked in full before anything is stored
+	if err := h.verifyChunkFiles(c, body.ChunkIndex, files); err != nil {
+		return RespondError(c, err)
 	}
 
-	// Process the file (e.g., save it to disk or cloud storage)
-	tempFile := filepath.Join("./temp", fmt.Sprintf("%s.part%d", file.Filename, body.ChunkIndex))
-	// Create a temporary file to store the uploaded chunk
-	outputFile, err := os.Create(tempFile)
+	// Chunks of a session are stored under its upload ID rather than the
+	// client's file name, so two clients uploading photo.jpg never mix chunks
+	fileName, chunkKey, err := h.resolveUpload(body.UploadID, file.Filename)
+	if err != nil {
+		return RespondError(c, err)
+	}
+	span.SetAttributes(attrFileName.String(fileName), attrUploadID.String(body.UploadID))
+
+	// Session uploads were told the chunk size at init; a larger chunk means
+	// the client split the file differently and the merge would misalign
+	if chunkSize := h.sessionChunkSize(body.UploadID); chunkSize > 0 {
+		for _, file := range files {
+			if file.Size > chunkSize {
+				return RespondError(c, ErrInvalidRequest.WithMessage("Chunk exceeds the upload's chunk size").With(fiber.Map{
+					"chunk_size": chunkSize,
+				}))
+			}
+		}
+	}
+
+	// A sequence number that does not exceed every earlier one of the upload
+	// is a replayed or reordered request and is refused before any write. It
+	// is only recorded once the chunk is stored, so a failed upload can be
+	// retried with it; the progress stream releases the lock when done
+	release, err := h.checkSequence(body.Sequence, chunkKey)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to create temporary file",
-			"details": err.Error(),
+		return RespondError(c, err)
+	}
+	streaming := false
+	defer func() {
+		if !streaming {
+			release()
+		}
+	}()
+
+	if h.cfg.MultipartStorage != nil {
+		return h.uploadPart(c, body, fileName, chunkKey, file)
+	}
+
+	if len(files) > 1 {
+		return h.uploadSequential(c, body, fileName, chunkKey, files)
+	}
+
+	// A retry of a chunk already stored with the same content is answered
+	// from what was recorded for it
+	if chunk, ok := h.duplicateChunk(chunkKey, body.ChunkIndex, body.Checksum, file.Size); ok {
+		receivedBytes, next, complete := h.chunkStored(body, fileName, chunkKey, chunk, clientIdentity(c))
+		h.setProgressHeaders(c, chunkKey)
+		return Respond(c, fiber.StatusOK, fiber.Map{
+			"error":          false,
+			"message":        "Chunk already uploaded",
+			"file":           fileName,
+			"received_bytes": receivedBytes,
+			"checksum":       chunk.checksum,
+			"next_chunk":     next,
+			"complete":       complete,
+			"duplicate":      true,
 		})
 	}
-	defer outputFile.Close()
 
+	if body.Progress {
+		streaming = true
+		return h.uploadWithProgress(c, body, fileName, chunkKey, file, release)
+	}
+
+	// Process the file (e.g., save it to disk or cloud storage)
+	stored, apiErr := h.writeChunk(file, body, fileName, chunkKey, clientIdentity(c), nil)
+	if apiErr != nil {
+		if tooManyOpenFiles(apiErr) {
+			c.Set(fiber.HeaderRetryAfter, "1")
+		}
+		return RespondError(c, apiErr)
+	}
+
+	h.setProgressHeaders(c, chunkKey)
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":          false,
+		"message":        "File uploaded successfully",
+		"file":           fileName,
+		"received_bytes": stored.ReceivedBytes,
+		"checksum":       stored.Checksum,
+		"next_chunk":     stored.NextChunk,
+		"complete":       stored.Complete,
+		"duplicate":      false,
+	})
+}
+
+// writeChunk stores an uploaded multipart chunk with saveChunk.
+func (h *ApiHandler) writeChunk(file *multipart.FileHeader, body *domain.UploadFileRequest, fileName, chunkKey, client string, onWrite io.Writer) (domain.StoredChunk, *Error) {
 	// Open the uploaded file
 	fileReader, err := file.Open()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to open uploaded file",
-			"details": err.Error(),
-		})
+		return domain.StoredChunk{}, storageFailure("Failed to open uploaded file", err)
 	}
 	defer fileReader.Close()
 
-	buf := make([]byte, 1*1024*1024) // 1 MB buffer
-	// Copy the file content to the temporary file
-	_, err = io.CopyBuffer(outputFile, fileReader, buf)
+	var src io.Reader = fileReader
+	if body.ChunkEncoding != "" {
+		decoded, err := h.decodeChunk(fileReader, file.Size, body.ChunkEncoding)
+		if err != nil {
+			return domain.StoredChunk{}, ErrInvalidRequest.WithMessage("Malformed chunk encoding").Wrap(err)
+		}
+		defer decoded.Close()
+		src = decoded
+	}
+
+	return h.saveChunk(src, file.Size, body, fileName, chunkKey, client, onWrite)
+}
+
+// saveChunk stores chunk body.ChunkIndex of chunkKey, of the declared size,
+// from src and records it towards the upload's progress. It is the chunk
+// write every transport shares, with the checks of the request left to the
+// caller; client identifies the sender for the audit log. Every write is
+// also reported to onWrite when it is not nil.
+func (h *ApiHandler) saveChunk(src io.Reader, size int64, body *domain.UploadFileRequest, fileName, chunkKey, client string, onWrite io.Writer) (domain.StoredChunk, *Error) {
+	// Zero-byte chunks are stored as empty part files, which the merge treats as present
+	// The part file gets a random server-side name; the client's file name
+	// or upload ID only serves as the key it is recorded under
+	tempFile, err := h.chunks.assign(chunkKey, body.ChunkIndex)
+	if errors.Is(err, errTooManyUploads) {
+		return domain.StoredChunk{}, ErrTooManyUploads.With(fiber.Map{"max_active_uploads": h.cfg.MaxActiveUploads})
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to write file chunk",
-			"details": err.Error(),
+		return domain.StoredChunk{}, storageFailure("Failed to store chunk", err)
+	}
+
+	chunk, message, err := h.storeChunk(src, size, tempFile, onWrite)
+	switch {
+	case errors.Is(err, errChunkTooLarge):
+		return domain.StoredChunk{}, ErrChunkTooLarge.With(fiber.Map{"max_chunk_size": h.cfg.MaxChunkSize})
+	case errors.Is(err, errTempFull):
+		// Limits are not internal errors, there are no details to hide
+		return domain.StoredChunk{}, ErrStorageFull.WithMessage(message)
+	case errors.Is(err, errChunkInFlight):
+		return domain.StoredChunk{}, ErrChunkInFlight
+	case errors.Is(err, errBodyTooLarge):
+		return domain.StoredChunk{}, ErrDecompressionLimit.WithMessage("Chunk decompresses beyond the allowed size").With(fiber.Map{
+			"max_decompressed_size": h.cfg.MaxDecompressedSize,
+			"max_compression_ratio": h.cfg.MaxCompressionRatio,
 		})
+	case errors.Is(err, errMalformedChunk):
+		return domain.StoredChunk{}, ErrInvalidRequest.WithMessage("Malformed chunk encoding").Wrap(err)
+	case err != nil:
+		return domain.StoredChunk{}, storageFailure(message, err)
+	}
+
+	received, next, complete := h.chunkStored(body, fileName, chunkKey, chunk, client)
+	return domain.StoredChunk{
+		FileName:      fileName,
+		ChunkIndex:    body.ChunkIndex,
+		Size:          chunk.size,
+		Checksum:      chunk.checksum,
+		ReceivedBytes: received,
+		NextChunk:     next,
+		Complete:      complete,
+	}, nil
+}
+
+// storeChunk copies a chunk of the declared size from src to tempFile and
+// returns its size and SHA-256, hashed while copying. Every write is also
+// reported to onWrite when it is not nil. On failure the message describes
+// the step that failed.
+func (h *ApiHandler) storeChunk(src io.Reader, size int64, tempFile string, onWrite io.Writer) (info chunkInfo, message string, err error) {
+	// A copy of a chunk arriving while the chunk is being written is refused
+	// or answered with the first write's result, per Config.DuplicateChunks
+	if h.cfg.DuplicateChunks != DuplicateChunksWrite {
+		write, first := h.inflight.begin(tempFile)
+		if !first {
+			if h.cfg.DuplicateChunks == DuplicateChunksReject {
+				return info, "Chunk is already being uploaded", errChunkInFlight
+			}
+			<-write.done
+			return write.info, write.message, write.err
+		}
+		defer func() { h.inflight.finish(tempFile, write, info, message, err) }()
+	}
+
+	// Account for the chunk before writing it; a failed write gives the space
+	// back, a successful one gives back whatever part file it replaced
+	if !h.tempUsage.reserve(size) {
+		return info, "Temporary storage is full", errTempFull
+	}
+	defer func() {
+		if err != nil {
+			h.tempUsage.release(size)
+		}
+	}()
+
+	// The chunk is written to a unique staging file and renamed into place once
+	// complete, so a retried chunk racing its original upload never leaves an
+	// interleaved or truncated part file behind: the last complete write wins.
+	// The staging name does not parse as a part file, so merges ignore it.
+	outputFile, err := os.CreateTemp(TempDir, filepath.Base(tempFile)+".*.tmp")
+	if err != nil {
+		return info, "Failed to create temporary file", err
 	}
+	stagingFile := outputFile.Name()
+	defer func() {
+		outputFile.Close()
+		os.Remove(stagingFile) // No-op once renamed into place
+	}()
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"error":   false,
-		"message": "File uploaded successfully",
-		"file":    file.Filename,
+	source := src
+	if h.cfg.MaxChunkSize > 0 {
+		source = &maxBytesReader{r: src, remaining: h.cfg.MaxChunkSize}
+	}
+	hasher := sha256.New()
+	destination := io.MultiWriter(outputFile, hasher)
+	if onWrite != nil {
+		destination = io.MultiWriter(outputFile, hasher, onWrite)
+	}
+
+	buf := getBuffer(h.cfg.BufferSize)
+	defer putBuffer(buf)
+	// Copy the file content to the temporary file
+	written, err := io.CopyBuffer(destination, source, *buf)
+	if err != nil {
+		return info, "Failed to write file chunk", err
+	}
+	// CreateTemp makes owner-only files; part files keep the usual mode
+	if err := outputFile.Chmod(0o644); err != nil {
+		return info, "Failed to write file chunk", err
+	}
+	if err := outputFile.Close(); err != nil {
+		return info, "Failed to write file chunk", err
+	}
+	var replaced int64
+	previous, statErr := os.Stat(tempFile)
+	if statErr == nil {
+		replaced = previous.Size()
+	}
+	if err := os.Rename(stagingFile, tempFile); err != nil {
+		return info, "Failed to store file chunk", err
+	}
+	h.tempUsage.release(replaced + size - written)
+	h.stats.chunkStored(written, statErr == nil, replaced)
+
+	return chunkInfo{size: written, checksum: hex.EncodeToString(hasher.Sum(nil))}, "", nil
+}
+
+// chunkStored audits a stored chunk and returns the bytes received for the
+// upload so far, the next chunk the client should send and whether the upload
+// is complete.
+func (h *ApiHandler) chunkStored(body *domain.UploadFileRequest, fileName, chunkKey string, chunk chunkInfo, client string) (int64, int, bool) {
+	h.audit(domain.AuditEvent{
+		Time:       time.Now(),
+		Action:     domain.AuditChunkReceived,
+		FileName:   fileName,
+		ChunkIndex: &body.ChunkIndex,
+		Bytes:      chunk.size,
+		Client:     client,
+		Status:     domain.MergeStatusSuccess,
 	})
+
+	if body.Sequence != nil {
+		h.sequences.advance(chunkKey, *body.Sequence)
+	}
+	received, next := h.progress.record(chunkKey, h.cfg.ChunkBase, body.ChunkIndex, chunk)
+	next, complete := h.acknowledge(body, next)
+	return received, next, complete
+}
+
+// checkSequence takes the sequence lock of chunkKey and refuses a sequence
+// not greater than every one recorded for it. It returns the function
+// releasing the lock, which does nothing for a request without a sequence.
+func (h *ApiHandler) checkSequence(sequence *int64, chunkKey string) (func(), error) {
+	if sequence == nil {
+		return func() {}, nil
+	}
+	release := h.sequences.lock(chunkKey)
+	if highest, ok := h.sequences.check(chunkKey, *sequence); !ok {
+		release()
+		return nil, ErrStaleSequence.With(fiber.Map{
+			"sequence":         *sequence,
+			"highest_sequence": highest,
+		})
+	}
+	return release, nil
+}
+
+// acknowledge tells the client which chunk to send next: the first index
+// after the contiguous run of received chunks. Once total_chunks is known
+// and all of them are in, the upload is complete and next_chunk is -1.
+func (h *ApiHandler) acknowledge(body *domain.UploadFileRequest, next int) (int, bool) {
+	if body.TotalChunks > 0 && next >= h.cfg.ChunkBase+body.TotalChunks {
+		return -1, true
+	}
+	return next, false
 }
 
 func (h *ApiHandler) MergeChunks(c *fiber.Ctx) error {
+	started := time.Now()
+	span := h.startSpan(c, "MergeChunks")
+	defer endSpan(c, span)
+
+	if err := h.checkMaintenance(c); err != nil {
+		return RespondError(c, err)
+	}
+
 	body := new(domain.MergeChunksRequest)
 	if err := c.BodyParser(body); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "Invalid request data",
-			"details": err.Error(),
-		})
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
 	}
+	body.IfMatch, body.IfNoneMatch = c.Get(fiber.HeaderIfMatch), c.Get(fiber.HeaderIfNoneMatch)
+	body.Client = clientIdentity(c)
 
-	outPath := filepath.Join("./uploads", body.FileName)
-	// Create the output file where all chunks will be merged
-	outputFile, err := os.Create(outPath)
+	switch {
+	case len(body.Sources) > 0:
+		return h.mergeSources(c, body, started)
+	case body.From != nil || body.To != nil:
+		return h.mergePreview(c, body)
+	case body.DryRun:
+		return h.dryRunMerge(c, body)
+	}
+
+	result, err := h.mergeFile(c.UserContext(), body, started)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to create output file",
-			"details": err.Error(),
+		if errors.Is(err, ErrBusy) || errors.Is(err, ErrTooManyOpenFiles) {
+			c.Set(fiber.HeaderRetryAfter, "1")
+		}
+		return RespondError(c, err)
+	}
+
+	// In multipart mode the object store assembled the file and only has its ETag
+	if h.cfg.MultipartStorage != nil {
+		return Respond(c, fiber.StatusOK, fiber.Map{
+			"error":   false,
+			"message": "Chunks merged successfully",
+			"file":    result.FileName,
+			"size":    result.Size,
+			"etag":    result.ETag,
 		})
 	}
-	defer outputFile.Close()
-
-	var mutx sync.Mutex
-	var wg sync.WaitGroup
-	for i := range body.TotalChunks {
-		wg.Add(1)
-
-		// Use a goroutine to handle each chunk
-		// This allows concurrent processing of chunks, which can speed up the merging process
-		// Each goroutine will read a chunk file and write its content to the output file
-		// The chunk files are named in the format "filename.partX" where X is the chunk index
-		// The mutex is used to ensure that only one goroutine writes to the output file at a time
-		// This prevents data corruption or other issues that could occur if multiple goroutines try to write to the file at the same time
-		go func(chunkIndex int) {
-			defer wg.Done()
-			chunkPath := filepath.Join("./temp", fmt.Sprintf("%s.part%d", body.FileName, chunkIndex))
-			// Open the temporary file for the chunk
-			chunkFile, err := os.Open(chunkPath)
-			if err != nil {
-				if os.IsNotExist(err) {
-					fmt.Printf("Chunk %d does not exist, %v\n", chunkIndex, err.Error())
-					return
-				}
-
-				fmt.Printf("Failed to open chunk %d: %v\n", chunkIndex, err)
-				return
-			}
-			defer chunkFile.Close()
 
-			chunkData, err := io.ReadAll(chunkFile)
-			if err != nil {
-				fmt.Printf("Failed to read chunk %d: %v\n", chunkIndex, err)
-				return
-			}
+	checksum := result.Digests[HashSHA256]
+	c.Set(fiber.HeaderETag, formatETag(checksum))
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":    false,
+		"message":  "Chunks merged successfully",
+		"file":     result.FileName,
+		"size":     result.Size,
+		"appended": result.Appended,
+		"checksum": checksum,
+		"digests":  result.Digests,
+		"metadata": result.Metadata,
+	})
+}
+
+// mergeSucceeded reports a stored file to the audit log, the webhook, the
+// merge report and Config.OnMergeComplete.
+func (h *ApiHandler) mergeSucceeded(run *mergeRun, fileName string, size int64, checksum string) {
+	if run.report != nil {
+		run.report.Size = size
+		run.report.Checksum = checksum
+	}
+	h.finishReport(run, fileName, domain.MergeStatusSuccess, nil)
+	h.audit(domain.AuditEvent{
+		Time:     time.Now(),
+		Action:   domain.AuditMerge,
+		FileName: fileName,
+		Bytes:    size,
+		Client:   run.client,
+		Status:   domain.MergeStatusSuccess,
+	})
+	h.notifyWebhook(domain.MergeEvent{
+		FileName:  fileName,
+		Size:      size,
+		Checksum:  checksum,
+		Status:    domain.MergeStatusSuccess,
+		Timestamp: time.Now(),
+	})
+	h.recordMerge(domain.MergeRecord{
+		FileName: fileName,
+		Size:     size,
+		Checksum: checksum,
+		MergedAt: time.Now(),
+	})
+	h.publish(domain.FileStoredEvent{
+		FileName: fileName,
+		Size:     size,
+		Checksum: checksum,
+		StoredAt: time.Now(),
+	})
+	h.mergeComplete(fileName, size, checksum)
+}
+
+// mergeFailed reports a failed merge to the audit log, the webhook and the
+// merge report.
+func (h *ApiHandler) mergeFailed(run *mergeRun, fileName string, err error) {
+	h.finishReport(run, fileName, domain.MergeStatusFailed, err)
+	h.audit(domain.AuditEvent{
+		Time:     time.Now(),
+		Action:   domain.AuditMerge,
+		FileName: fileName,
+		Client:   run.client,
+		Status:   domain.MergeStatusFailed,
+	})
+	h.notifyWebhook(domain.MergeEvent{
+		FileName:  fileName,
+		Status:    domain.MergeStatusFailed,
+		Error:     err.Error(),
+		Timestamp: time.Now(),
+	})
+}
 
-			// Lock the mutex to ensure only one goroutine writes to the output file at a time
-			mutx.Lock()
-			defer mutx.Unlock()
+type chunkResult struct {
+	data []byte
+	err  error
+	// retries is how often reading the chunk failed before it succeeded
+	// or was given up on
+	retries int
+}
 
-			_, err = outputFile.Write(chunkData)
-			if err != nil {
-				fmt.Printf("Failed to write chunk %d to output file: %v\n", chunkIndex, err)
-				return
-			}
+func readChunk(path string) ([]byte, error) {
+	chunkFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer chunkFile.Close()
+
+	info, err := chunkFile.Stat()
+	if err != nil {
+		return nil, err
+	}
 
-			// Optionally, you can remove the chunk file after merging
-			os.Remove(chunkPath)
-		}(i)
+	// Read into an exactly sized slice instead of letting io.ReadAll grow one
+	data := make([]byte, info.Size())
+	if _, err := io.ReadFull(chunkFile, data); err != nil {
+		return nil, err
 	}
-	wg.Wait()
 
-	if err := cleanUpTempFiles(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to clean up temporary files",
-			"details": err.Error(),
+	return data, nil
+}
+
+// missingChunks fails a merge whose chunks are not all present with 409.
+// Missing chunks at the end usually mean the client's total_chunks is off by
+// one or more, so that run is reported separately along with the number of
+// chunks actually uploaded.
+func (h *ApiHandler) missingChunks(run *mergeRun, body *domain.MergeChunksRequest, missing []int) *Error {
+	h.mergeFailed(run, body.FileName, fmt.Errorf("missing chunks %v", missing))
+
+	trailing := trailingChunks(missing, h.cfg.ChunkBase+body.TotalChunks-1)
+	if len(trailing) == 0 {
+		return ErrChunkMissing.With(fiber.Map{
+			"missing_chunks": missing,
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"error":   false,
-		"message": "Chunks merged successfully",
+	message := "Missing chunks"
+	if len(trailing) == len(missing) {
+		message = "total_chunks is larger than the number of chunks uploaded"
+	}
+	return ErrChunkMissing.WithMessage(message).With(fiber.Map{
+		"missing_chunks":          missing,
+		"missing_trailing_chunks": trailing,
+		"uploaded_chunks":         body.TotalChunks - len(missing),
 	})
 }
 
-func cleanUpTempFiles() error {
-	if _, err := os.Stat("./temp"); os.IsNotExist(err) {
-		return nil // No temp directory to clean up
+// trailingChunks returns the run of consecutive indices at the end of the
+// sorted missing that ends at last, the index of the final chunk.
+func trailingChunks(missing []int, last int) []int {
+	start := len(missing)
+	for start > 0 && missing[start-1] == last-(len(missing)-start) {
+		start--
 	}
 
-	files, err := filepath.Glob("./temp/*.part*")
-	if err != nil {
-		return fmt.Errorf("failed to list temp files: %w", err)
+	return missing[start:]
+}
+
+// lastChunkSize returns the size of the final chunk, the one most likely to
+// have been truncated, or -1 when there are no chunks.
+func lastChunkSize(sizes []int64) int64 {
+	if len(sizes) == 0 {
+		return -1
 	}
 
-	for _, file := range files {
-		if err := os.Remove(file); err != nil {
+	return sizes[len(sizes)-1]
+}
+
+// sumSizes adds up the sizes reported by inspectChunks, skipping missing chunks.
+func sumSizes(sizes []int64) int64 {
+	var total int64
+	for _, size := range sizes {
+		if size > 0 {
+			total += size
+		}
+	}
+
+	return total
+}
+
+// inspectChunks stats the part files of chunks [base, base+totalChunks) of
+// chunkKey. It returns the size of every present chunk (-1 for missing ones)
+// in order and the missing indices. Empty part files count as present.
+func (h *ApiHandler) inspectChunks(chunkKey string, base, totalChunks int) ([]int64, []int, error) {
+	sizes := make([]int64, totalChunks)
+	missing := []int{}
+	for i := range totalChunks {
+		path, ok := h.chunks.path(chunkKey, base+i)
+		if !ok {
+			sizes[i] = -1
+			missing = append(missing, base+i)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, nil, fmt.Errorf("failed to stat chunk %d: %w", base+i, err)
+			}
+			sizes[i] = -1
+			missing = append(missing, base+i)
+			continue
+		}
+		sizes[i] = info.Size()
+	}
+
+	return sizes, missing, nil
+}
+
+// cleanUpTempFiles removes every part file of chunkKey, including chunks
+// beyond the merged count, and forgets their names. Chunks of other uploads
+// are left alone.
+func (h *ApiHandler) cleanUpTempFiles(chunkKey string) error {
+	for _, file := range h.chunks.paths(chunkKey) {
+		info, statErr := os.Stat(file)
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to remove temp file %s: %w", file, err)
 		}
+		if statErr == nil {
+			h.stats.chunkRemoved(info.Size())
+		}
 	}
 
+	if err := h.chunks.forget(chunkKey); err != nil {
+		return fmt.Errorf("failed to record removed chunks: %w", err)
+	}
 	return nil
 }
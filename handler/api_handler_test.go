@@ -0,0 +1,420 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMergeChunksTrailingEmptyChunk(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := newTestApp(h)
+
+	if status, body := uploadChunk(t, app, "exact.txt", 0, []byte("hello")); status != fiber.StatusOK {
+		t.Fatalf("upload of chunk 0: status %d: %v", status, body)
+	}
+	status, body := uploadChunk(t, app, "exact.txt", 1, nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("upload of the empty chunk: status %d: %v", status, body)
+	}
+	if received := body["received_bytes"]; received != float64(5) {
+		t.Errorf("received_bytes = %v, want 5", received)
+	}
+
+	status, body = postJSON(t, app, "/merge-chunk", fiber.Map{
+		"file_name":    "exact.txt",
+		"total_chunks": 2,
+		"total_size":   5,
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("merge: status %d: %v", status, body)
+	}
+	if size := body["size"]; size != float64(5) {
+		t.Errorf("size = %v, want 5", size)
+	}
+
+	data, err := os.ReadFile(h.filePath("exact.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("merged file holds %q, want %q", data, "hello")
+	}
+	if parts := partFiles(t); len(parts) != 0 {
+		t.Errorf("part files left after the merge: %v", parts)
+	}
+}
+
+func TestUploadFileConcurrentDuplicateChunk(t *testing.T) {
+	for _, policy := range []string{DuplicateChunksWrite, DuplicateChunksWait, DuplicateChunksReject} {
+		t.Run(policy, func(t *testing.T) {
+			h := newTestHandler(t, Config{DuplicateChunks: policy})
+			app := newTestApp(h)
+
+			// Every copy has its own content, so an interleaved write shows
+			const copies, size = 8, 256 * 1024
+			contents := make([][]byte, copies)
+			statuses := make([]int, copies)
+			var wg sync.WaitGroup
+			for i := range copies {
+				contents[i] = bytes.Repeat([]byte{byte('a' + i)}, size)
+				req := multipartRequest(t, map[string]string{"chunk_index": "0"}, testFile{name: "retried.bin", data: contents[i]})
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := app.Test(req, -1)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					resp.Body.Close()
+					statuses[i] = resp.StatusCode
+				}()
+			}
+			wg.Wait()
+			for i, status := range statuses {
+				if status != fiber.StatusOK && !(policy == DuplicateChunksReject && status == fiber.StatusConflict) {
+					t.Errorf("copy %d: status %d", i, status)
+				}
+			}
+
+			parts := partFiles(t)
+			if len(parts) != 1 {
+				t.Fatalf("part files = %v, want exactly one", parts)
+			}
+			data, err := os.ReadFile(parts[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			complete := false
+			for _, content := range contents {
+				complete = complete || bytes.Equal(data, content)
+			}
+			if !complete {
+				t.Errorf("part file of %d bytes is not one complete copy", len(data))
+			}
+			if entries := journalEntries(t, "retried.bin"); entries != 1 {
+				t.Errorf("journal assigns %d names to the chunk, want 1", entries)
+			}
+		})
+	}
+}
+
+// journalEntries counts the names the chunk journal assigns to chunks of key.
+func journalEntries(t *testing.T, key string) int {
+	t.Helper()
+	journal, err := os.Open(filepath.Join(TempDir, chunkJournalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	count := 0
+	lines := bufio.NewScanner(journal)
+	for lines.Scan() {
+		var entry chunkJournalEntry
+		if err := json.Unmarshal(lines.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Key == key && entry.Name != "" {
+			count++
+		}
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestMergeChunksFailureLeavesNoFile(t *testing.T) {
+	// unreadable turns the part file of chunk index into a directory, which
+	// inspectChunks finds present but cannot be read once the output exists
+	unreadable := func(h *ApiHandler, index int) {
+		path, _ := h.chunks.path("broken.bin", index)
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		prep   func(t *testing.T, h *ApiHandler, app *fiber.App)
+		merge  map[string]any
+		status int
+		code   string
+		// message, when set, pins the step that failed
+		message string
+	}{
+		{
+			name:   "missing chunk",
+			merge:  map[string]any{"total_chunks": 3},
+			status: fiber.StatusConflict,
+			code:   ErrChunkMissing.Code,
+		},
+		{
+			name:   "size mismatch",
+			merge:  map[string]any{"total_chunks": 2, "total_size": 999},
+			status: ErrSizeMismatch.Status,
+			code:   ErrSizeMismatch.Code,
+		},
+		{
+			name: "manifest mismatch",
+			prep: func(t *testing.T, h *ApiHandler, app *fiber.App) {
+				postManifest(t, app, "broken.bin", checksumOf("first"), strings.Repeat("0", 64))
+			},
+			merge:  map[string]any{"total_chunks": 2},
+			status: ErrChecksumMismatch.Status,
+			code:   ErrChecksumMismatch.Code,
+		},
+		{
+			name: "manifest chunk count",
+			prep: func(t *testing.T, h *ApiHandler, app *fiber.App) {
+				postManifest(t, app, "broken.bin", checksumOf("first"))
+			},
+			merge:  map[string]any{"total_chunks": 2},
+			status: ErrManifestMismatch.Status,
+			code:   ErrManifestMismatch.Code,
+		},
+		{
+			name: "unreadable chunk",
+			prep: func(t *testing.T, h *ApiHandler, app *fiber.App) {
+				unreadable(h, 1)
+			},
+			merge:   map[string]any{"total_chunks": 2},
+			status:  fiber.StatusInternalServerError,
+			code:    ErrInternal.Code,
+			message: "Failed to read chunk 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Config{MergeRetries: -1})
+			app := newTestApp(h)
+			for i, content := range []string{"first", "second"} {
+				if status, body := uploadChunk(t, app, "broken.bin", i, []byte(content)); status != fiber.StatusOK {
+					t.Fatalf("upload of chunk %d: status %d: %v", i, status, body)
+				}
+			}
+			if tt.prep != nil {
+				tt.prep(t, h, app)
+			}
+
+			tt.merge["file_name"] = "broken.bin"
+			status, body := postJSON(t, app, "/merge-chunk", tt.merge)
+			if status != tt.status || body["code"] != tt.code {
+				t.Fatalf("status %d: %v, want %d %s", status, body, tt.status, tt.code)
+			}
+			if tt.message != "" && body["message"] != tt.message {
+				t.Errorf("message = %v, want %q", body["message"], tt.message)
+			}
+			if files := storedFiles(t); len(files) != 0 {
+				t.Errorf("failed merge left %v in the uploads dir", files)
+			}
+		})
+	}
+
+	t.Run("append", func(t *testing.T) {
+		h := newTestHandler(t, Config{MergeRetries: -1})
+		app := newTestApp(h)
+		if err := os.WriteFile(h.filePath("broken.bin"), []byte("original"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for i, content := range []string{"first", "second"} {
+			if status, body := uploadChunk(t, app, "broken.bin", i, []byte(content)); status != fiber.StatusOK {
+				t.Fatalf("upload of chunk %d: status %d: %v", i, status, body)
+			}
+		}
+		unreadable(h, 1)
+
+		status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "broken.bin", "total_chunks": 2, "append": true})
+		if status != fiber.StatusInternalServerError {
+			t.Fatalf("status %d: %v, want 500", status, body)
+		}
+		data, err := os.ReadFile(h.filePath("broken.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "original" {
+			t.Errorf("failed append left %q, want the original %q", data, "original")
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		h := newTestHandler(t, Config{MergeRetries: -1, CollisionPolicy: CollisionOverwrite})
+		app := newTestApp(h)
+		upload := func() {
+			for i, content := range []string{"first", "second"} {
+				if status, body := uploadChunk(t, app, "broken.bin", i, []byte(content)); status != fiber.StatusOK {
+					t.Fatalf("upload of chunk %d: status %d: %v", i, status, body)
+				}
+			}
+		}
+		upload()
+		if status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "broken.bin", "total_chunks": 2}); status != fiber.StatusOK {
+			t.Fatalf("first merge: status %d: %v", status, body)
+		}
+		before := storedFiles(t)
+		meta, err := os.ReadFile(h.metadataPath("broken.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		upload()
+		unreadable(h, 1)
+		status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "broken.bin", "total_chunks": 2})
+		if status != fiber.StatusInternalServerError {
+			t.Fatalf("status %d: %v, want 500", status, body)
+		}
+		if data, err := os.ReadFile(h.filePath("broken.bin")); err != nil || string(data) != "firstsecond" {
+			t.Errorf("failed overwrite left %q, %v, want the stored %q", data, err, "firstsecond")
+		}
+		if data, err := os.ReadFile(h.metadataPath("broken.bin")); err != nil || string(data) != string(meta) {
+			t.Errorf("failed overwrite changed the metadata to %s, %v", data, err)
+		}
+		if after := storedFiles(t); strings.Join(after, ",") != strings.Join(before, ",") {
+			t.Errorf("uploads dir = %v after the failed overwrite, want %v", after, before)
+		}
+	})
+}
+
+// postManifest stores the chunk checksums of fileName for the merge to verify.
+func postManifest(t *testing.T, app *fiber.App, fileName string, checksums ...string) {
+	t.Helper()
+	status, body := postJSON(t, app, "/manifest", map[string]any{"file_name": fileName, "chunks": checksums})
+	if status != fiber.StatusCreated {
+		t.Fatalf("manifest: status %d: %v", status, body)
+	}
+}
+
+// checksumOf returns the hex encoded SHA-256 of content.
+func checksumOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMergeChunksKeepsChunksOnFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail makes the merge fail and returns how to let the retry pass
+		fail func(t *testing.T, h *ApiHandler, app *fiber.App) func()
+	}{
+		{
+			name: "manifest mismatch",
+			fail: func(t *testing.T, h *ApiHandler, app *fiber.App) func() {
+				postManifest(t, app, "kept.bin", checksumOf("first"), strings.Repeat("0", 64))
+				return func() { postManifest(t, app, "kept.bin", checksumOf("first"), checksumOf("second")) }
+			},
+		},
+		{
+			// The chunks are assembled before the sidecar is written, which
+			// fails while a non-empty directory sits in its place
+			name: "metadata write",
+			fail: func(t *testing.T, h *ApiHandler, app *fiber.App) func() {
+				blocker := h.metadataPath("kept.bin")
+				if err := os.MkdirAll(filepath.Join(blocker, "blocker"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				return func() {
+					if err := os.RemoveAll(blocker); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Config{})
+			app := newTestApp(h)
+			for i, content := range []string{"first", "second"} {
+				if status, body := uploadChunk(t, app, "kept.bin", i, []byte(content)); status != fiber.StatusOK {
+					t.Fatalf("upload of chunk %d: status %d: %v", i, status, body)
+				}
+			}
+			parts := partFiles(t)
+			allow := tt.fail(t, h, app)
+
+			merge := map[string]any{"file_name": "kept.bin", "total_chunks": 2}
+			if status, body := postJSON(t, app, "/merge-chunk", merge); status == fiber.StatusOK {
+				t.Fatalf("merge succeeded: %v", body)
+			}
+			if kept := partFiles(t); strings.Join(kept, ",") != strings.Join(parts, ",") {
+				t.Fatalf("part files after the failed merge = %v, want %v", kept, parts)
+			}
+			for i := range 2 {
+				if _, ok := h.chunks.path("kept.bin", i); !ok {
+					t.Errorf("chunk %d was forgotten by the failed merge", i)
+				}
+			}
+
+			// The kept chunks are enough to retry
+			allow()
+			if status, body := postJSON(t, app, "/merge-chunk", merge); status != fiber.StatusOK {
+				t.Fatalf("retried merge: status %d: %v", status, body)
+			}
+			data, err := os.ReadFile(h.filePath("kept.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "firstsecond" {
+				t.Errorf("retried merge stored %q, want %q", data, "firstsecond")
+			}
+		})
+	}
+}
+
+func TestNewAPIHandlerMergesWithoutDirectories(t *testing.T) {
+	tests := []struct {
+		name string
+		// remove is deleted after the handler is created, as by an operator
+		// cleaning up while the server runs
+		remove string
+	}{
+		{name: "fresh"},
+		{name: "uploads dir removed", remove: UploadDir},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Config{})
+			app := newTestApp(h)
+			for _, dir := range []string{UploadDir, TempDir} {
+				if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+					t.Fatalf("%s after NewAPIHandler: %v", dir, err)
+				}
+			}
+
+			if status, body := uploadChunk(t, app, "fresh.txt", 0, []byte("hello")); status != fiber.StatusOK {
+				t.Fatalf("upload: status %d: %v", status, body)
+			}
+			if tt.remove != "" {
+				if err := os.RemoveAll(tt.remove); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "fresh.txt", "total_chunks": 1})
+			if status != fiber.StatusOK {
+				t.Fatalf("merge: status %d: %v", status, body)
+			}
+			data, err := os.ReadFile(h.filePath("fresh.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "hello" {
+				t.Errorf("merged file holds %q, want %q", data, "hello")
+			}
+		})
+	}
+}
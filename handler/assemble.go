@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// AssembleChunks writes the chunks of the upload stored under key, its file
+// name or upload ID, to w in order, with the assembly of a merge, but
+// without a server or an HTTP request: for scripts and debugging. The chunk
+// journal is only read, so a running server is not disturbed, and the
+// chunks stay in place. A totalChunks of 0 assembles every chunk up to the
+// highest index recorded. Every chunk must be present before anything is
+// written.
+func AssembleChunks(cfg Config, w io.Writer, key string, totalChunks int) (int64, error) {
+	chunks, err := readChunkNames()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read chunk journal: %w", err)
+	}
+	h := &ApiHandler{cfg: cfg.withDefaults(), chunks: chunks}
+	h.openChunks = make(chan struct{}, h.cfg.MaxOpenChunks)
+	h.tracer = h.cfg.TracerProvider.Tracer(tracerName)
+	base := h.cfg.ChunkBase
+
+	if totalChunks == 0 {
+		last, ok := chunks.last(key)
+		if !ok {
+			return 0, fmt.Errorf("no chunks recorded for %s", key)
+		}
+		totalChunks = last - base + 1
+	}
+	_, missing, err := h.inspectChunks(key, base, totalChunks)
+	if err != nil {
+		return 0, err
+	}
+	if len(missing) > 0 {
+		return 0, fmt.Errorf("missing chunks %v of %s", missing, key)
+	}
+
+	result, err := h.assemble(context.Background(), key, totalChunks, w, nil)
+	return result.Size, err
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// AuditSink receives an audit event for every chunk received and every merge.
+// Implementations must be safe for concurrent use.
+type AuditSink interface {
+	Record(event domain.AuditEvent) error
+}
+
+// AuditReader is implemented by sinks that can return what they recorded.
+// GET /audit/:file_name is only available when the sink implements it.
+type AuditReader interface {
+	Events(fileName string) ([]domain.AuditEvent, error)
+}
+
+// FileAuditSink appends audit events as JSON lines to a local file.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileAuditSink(path string) *FileAuditSink {
+	return &FileAuditSink{path: path}
+}
+
+func (s *FileAuditSink) Record(event domain.AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The file is opened in append-only mode so existing records are never rewritten
+	file, err := openNoFollow(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileAuditSink) Events(fileName string) ([]domain.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []domain.AuditEvent{}
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return events, nil
+		}
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event domain.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue // Skip torn or foreign lines rather than failing the whole read
+		}
+		if event.FileName == fileName {
+			events = append(events, event)
+		}
+	}
+
+	return events, scanner.Err()
+}
+
+// audit records event, logging instead of failing the request when the sink
+// is unavailable.
+func (h *ApiHandler) audit(event domain.AuditEvent) {
+	if err := h.cfg.AuditSink.Record(event); err != nil {
+		log.Printf("failed to record audit event for %s: %v", event.FileName, err)
+	}
+}
+
+func (h *ApiHandler) AuditLog(c *fiber.Ctx) error {
+	reader, ok := h.cfg.AuditSink.(AuditReader)
+	if !ok {
+		return RespondError(c, ErrNotImplemented.WithMessage("The configured audit sink cannot be queried"))
+	}
+
+	fileName := c.Params("file_name")
+	events, err := reader.Events(fileName)
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read audit log").Wrap(err))
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":  false,
+		"file":   fileName,
+		"events": events,
+	})
+}
@@ -0,0 +1,30 @@
+package handler
+
+import "sync"
+
+// copyBuffers recycles the byte buffers used to stream chunks and files, which
+// would otherwise be allocated on every request.
+var copyBuffers = sync.Pool{
+	New: func() any {
+		return new([]byte)
+	},
+}
+
+// getBuffer returns a pooled buffer of exactly size bytes. Pass it back to
+// putBuffer once the copy is done.
+func getBuffer(size int) *[]byte {
+	buf := copyBuffers.Get().(*[]byte)
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	*buf = (*buf)[:size]
+
+	return buf
+}
+
+// putBuffer zeroes buf so no previous upload's data can leak into the next
+// user of the buffer, then returns it to the pool.
+func putBuffer(buf *[]byte) {
+	clear(*buf)
+	copyBuffers.Put(buf)
+}
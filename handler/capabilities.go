@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// Capabilities handles GET /capabilities, describing the upload protocol
+// this server speaks and its limits, all derived from the configuration, so
+// clients can pick chunk sizes and features instead of hard-coding them.
+func (h *ApiHandler) Capabilities(c *fiber.Ctx) error {
+	// Every chunk of a local upload sits in the temp directory until the
+	// merge, so its limit bounds the file; object storage bounds the part
+	// count instead
+	maxFileSize, maxChunks := h.cfg.MaxTempSize, 0
+	if h.cfg.MultipartStorage != nil {
+		maxChunks = maxPartNumber
+		maxFileSize = int64(maxPartNumber) * h.cfg.MaxChunkSize
+	}
+
+	signatures := "off"
+	if h.cfg.ChunkSigningKey != "" {
+		signatures = "optional"
+		if h.cfg.RequireChunkSignatures {
+			signatures = "required"
+		}
+	}
+
+	allowedTypes := h.cfg.AllowedContentTypes
+	if allowedTypes == nil {
+		allowedTypes = []string{}
+	}
+
+	chunkEncodings := ChunkEncodings
+	if h.cfg.MultipartStorage != nil {
+		chunkEncodings = []string{}
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error": false,
+		"capabilities": domain.Capabilities{
+			ChunkBase:           h.cfg.ChunkBase,
+			ChunkSize:           h.cfg.ChunkSize,
+			MaxChunkSize:        h.cfg.MaxChunkSize,
+			MaxFileSize:         maxFileSize,
+			MaxChunks:           maxChunks,
+			HashAlgorithms:      h.cfg.HashAlgorithms,
+			AllowedContentTypes: allowedTypes,
+			ChunkSignatures:     signatures,
+			Uploads: domain.UploadCapabilities{
+				Chunked:          true,
+				Sessions:         true,
+				RequireUploadID:  h.cfg.RequireUploadID,
+				Range:            true,
+				Tus:              false,
+				Manifests:        true,
+				MultipleFiles:    h.cfg.MultipleFiles,
+				DuplicateChunks:  h.cfg.DuplicateChunks,
+				MultipartStorage: h.cfg.MultipartStorage != nil,
+			},
+			Merges: domain.MergeCapabilities{
+				Append:               h.cfg.StorageLayout != StorageLayoutContent,
+				CollisionPolicy:      h.cfg.CollisionPolicy,
+				CaseInsensitiveNames: h.cfg.CaseInsensitiveNames,
+				ExtensionPolicy:      h.cfg.ExtensionPolicy,
+				NameTransform:        h.cfg.NameTransformer != nil,
+				StorageLayout:        h.cfg.StorageLayout,
+			},
+			Downloads: domain.DownloadCapabilities{
+				Ranges:     true,
+				Gzip:       h.cfg.GzipDownloads,
+				SignedURLs: h.cfg.DownloadSigningKey != "",
+				Objects:    h.cfg.StorageLayout == StorageLayoutContent,
+			},
+			ResponseEncodings: []string{fiber.MIMEApplicationJSON, MIMEApplicationMsgPack},
+			ChunkEncodings:    chunkEncodings,
+		},
+	})
+}
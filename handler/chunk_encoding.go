@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ChunkEncodingHeader names the compression the content of a chunk upload's
+// file parts was encoded with, one of ChunkEncodings. The chunk is decoded
+// before it is stored, so merges and digests see the original bytes.
+const ChunkEncodingHeader = "Chunk-Encoding"
+
+// ChunkEncodings lists the encodings chunks may be sent in, as advertised by
+// GET /capabilities.
+var ChunkEncodings = []string{"gzip", "zstd"}
+
+// errMalformedChunk is returned when the content of an encoded chunk does not
+// decode.
+var errMalformedChunk = errors.New("chunk does not decode")
+
+// chunkEncoding returns the encoding the Chunk-Encoding header names, empty
+// when the chunk is sent as is. Other encodings are refused with 415.
+func chunkEncoding(header string) (string, *Error) {
+	encoding := strings.ToLower(strings.TrimSpace(header))
+	if encoding == "" || encoding == "identity" {
+		return "", nil
+	}
+	for _, supported := range ChunkEncodings {
+		if encoding == supported {
+			return encoding, nil
+		}
+	}
+	return "", ErrUnsupportedType.WithMessage("Unsupported chunk encoding").With(fiber.Map{
+		"chunk_encoding":  header,
+		"chunk_encodings": ChunkEncodings,
+	})
+}
+
+// decodeChunk returns a reader of the decoded content of src, the size
+// bytes of a chunk in encoding. Like compressed request bodies, the chunk
+// may decompress to at most MaxDecompressedSize bytes and MaxCompressionRatio
+// times its size; reading beyond fails with errBodyTooLarge.
+func (h *ApiHandler) decodeChunk(src io.Reader, size int64, encoding string) (io.ReadCloser, error) {
+	var decoded io.ReadCloser
+	switch encoding {
+	case "gzip":
+		r, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errMalformedChunk, err)
+		}
+		decoded = r
+	case "zstd":
+		r, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		decoded = r.IOReadCloser()
+	default:
+		return nil, fmt.Errorf("unsupported chunk encoding %q", encoding)
+	}
+
+	limit := int64(math.MaxInt64)
+	if h.cfg.MaxDecompressedSize > 0 {
+		limit = h.cfg.MaxDecompressedSize
+	}
+	if h.cfg.MaxCompressionRatio > 0 && size <= limit/int64(h.cfg.MaxCompressionRatio) {
+		limit = size * int64(h.cfg.MaxCompressionRatio)
+	}
+	return readCloser{&limitedReader{r: decodeErrors{decoded}, n: limit}, decoded}, nil
+}
+
+// decodeErrors reports the read errors of a decoder as errMalformedChunk.
+type decodeErrors struct {
+	r io.Reader
+}
+
+func (d decodeErrors) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %v", errMalformedChunk, err)
+	}
+	return n, err
+}
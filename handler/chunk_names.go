@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// chunkJournalName is the file in TempDir persisting the chunk names.
+	chunkJournalName = "chunks.journal"
+	// partSuffix ends the server-generated name of every part file.
+	partSuffix = ".part"
+)
+
+// errTooManyUploads is returned when a chunk would start an upload beyond
+// MaxActiveUploads.
+var errTooManyUploads = errors.New("too many uploads in progress")
+
+// chunkRef identifies one chunk of an upload.
+type chunkRef struct {
+	key   string
+	index int
+}
+
+// chunkJournalEntry is a line of the chunk journal. An entry with a name
+// assigns it to the chunk; one without removes the chunk, or every chunk of
+// the key when Index is nil too.
+type chunkJournalEntry struct {
+	Key   string `json:"key"`
+	Index *int   `json:"index,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// chunkNames maps every chunk, by upload key and index, to the random name
+// of its part file, so no part of a temp path ever comes from the client.
+// Changes are appended to a journal in TempDir and replayed on start, so
+// uploads survive a restart.
+type chunkNames struct {
+	mu     sync.Mutex
+	names  map[string]map[int]string
+	owners map[string]chunkRef
+	// journal is the open journal file; entries counts its lines so it can
+	// be compacted once mostly made of removed chunks
+	journal *os.File
+	entries int
+	// maxKeys, when positive, bounds the uploads with chunks at the same time
+	maxKeys int
+}
+
+// loadChunkNames replays the journal in TempDir and rewrites it compacted.
+// A journal that cannot be read is logged and the mapping starts empty.
+func loadChunkNames() *chunkNames {
+	n := newChunkNames()
+	if err := n.replay(); err != nil {
+		log.Printf("failed to replay chunk journal: %v", err)
+	}
+	n.mu.Lock()
+	if err := n.compact(); err != nil {
+		log.Printf("failed to compact chunk journal: %v", err)
+	}
+	n.mu.Unlock()
+
+	return n
+}
+
+// readChunkNames replays the journal in TempDir without writing it, for
+// reading the chunks of a server that may be running.
+func readChunkNames() (*chunkNames, error) {
+	n := newChunkNames()
+	return n, n.replay()
+}
+
+func newChunkNames() *chunkNames {
+	return &chunkNames{
+		names:  make(map[string]map[int]string),
+		owners: make(map[string]chunkRef),
+	}
+}
+
+// replay applies every entry of the journal to the mapping.
+func (n *chunkNames) replay() error {
+	file, err := os.Open(filepath.Join(TempDir, chunkJournalName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry chunkJournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line torn by a crash mid-write only loses that change
+			continue
+		}
+		n.apply(entry)
+	}
+
+	return scanner.Err()
+}
+
+// apply updates the mapping with a journal entry. The caller holds n.mu or
+// has exclusive access.
+func (n *chunkNames) apply(entry chunkJournalEntry) {
+	switch {
+	case entry.Name != "" && entry.Index != nil:
+		if !validPartName(entry.Name) {
+			return
+		}
+		if n.names[entry.Key] == nil {
+			n.names[entry.Key] = make(map[int]string)
+		}
+		n.names[entry.Key][*entry.Index] = entry.Name
+		n.owners[entry.Name] = chunkRef{key: entry.Key, index: *entry.Index}
+	case entry.Index != nil:
+		if name, ok := n.names[entry.Key][*entry.Index]; ok {
+			delete(n.owners, name)
+			delete(n.names[entry.Key], *entry.Index)
+			// An upload without chunks left no longer counts as active
+			if len(n.names[entry.Key]) == 0 {
+				delete(n.names, entry.Key)
+			}
+		}
+	default:
+		for _, name := range n.names[entry.Key] {
+			delete(n.owners, name)
+		}
+		delete(n.names, entry.Key)
+	}
+}
+
+// path returns the part file of chunk index of key.
+func (n *chunkNames) path(key string, index int) (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	name, ok := n.names[key][index]
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(TempDir, name), true
+}
+
+// assign returns the part file of chunk index of key, generating and
+// journaling a new name the first time the chunk is uploaded. Re-uploads
+// keep the name so the new part replaces the old one. The first chunk of a
+// new key fails with errTooManyUploads once maxKeys uploads have chunks.
+func (n *chunkNames) assign(key string, index int) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if name, ok := n.names[key][index]; ok {
+		return filepath.Join(TempDir, name), nil
+	}
+	if _, ok := n.names[key]; !ok && n.maxKeys > 0 && len(n.names) >= n.maxKeys {
+		return "", errTooManyUploads
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate chunk name: %w", err)
+	}
+	name := hex.EncodeToString(b[:]) + partSuffix
+
+	entry := chunkJournalEntry{Key: key, Index: &index, Name: name}
+	if err := n.write(entry); err != nil {
+		return "", fmt.Errorf("failed to record chunk name: %w", err)
+	}
+	n.apply(entry)
+
+	return filepath.Join(TempDir, name), nil
+}
+
+// paths returns the part files of every chunk of key.
+func (n *chunkNames) paths(key string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	paths := make([]string, 0, len(n.names[key]))
+	for _, name := range n.names[key] {
+		paths = append(paths, filepath.Join(TempDir, name))
+	}
+	return paths
+}
+
+// forget drops every chunk of key, after its part files were removed.
+func (n *chunkNames) forget(key string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.names[key]; !ok {
+		return nil
+	}
+	entry := chunkJournalEntry{Key: key}
+	n.apply(entry)
+	return n.writeAndCompact(entry)
+}
+
+// forgetPart drops the chunk stored in the part file name and returns the
+// key it belonged to.
+func (n *chunkNames) forgetPart(name string) (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ref, ok := n.owners[name]
+	if !ok {
+		return "", false
+	}
+	entry := chunkJournalEntry{Key: ref.key, Index: &ref.index}
+	n.apply(entry)
+	if err := n.writeAndCompact(entry); err != nil {
+		log.Printf("failed to record removal of chunk %s: %v", name, err)
+	}
+	return ref.key, true
+}
+
+// uploads returns the part file names of every upload with chunks, by key.
+func (n *chunkNames) uploads() map[string][]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	uploads := make(map[string][]string, len(n.names))
+	for key, chunks := range n.names {
+		for _, name := range chunks {
+			uploads[key] = append(uploads[key], name)
+		}
+	}
+	return uploads
+}
+
+// keys returns the number of uploads with chunks.
+func (n *chunkNames) keys() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return len(n.names)
+}
+
+// last returns the highest chunk index recorded for key.
+func (n *chunkNames) last(key string) (int, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	last, ok := 0, false
+	for index := range n.names[key] {
+		if !ok || index > last {
+			last, ok = index, true
+		}
+	}
+	return last, ok
+}
+
+// owned reports whether the part file name stores a chunk of an upload.
+func (n *chunkNames) owned(name string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, ok := n.owners[name]
+	return ok
+}
+
+// write appends entry to the journal. The caller holds n.mu.
+func (n *chunkNames) write(entry chunkJournalEntry) error {
+	if n.journal == nil {
+		if err := os.MkdirAll(TempDir, os.ModePerm); err != nil {
+			return err
+		}
+		journal, err := openNoFollow(filepath.Join(TempDir, chunkJournalName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		n.journal = journal
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := n.journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	n.entries++
+
+	return nil
+}
+
+// writeAndCompact appends a removal to the journal and rewrites the journal
+// once it holds far more lines than live chunks. The caller holds n.mu.
+func (n *chunkNames) writeAndCompact(entry chunkJournalEntry) error {
+	if err := n.write(entry); err != nil {
+		return err
+	}
+	if n.entries > 4*len(n.owners)+1024 {
+		return n.compact()
+	}
+	return nil
+}
+
+// compact rewrites the journal with one line per live chunk, replacing the
+// old journal atomically. The caller holds n.mu.
+func (n *chunkNames) compact() error {
+	if err := os.MkdirAll(TempDir, os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(TempDir, chunkJournalName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for name, ref := range n.owners {
+		if err := encoder.Encode(chunkJournalEntry{Key: ref.key, Index: &ref.index, Name: name}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if n.journal != nil {
+		n.journal.Close()
+		n.journal = nil
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(TempDir, chunkJournalName)); err != nil {
+		return err
+	}
+	n.entries = len(n.owners)
+
+	return nil
+}
+
+// validPartName reports whether name has the shape of a generated part file
+// name, so a tampered journal cannot point outside TempDir.
+func validPartName(name string) bool {
+	hexPart, ok := strings.CutSuffix(name, partSuffix)
+	if !ok || len(hexPart) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(hexPart)
+	return err == nil
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ChunkSignatureHeader carries the signatures of the chunks of a request:
+// the hex encoded HMAC-SHA256 under Config.ChunkSigningKey of the file name,
+// the chunk index and the chunk's bytes, each followed by a newline but the
+// last. A request with several files sends one per file, comma separated.
+const ChunkSignatureHeader = "X-Chunk-Signature"
+
+// verifyChunk checks the signature of the chunk read from src, named
+// fileName and at index (the start offset for range uploads). Without a
+// signing key nothing is checked; without a signature the chunk only passes
+// when signatures are optional.
+func (h *ApiHandler) verifyChunk(signature, fileName string, index int64, src io.Reader) *Error {
+	if h.cfg.ChunkSigningKey == "" {
+		return nil
+	}
+	if signature == "" {
+		if h.cfg.RequireChunkSignatures {
+			return ErrChunkUnsigned
+		}
+		return nil
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrBadChunkSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(h.cfg.ChunkSigningKey))
+	mac.Write([]byte(fileName + "\n" + strconv.FormatInt(index, 10) + "\n"))
+	if _, err := io.Copy(mac, src); err != nil {
+		return ErrInternal.WithMessage("Failed to read chunk").Wrap(err)
+	}
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrBadChunkSignature
+	}
+	return nil
+}
+
+// verifyChunkFiles checks the signature of every chunk file of an upload
+// request, read in full before any of them is stored. The files hold
+// consecutive chunks from chunkIndex on.
+func (h *ApiHandler) verifyChunkFiles(c *fiber.Ctx, chunkIndex int, files []*multipart.FileHeader) *Error {
+	if h.cfg.ChunkSigningKey == "" {
+		return nil
+	}
+	var signatures []string
+	if header := c.Get(ChunkSignatureHeader); header != "" {
+		signatures = strings.Split(header, ",")
+		if len(signatures) != len(files) {
+			return ErrBadChunkSignature.WithMessage("Expected one chunk signature per file").With(fiber.Map{
+				"files":      len(files),
+				"signatures": len(signatures),
+			})
+		}
+	}
+
+	for i, file := range files {
+		signature := ""
+		if signatures != nil {
+			signature = strings.TrimSpace(signatures[i])
+		}
+		src, err := file.Open()
+		if err != nil {
+			return ErrInternal.WithMessage("Failed to open file").Wrap(err)
+		}
+		if apiErr := h.verifyChunk(signature, file.Filename, int64(chunkIndex+i), src); apiErr != nil {
+			src.Close()
+			return apiErr.With(fiber.Map{"chunk_index": chunkIndex + i})
+		}
+		src.Close()
+	}
+	return nil
+}
+
+// verifyRange checks the signature of the bytes of a range upload, which
+// stand in for the chunk index with their start offset.
+func (h *ApiHandler) verifyRange(c *fiber.Ctx, fileName string, start int64, data []byte) *Error {
+	return h.verifyChunk(c.Get(ChunkSignatureHeader), fileName, start, bytes.NewReader(data))
+}
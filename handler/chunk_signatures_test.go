@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+const testChunkKey = "chunk-secret"
+
+// signChunk returns the signature of chunk index of fileName under key, as
+// a client would compute it.
+func signChunk(key, fileName string, index int, data string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(fileName + "\n" + strconv.Itoa(index) + "\n" + data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestUploadFileChunkSignatures(t *testing.T) {
+	chunks := []testFile{{name: "signed.bin", data: []byte("first")}, {name: "signed.bin", data: []byte("second")}}
+	first, second := signChunk(testChunkKey, "signed.bin", 2, "first"), signChunk(testChunkKey, "signed.bin", 3, "second")
+
+	tests := []struct {
+		name     string
+		required bool
+		// signatures is the header sent, if any
+		signatures string
+		status     int
+		code       string
+	}{
+		{name: "signed", signatures: first + "," + second, status: fiber.StatusOK},
+		{name: "spaces after commas", signatures: first + ", " + second, status: fiber.StatusOK},
+		{name: "unsigned, optional", status: fiber.StatusOK},
+		{name: "unsigned, required", required: true, status: fiber.StatusUnauthorized, code: ErrChunkUnsigned.Code},
+		{name: "one bad signature", signatures: first + "," + signChunk("other-key", "signed.bin", 3, "second"), status: fiber.StatusUnauthorized, code: ErrBadChunkSignature.Code},
+		{name: "swapped signatures", signatures: second + "," + first, status: fiber.StatusUnauthorized, code: ErrBadChunkSignature.Code},
+		{name: "signed for another file", signatures: first + "," + signChunk(testChunkKey, "other.bin", 3, "second"), status: fiber.StatusUnauthorized, code: ErrBadChunkSignature.Code},
+		{name: "too few signatures", signatures: first, status: fiber.StatusUnauthorized, code: ErrBadChunkSignature.Code},
+		{name: "not hex", signatures: first + ",zz", status: fiber.StatusUnauthorized, code: ErrBadChunkSignature.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Config{ChunkSigningKey: testChunkKey, RequireChunkSignatures: tt.required, MultipleFiles: MultipleFilesSequential})
+			app := newTestApp(h)
+			req := multipartRequest(t, map[string]string{"chunk_index": "2"}, chunks...)
+			if tt.signatures != "" {
+				req.Header.Set(ChunkSignatureHeader, tt.signatures)
+			}
+
+			status, body := send(t, app, req)
+			if status != tt.status || tt.code != "" && body["code"] != tt.code {
+				t.Fatalf("status %d: %v, want %d %s", status, body, tt.status, tt.code)
+			}
+			// Every chunk of the request is checked before any is stored
+			want := 2
+			if tt.status != fiber.StatusOK {
+				want = 0
+			}
+			if parts := partFiles(t); len(parts) != want {
+				t.Errorf("%d part files stored, want %d: %v", len(parts), want, parts)
+			}
+		})
+	}
+
+	t.Run("failing chunk reported", func(t *testing.T) {
+		h := newTestHandler(t, Config{ChunkSigningKey: testChunkKey, MultipleFiles: MultipleFilesSequential})
+		app := newTestApp(h)
+		req := multipartRequest(t, map[string]string{"chunk_index": "2"}, chunks...)
+		req.Header.Set(ChunkSignatureHeader, strings.Join([]string{first, first}, ","))
+
+		if _, body := send(t, app, req); body["chunk_index"] != float64(3) {
+			t.Errorf("chunk_index = %v, want 3: %v", body["chunk_index"], body)
+		}
+	})
+}
+
+func TestStoreChunkSignature(t *testing.T) {
+	h := newTestHandler(t, Config{ChunkSigningKey: testChunkKey})
+	store := func(signature string) error {
+		_, err := h.StoreChunk(context.Background(), domain.StoreChunkRequest{FileName: "signed.bin", ChunkIndex: 0, Data: []byte("chunk"), Signature: signature})
+		return err
+	}
+
+	if err := store(signChunk(testChunkKey, "signed.bin", 1, "chunk")); !errors.Is(err, ErrBadChunkSignature) {
+		t.Errorf("signature of another index: err = %v, want %s", err, ErrBadChunkSignature.Code)
+	}
+	if err := store(signChunk(testChunkKey, "signed.bin", 0, "chunk")); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Collision policies decide what a merge does when the output file exists.
+const (
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite = "overwrite"
+	// CollisionError rejects the merge with 409 Conflict.
+	CollisionError = "error"
+	// CollisionRename stores the new file as "name(1).ext", "name(2).ext", ...
+	CollisionRename = "rename"
+)
+
+// maxRenameAttempts bounds the search for a free numbered name.
+const maxRenameAttempts = 1000
+
+// mergeTempSuffix ends the names of the temp files replacing merges write
+// next to the stored file.
+const mergeTempSuffix = ".merge.tmp"
+
+var errFileExists = errors.New("file already exists")
+
+// caseConflictError reports a stored file whose name differs from the one
+// asked for only in case, with Config.CaseInsensitiveNames set. It counts as
+// errFileExists.
+type caseConflictError struct {
+	existing string
+}
+
+func (e *caseConflictError) Error() string {
+	return "a file differing only in case exists: " + e.existing
+}
+
+func (e *caseConflictError) Is(target error) bool {
+	return target == errFileExists
+}
+
+// fileExistsError is the 409 answering a write to fileName that failed with
+// errFileExists, naming the file in the way on a case conflict.
+func fileExistsError(fileName string, err error) *Error {
+	apiErr := ErrFileExists.With(fiber.Map{"file": fileName})
+	var conflict *caseConflictError
+	if errors.As(err, &conflict) {
+		apiErr = apiErr.WithMessage("A file differing only in case already exists").With(fiber.Map{
+			"existing_file": conflict.existing,
+		})
+	}
+	return apiErr
+}
+
+// storedNames returns the names in the directory name is stored in, keyed
+// by their lower-case form, or nil unless Config.CaseInsensitiveNames is set.
+// Names are compared this way so "Photo.jpg" and "photo.jpg" cannot both be
+// stored, whatever the host filesystem does; every spelling of a name is
+// routed to the same directory.
+func (h *ApiHandler) storedNames(name string) (map[string]string, error) {
+	if !h.cfg.CaseInsensitiveNames {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(h.fileDir(name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	names := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		names[strings.ToLower(entry.Name())] = entry.Name()
+	}
+	return names, nil
+}
+
+// caseConflict returns the stored name among names that differs from name
+// only in case, if any.
+func caseConflict(names map[string]string, name string) (string, bool) {
+	existing, ok := names[strings.ToLower(name)]
+	return existing, ok && existing != name
+}
+
+// lockFile takes the lock of the stored file name, the same for every
+// spelling of it when names are case-insensitive.
+func (h *ApiHandler) lockFile(name string) func() {
+	if h.cfg.CaseInsensitiveNames {
+		name = strings.ToLower(name)
+	}
+	return h.fileLocks.Lock(name)
+}
+
+// mergeOutput is the file a merge writes to and the name it is stored
+// under. A merge replacing a stored file writes a temp file next to it
+// instead, which commit renames over the stored one: until then the stored
+// file and downloads of it still running are untouched, and a failed merge
+// only removes its temp file.
+type mergeOutput struct {
+	*os.File
+	name string
+	// temp is set when File is a temp file for the stored file at path
+	temp bool
+	path string
+	// replacing is set once the output is known to replace a stored file,
+	// of replaced bytes: on opening for appends, on commit otherwise
+	replacing bool
+	replaced  int64
+}
+
+// writtenPath returns the path of the file being written.
+func (o *mergeOutput) writtenPath() string {
+	return o.File.Name()
+}
+
+// commit makes the written file the stored one.
+func (o *mergeOutput) commit() error {
+	if !o.temp {
+		return nil
+	}
+	if info, err := os.Lstat(o.path); err == nil {
+		o.replacing, o.replaced = true, info.Size()
+	}
+	if err := os.Rename(o.File.Name(), o.path); err != nil {
+		o.replacing, o.replaced = false, 0
+		return err
+	}
+	o.temp = false
+	return nil
+}
+
+// discard removes the written file: the temp file of a replacing merge or
+// the file whose name the merge claimed.
+func (o *mergeOutput) discard() error {
+	if err := os.Remove(o.File.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// openOutput opens the file a merge writes to, with its final name. Appends
+// and conditional (If-Match) merges always target the requested name; other
+// merges follow the configured collision policy.
+func (h *ApiHandler) openOutput(fileName string, appendMode, conditional bool) (*mergeOutput, error) {
+	names, err := h.storedNames(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := caseConflict(names, fileName); ok {
+		return nil, &caseConflictError{existing: existing}
+	}
+
+	path := h.filePath(fileName)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if appendMode {
+		info, statErr := os.Lstat(path)
+		file, err := openNoFollow(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666)
+		if err != nil {
+			return nil, err
+		}
+		output := &mergeOutput{File: file, name: fileName, path: path}
+		if statErr == nil {
+			output.replacing, output.replaced = true, info.Size()
+		}
+		return output, nil
+	}
+	if conditional || h.cfg.CollisionPolicy == CollisionOverwrite {
+		// The temp file lives in the target's directory so the rename is
+		// atomic. In the content layout the stored file is an object,
+		// possibly shared with other names, which the rename leaves alone
+		file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+mergeTempSuffix)
+		if err != nil {
+			return nil, err
+		}
+		if err := file.Chmod(0o644); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, err
+		}
+		return &mergeOutput{File: file, name: fileName, temp: true, path: path}, nil
+	}
+
+	// O_EXCL makes claiming the name atomic, so two merges can never end up
+	// writing to the same file
+	file, err := openNoFollow(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o666)
+	if err == nil {
+		return &mergeOutput{File: file, name: fileName, path: path}, nil
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+	if h.cfg.CollisionPolicy == CollisionError {
+		return nil, errFileExists
+	}
+
+	for n := 1; n <= maxRenameAttempts; n++ {
+		candidate := numberedName(fileName, n)
+		if _, ok := caseConflict(names, candidate); ok {
+			continue
+		}
+		path := h.filePath(candidate)
+		file, err := openNoFollow(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o666)
+		if err == nil {
+			return &mergeOutput{File: file, name: candidate, path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("no free name for %s after %d attempts", fileName, maxRenameAttempts)
+}
+
+// numberedName inserts "(n)" before the extension of name, or appends it when
+// the name has no extension: "photo.jpg" -> "photo(1).jpg", "README" -> "README(1)".
+func numberedName(name string, n int) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// Dotfiles such as ".env" have no extension, only a name
+		base, ext = name, ""
+	}
+
+	return fmt.Sprintf("%s(%d)%s", base, n, ext)
+}
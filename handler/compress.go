@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// compressor compresses a finished response with brotli, gzip or deflate,
+// whichever the request's Accept-Encoding prefers. Responses that are not
+// text-like (e.g. MessagePack) are left alone by fasthttp itself.
+var compressor = fasthttp.CompressHandlerBrotliLevel(func(*fasthttp.RequestCtx) {},
+	fasthttp.CompressBrotliDefaultCompression,
+	fasthttp.CompressDefaultCompression,
+)
+
+// compress compresses the response of c when its body reaches the configured
+// threshold. Most answers of this API are tiny status objects for which
+// compression costs more CPU than it saves bytes, sometimes even growing
+// them. Streamed bodies (downloads, progress lines) have no size up front
+// and are sent as they are.
+func (h *ApiHandler) compress(c *fiber.Ctx) {
+	if h.cfg.CompressThreshold < 0 {
+		return
+	}
+	resp := c.Response()
+	if resp.IsBodyStream() || len(resp.Body()) < h.cfg.CompressThreshold {
+		return
+	}
+
+	compressor(c.Context())
+}
@@ -0,0 +1,358 @@
+package handler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mohammadanang/uploads-api/domain"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Config holds the tunable settings of the API handler. Zero values fall back
+// to the defaults applied by NewAPIHandler.
+type Config struct {
+	// WebhookURL receives a POST after every merge, successful or not.
+	// Leave it empty to disable webhook notifications.
+	WebhookURL string
+	// WebhookSecret is used to sign the webhook payload with HMAC-SHA256 so
+	// the receiver can verify it came from this server.
+	WebhookSecret string
+	// WebhookTimeout bounds a single delivery attempt.
+	WebhookTimeout time.Duration
+	// WebhookRetries is the number of extra attempts made after a failed delivery.
+	WebhookRetries int
+
+	// AuditSink receives an event for every chunk received and every merge.
+	// Defaults to a FileAuditSink writing to AuditLogPath.
+	AuditSink AuditSink
+	// AuditLogPath is the JSON lines file used by the default audit sink.
+	AuditLogPath string
+
+	// CollisionPolicy decides what happens when a merge targets an existing
+	// file: CollisionOverwrite (default), CollisionError or CollisionRename.
+	CollisionPolicy string
+	// CaseInsensitiveNames treats stored names differing only in case as the
+	// same file, as macOS and Windows filesystems do, whatever the host's
+	// filesystem: writing "photo.jpg" next to "Photo.jpg" is refused with
+	// 409. Off by default.
+	CaseInsensitiveNames bool
+
+	// ExtensionPolicy decides how names with several extensions are stored:
+	// ExtensionKeep (default), ExtensionStrip or ExtensionNeutralize.
+	ExtensionPolicy string
+	// NameTransformer, when set, rewrites the name of every file about to be
+	// stored, before the extension policy, to enforce a naming convention
+	// such as lowercasing or a date prefix. The result must still be a plain
+	// file name. Stored files record the name the client sent as their
+	// original_name. NameTransforms builds one from the built-in transforms.
+	NameTransformer func(original string) string
+
+	// FileOwner, when set, is the owner and group merged files are given, so
+	// another process on the server can read them. Unix only; failures are
+	// logged and reported as merge warnings, not errors.
+	FileOwner *FileOwner
+
+	// StorageLayout decides how stored files are laid out on disk:
+	// StorageLayoutNames (default) keeps each under its name, and
+	// StorageLayoutContent keeps each distinct content once in ObjectDir,
+	// under its SHA-256, with the names as hard links to it. Appends are not
+	// available in the content layout.
+	StorageLayout string
+	// StorageRoutes stores files by extension in other directories than
+	// UploadDir, e.g. {".jpg": "/mnt/images", ".pdf": "/mnt/documents"}, for
+	// tiered storage; their sidecars go along. Extensions are matched in
+	// lower case. Files with other extensions stay in UploadDir.
+	StorageRoutes map[string]string
+
+	// DuplicateChunks decides what happens to a chunk arriving while the same
+	// chunk of the upload is still being written: DuplicateChunksWrite
+	// (default) writes both, DuplicateChunksReject answers 409 and
+	// DuplicateChunksWait answers with the first write's result.
+	DuplicateChunks string
+	// PreallocateMerges reserves the disk space of a merged file, the sum of
+	// its chunk sizes, before writing it, where the filesystem supports it:
+	// less fragmentation for big files, and a full disk is detected before
+	// anything is written.
+	PreallocateMerges bool
+	// IdempotentChunks answers the upload of a chunk already stored with the
+	// SHA-256 the client sends in "checksum" without writing it again, so
+	// retries of chunks that did arrive cost no disk I/O.
+	IdempotentChunks bool
+
+	// MultipleFiles decides what happens to a chunk upload with several files
+	// in its "file" field: MultipleFilesReject (default) answers 400,
+	// MultipleFilesSequential stores them as consecutive chunks.
+	MultipleFiles string
+
+	// AllowedContentTypes lists the content types uploads may declare, for
+	// the AllowContentTypes middleware and GET /capabilities. Empty allows
+	// every type.
+	AllowedContentTypes []string
+
+	// HashAlgorithms lists the digests computed for every stored file in
+	// the same pass that writes it: HashMD5, HashSHA1, HashSHA256 and
+	// HashSHA512. SHA-256 is always included as it backs checksums and ETags.
+	HashAlgorithms []string
+
+	// BufferSize is the size of the pooled buffers used to copy chunks and
+	// files. Defaults to 1 MB.
+	BufferSize int
+
+	// MaxChunkSize is the largest chunk UploadFile accepts, in bytes. Larger
+	// chunks are rejected with 413. Zero leaves only the server's body limit.
+	MaxChunkSize int64
+
+	// ChunkSize is the chunk size POST /upload/init tells clients to split
+	// files into. Chunks of a session must not exceed it and all but the last
+	// must match it exactly. Defaults to 2 MB, capped at MaxChunkSize.
+	ChunkSize int64
+	// MultipartMemory is how many bytes of a multipart chunk upload's file
+	// content are held in memory while the form is parsed; the rest spills to
+	// a temporary file. Zero keeps fasthttp's parser and its fixed 16 MB
+	// threshold; a positive value makes the server stream request bodies and
+	// parse forms with StreamedBody.
+	MultipartMemory int64
+
+	// MaxDecompressedSize caps, in bytes, what a request body sent with a
+	// Content-Encoding, or a chunk sent with a Chunk-Encoding, may decompress
+	// to; larger ones are refused with 413. Zero uses the server's body limit
+	// for bodies and leaves chunks to MaxChunkSize.
+	MaxDecompressedSize int64
+	// MaxCompressionRatio caps how many times its compressed size a request
+	// body or chunk may decompress to, against zip bombs below
+	// MaxDecompressedSize. Zero disables the ratio check.
+	MaxCompressionRatio int
+
+	// MaxTempSize caps the total size of the temp directory in bytes. Chunks
+	// that would exceed it are refused with 507. Zero disables the cap.
+	MaxTempSize int64
+	// MaxActiveUploads caps the distinct uploads with chunks in the temp
+	// directory. The first chunk of another upload is refused with 503 until
+	// one is merged, aborted or swept. Zero disables the cap.
+	MaxActiveUploads int
+	// MaxRangeUploadSize caps the total size a range upload may announce in
+	// its Content-Range, in bytes; larger ones are refused with 413. Zero
+	// leaves only MaxTempSize.
+	MaxRangeUploadSize int64
+
+	// MaxConcurrentMerges bounds the merges running at the same time across
+	// all files. Merges above the limit are refused with 503. Defaults to 4.
+	MaxConcurrentMerges int
+
+	// MaxOpenChunks bounds the chunk files open at the same time across all
+	// merges, for hosts with a low file descriptor limit. Defaults to 64.
+	MaxOpenChunks int
+	// MergeReadAhead bounds the chunks a merge holds in memory: read, but not
+	// yet written to the output. More keeps a fast disk busy, fewer keeps
+	// memory flat when the disk is slow. Defaults to 8.
+	MergeReadAhead int
+	// MergeRetries is how often a merge retries reading or writing a chunk
+	// that failed, for storage with transient errors, before the merge fails.
+	// Defaults to 2; a negative value disables retries.
+	MergeRetries int
+	// MergeRetryBackoff is the wait before the first retry of a chunk,
+	// doubled for each further one. Defaults to 100 milliseconds.
+	MergeRetryBackoff time.Duration
+
+	// ChunkBase is the index of the first chunk: 0 (default) or 1 for client
+	// libraries that count from one. Uploads below it are rejected.
+	ChunkBase int
+
+	// ChunkRetention is how long chunks may sit in the temp directory, e.g.
+	// when retained after a merge or abandoned by a client, before the
+	// sweeper removes them. Range uploads idle for as long are abandoned
+	// too. Zero disables the sweeper.
+	ChunkRetention time.Duration
+
+	// MultipartStorage, when set, receives every chunk as a part of a
+	// multipart upload and merges complete that upload, keeping chunks off
+	// the local disk. Nil keeps the local temp directory (default).
+	MultipartStorage MultipartStorage
+
+	// MirrorStorage receives a copy of every merged file, written from the
+	// same stream as the local file. Nil disables mirroring.
+	MirrorStorage Storage
+	// MirrorBestEffort keeps a merge successful when only the mirror fails;
+	// by default a mirror failure fails the merge.
+	MirrorBestEffort bool
+
+	// IDGenerator issues the IDs of upload sessions. Defaults to UUIDGenerator;
+	// swap in ULIDs for sortable IDs or a deterministic generator in tests.
+	IDGenerator IDGenerator
+	// RequireUploadID rejects chunk uploads and merges that do not name an
+	// upload session, so every upload's chunks are namespaced by its ID.
+	RequireUploadID bool
+
+	// MergeLog writes a ".merge.json" sidecar after every merge recording
+	// the chunk sizes, duration and hash, shown by GET /files/:file_name.
+	// Off by default to save the extra write.
+	MergeLog bool
+	// MergeReportTTL is how long the report of a merge stays available from
+	// GET /merge-report/:file_name. Defaults to 24 hours; a negative value
+	// keeps no reports.
+	MergeReportTTL time.Duration
+
+	// MaintenanceMode starts the server in maintenance mode, which
+	// POST /maintenance toggles at runtime: the endpoints that write answer
+	// 503 while reads and downloads are still served.
+	MaintenanceMode bool
+	// MaintenanceRetryAfter is the Retry-After sent with those 503s unless
+	// the toggle names another. Defaults to 60 seconds.
+	MaintenanceRetryAfter time.Duration
+
+	// CompressThreshold is the smallest response body, in bytes, that is
+	// compressed for clients accepting it. Defaults to 1 KB; a negative value
+	// disables compression.
+	CompressThreshold int
+	// GzipDownloads gzip encodes whole-file downloads of compressible types
+	// on the fly for clients accepting it. Off by default: the compressed
+	// response has no Content-Length and cannot be resumed with ranges.
+	GzipDownloads bool
+	// DownloadSigningKey signs the download URLs of POST /download/sign with
+	// HMAC-SHA256. When set, downloads need an API key or a valid signed URL;
+	// when empty, downloads stay public and signing is unavailable.
+	DownloadSigningKey string
+	// ChunkSigningKey is the secret chunks are signed with in the
+	// X-Chunk-Signature header, an HMAC-SHA256 over file name, index and
+	// content. When set, signed chunks that do not verify are rejected with
+	// 401 before they are stored; when empty, signatures are ignored.
+	ChunkSigningKey string
+	// RequireChunkSignatures also rejects chunks sent without a signature.
+	// Only meaningful with a ChunkSigningKey.
+	RequireChunkSignatures bool
+
+	// HideErrorDetails keeps internal error strings, which may contain
+	// filesystem paths, out of responses. They are logged with an error ID
+	// that the response carries instead. Off by default for local development.
+	HideErrorDetails bool
+
+	// Publisher receives an event for every stored file so downstream
+	// workers can post-process it. Defaults to NopPublisher.
+	Publisher Publisher
+
+	// TracerProvider creates the spans of chunk uploads and merges, one
+	// child span per chunk read and written. Defaults to a no-op provider.
+	TracerProvider trace.TracerProvider
+
+	// MergeRecorder persists completed merges for GET /uploads/recent.
+	// Nil disables the history.
+	MergeRecorder MergeRecorder
+
+	// OnMergeComplete, when set, is called after every successful merge,
+	// before the response is sent, so an application embedding the handler
+	// can react to stored files without a webhook. It runs on the request's
+	// goroutine while the file is locked, so a slow callback should hand its
+	// work off. A panic in it is logged and does not fail the merge.
+	OnMergeComplete func(domain.MergeCompletion)
+}
+
+// Validate reports the first setting with a value the handler does not know.
+// Empty settings are valid and take their defaults. Call it at startup: the
+// handler treats an unknown value as none of the choices it lists.
+func (cfg Config) Validate() error {
+	settings := []struct {
+		name, value string
+		allowed     []string
+	}{
+		{"CollisionPolicy", cfg.CollisionPolicy, []string{CollisionOverwrite, CollisionError, CollisionRename}},
+		{"ExtensionPolicy", cfg.ExtensionPolicy, []string{ExtensionKeep, ExtensionStrip, ExtensionNeutralize}},
+		{"StorageLayout", cfg.StorageLayout, []string{StorageLayoutNames, StorageLayoutContent}},
+		{"DuplicateChunks", cfg.DuplicateChunks, []string{DuplicateChunksWrite, DuplicateChunksReject, DuplicateChunksWait}},
+		{"MultipleFiles", cfg.MultipleFiles, []string{MultipleFilesReject, MultipleFilesSequential}},
+	}
+	for _, setting := range settings {
+		if setting.value != "" && !slices.Contains(setting.allowed, setting.value) {
+			return fmt.Errorf("invalid %s %q, want one of %s", setting.name, setting.value, strings.Join(setting.allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// withDefaults returns a copy of cfg with unset fields filled in.
+func (cfg Config) withDefaults() Config {
+	if cfg.WebhookTimeout <= 0 {
+		cfg.WebhookTimeout = 5 * time.Second
+	}
+	if cfg.WebhookRetries < 0 {
+		cfg.WebhookRetries = 0
+	}
+	if cfg.AuditLogPath == "" {
+		cfg.AuditLogPath = "./audit.log"
+	}
+	if cfg.MergeReportTTL == 0 {
+		cfg.MergeReportTTL = 24 * time.Hour
+	}
+	if cfg.MaintenanceRetryAfter <= 0 {
+		cfg.MaintenanceRetryAfter = time.Minute
+	}
+	cfg.HashAlgorithms = normalizeHashAlgorithms(cfg.HashAlgorithms)
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1 * 1024 * 1024
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 2 * 1024 * 1024
+	}
+	if cfg.MaxChunkSize > 0 && cfg.ChunkSize > cfg.MaxChunkSize {
+		cfg.ChunkSize = cfg.MaxChunkSize
+	}
+	if cfg.MaxConcurrentMerges <= 0 {
+		cfg.MaxConcurrentMerges = 4
+	}
+	if cfg.MaxOpenChunks <= 0 {
+		cfg.MaxOpenChunks = 64
+	}
+	if cfg.MergeReadAhead <= 0 {
+		cfg.MergeReadAhead = 8
+	}
+	if cfg.MergeRetries == 0 {
+		cfg.MergeRetries = 2
+	}
+	if cfg.MergeRetryBackoff <= 0 {
+		cfg.MergeRetryBackoff = 100 * time.Millisecond
+	}
+	if cfg.ChunkBase != 1 {
+		cfg.ChunkBase = 0
+	}
+	if cfg.CompressThreshold == 0 {
+		cfg.CompressThreshold = 1024
+	}
+	if cfg.ExtensionPolicy == "" {
+		cfg.ExtensionPolicy = ExtensionKeep
+	}
+	if cfg.StorageLayout == "" {
+		cfg.StorageLayout = StorageLayoutNames
+	}
+	if len(cfg.StorageRoutes) > 0 {
+		routes := make(map[string]string, len(cfg.StorageRoutes))
+		for ext, dir := range cfg.StorageRoutes {
+			routes[routeExtension(ext)] = dir
+		}
+		cfg.StorageRoutes = routes
+	}
+	if cfg.DuplicateChunks == "" {
+		cfg.DuplicateChunks = DuplicateChunksWrite
+	}
+	if cfg.MultipleFiles == "" {
+		cfg.MultipleFiles = MultipleFilesReject
+	}
+	if cfg.CollisionPolicy == "" {
+		cfg.CollisionPolicy = CollisionOverwrite
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = UUIDGenerator{}
+	}
+	if cfg.Publisher == nil {
+		cfg.Publisher = NopPublisher{}
+	}
+	if cfg.TracerProvider == nil {
+		cfg.TracerProvider = noop.NewTracerProvider()
+	}
+	if cfg.AuditSink == nil {
+		cfg.AuditSink = NewFileAuditSink(cfg.AuditLogPath)
+	}
+
+	return cfg
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "defaults"},
+		{name: "known values", cfg: Config{CollisionPolicy: CollisionRename, ExtensionPolicy: ExtensionStrip, StorageLayout: StorageLayoutContent, DuplicateChunks: DuplicateChunksWait, MultipleFiles: MultipleFilesSequential}},
+		{name: "collision policy", cfg: Config{CollisionPolicy: "replace"}, want: "CollisionPolicy \"replace\", want one of overwrite, error, rename"},
+		{name: "extension policy", cfg: Config{ExtensionPolicy: "drop"}, want: "ExtensionPolicy \"drop\", want one of keep, strip, neutralize"},
+		{name: "storage layout", cfg: Config{StorageLayout: "hashed"}, want: "StorageLayout \"hashed\", want one of names, content"},
+		{name: "duplicate chunks", cfg: Config{DuplicateChunks: "skip"}, want: "DuplicateChunks \"skip\", want one of write, reject, wait"},
+		{name: "multiple files", cfg: Config{MultipleFiles: "Sequential"}, want: "MultipleFiles \"Sequential\", want one of reject, sequential"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one naming %s", err, tt.want)
+			}
+		})
+	}
+}
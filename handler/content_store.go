@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Storage layouts selectable in Config.StorageLayout.
+const (
+	// StorageLayoutNames stores every file under its name in UploadDir.
+	StorageLayoutNames = "names"
+	// StorageLayoutContent stores every distinct content once in ObjectDir,
+	// under its SHA-256 checksum; the names in UploadDir are hard links to
+	// their object.
+	StorageLayoutContent = "content"
+)
+
+// ObjectDir holds the objects of the content layout, fanned out over two
+// levels of directories named after the first bytes of the checksum.
+const ObjectDir = "./objects"
+
+// objectPath returns the path of the object with the hex encoded SHA-256
+// checksum: "abcdef..." is stored as ObjectDir/ab/cd/abcdef...
+func objectPath(checksum string) string {
+	return filepath.Join(ObjectDir, checksum[:2], checksum[2:4], checksum)
+}
+
+// validChecksum reports whether checksum is a lower-case hex encoded
+// SHA-256, and so safe to join to ObjectDir.
+func validChecksum(checksum string) bool {
+	if len(checksum) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(checksum)
+	return err == nil && strings.ToLower(checksum) == checksum
+}
+
+// storeObject files the freshly stored file at path under its checksum in
+// the content layout and does nothing in the name layout. New content becomes
+// an object by hard linking it, so path and the object are the same file.
+// Content already stored is kept once: path is replaced by a link to the
+// existing object, atomically, so the name never goes missing.
+func (h *ApiHandler) storeObject(path, checksum string) error {
+	if h.cfg.StorageLayout != StorageLayoutContent {
+		return nil
+	}
+
+	object := objectPath(checksum)
+	if err := os.MkdirAll(filepath.Dir(object), os.ModePerm); err != nil {
+		return err
+	}
+	err := os.Link(path, object)
+	if !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if err := refuseSymlink(object); err != nil {
+		return err
+	}
+
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	link := path + "." + hex.EncodeToString(b[:]) + ".tmp"
+	if err := os.Link(object, link); err != nil {
+		return err
+	}
+	if err := os.Rename(link, path); err != nil {
+		os.Remove(link)
+		return err
+	}
+	return nil
+}
+
+// DownloadObject handles GET and HEAD /objects/:checksum in the content
+// layout, sending the content with that SHA-256 checksum whatever names it
+// is stored under, even none. One-time files are never stored as objects, so
+// they cannot be fetched here. Objects never change, so the checksum is the
+// ETag and a single byte range in the Range header is always honoured.
+func (h *ApiHandler) DownloadObject(c *fiber.Ctx) error {
+	if h.cfg.StorageLayout != StorageLayoutContent {
+		return RespondError(c, ErrNotImplemented.WithMessage("Content-addressed storage is not enabled"))
+	}
+	checksum := strings.ToLower(c.Params("checksum"))
+	if !validChecksum(checksum) {
+		return RespondError(c, ErrInvalidRequest.WithMessage("checksum must be a hex encoded SHA-256"))
+	}
+
+	file, err := os.Open(objectPath(checksum))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return RespondError(c, ErrNotFound.WithMessage("Object not found").With(fiber.Map{
+				"checksum": checksum,
+			}))
+		}
+		return RespondError(c, ErrInternal.WithMessage("Failed to open object").Wrap(err))
+	}
+	// Ownership moves to the response stream once the body is sent
+	sending := false
+	defer func() {
+		if !sending {
+			file.Close()
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read object").Wrap(err))
+	}
+	size := info.Size()
+
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderETag, formatETag(checksum))
+	c.Set(fiber.HeaderLastModified, info.ModTime().UTC().Format(http.TimeFormat))
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+
+	start, end := int64(0), size
+	status := fiber.StatusOK
+	if header := c.Get(fiber.HeaderRange); header != "" {
+		r, ok, err := parseRange(header, size)
+		if err != nil {
+			c.Set(fiber.HeaderContentRange, "bytes */"+strconv.FormatInt(size, 10))
+			return RespondError(c, ErrRangeNotSatisfied.Wrap(err).With(fiber.Map{
+				"size": size,
+			}))
+		}
+		if ok {
+			start, end = r.Start, r.End
+			status = fiber.StatusPartialContent
+			c.Set(fiber.HeaderContentRange, "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end-1, 10)+"/"+strconv.FormatInt(size, 10))
+		}
+	}
+
+	c.Status(status)
+	if c.Method() == fiber.MethodHead {
+		c.Response().Header.SetContentLength(int(end - start))
+		c.Response().SkipBody = true
+		return nil
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read object").Wrap(err))
+	}
+
+	sending = true
+	return c.SendStream(readCloser{io.LimitReader(file, end-start), file}, int(end-start))
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mergeContent stores data as fileName, uploaded as a single chunk.
+func mergeContent(t *testing.T, app *fiber.App, fileName, data string) {
+	t.Helper()
+	if status, body := uploadChunk(t, app, fileName, 0, []byte(data)); status != fiber.StatusOK {
+		t.Fatalf("upload of %s: status %d: %v", fileName, status, body)
+	}
+	if status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": fileName, "total_chunks": 1}); status != fiber.StatusOK {
+		t.Fatalf("merge of %s: status %d: %v", fileName, status, body)
+	}
+}
+
+// objects returns the paths of the objects in ObjectDir.
+func objects(t *testing.T) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(ObjectDir, "*", "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+// sameFile reports whether the paths are links to one file.
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+	infoA, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+func TestContentLayoutDeduplicates(t *testing.T) {
+	h := newTestHandler(t, Config{StorageLayout: StorageLayoutContent})
+	app := newTestApp(h)
+	app.Get("/objects/:checksum", h.DownloadObject)
+	mergeContent(t, app, "a.txt", "shared")
+	mergeContent(t, app, "b.txt", "shared")
+
+	object := objectPath(checksumOf("shared"))
+	if paths := objects(t); len(paths) != 1 || paths[0] != object {
+		t.Fatalf("objects = %v, want only %s", paths, object)
+	}
+	for _, fileName := range []string{"a.txt", "b.txt"} {
+		if !sameFile(t, h.filePath(fileName), object) {
+			t.Errorf("%s is not a link to the object", fileName)
+		}
+	}
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/objects/"+checksumOf("shared"), nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK || resp.ContentLength != int64(len("shared")) {
+		t.Errorf("object download: status %d with %d bytes, want 200 with %d", resp.StatusCode, resp.ContentLength, len("shared"))
+	}
+}
+
+func TestContentLayoutOverwriteKeepsSharedContent(t *testing.T) {
+	h := newTestHandler(t, Config{StorageLayout: StorageLayoutContent, CollisionPolicy: CollisionOverwrite})
+	app := newTestApp(h)
+	mergeContent(t, app, "a.txt", "shared")
+	mergeContent(t, app, "b.txt", "shared")
+
+	// Replacing one name must not write through the link into the content
+	// the other name and the object still hold
+	mergeContent(t, app, "a.txt", "changed")
+
+	for path, want := range map[string]string{
+		h.filePath("a.txt"):               "changed",
+		h.filePath("b.txt"):               "shared",
+		objectPath(checksumOf("shared")):  "shared",
+		objectPath(checksumOf("changed")): "changed",
+	} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Errorf("%s holds %q, %v, want %q", path, data, err, want)
+		}
+	}
+	if !sameFile(t, h.filePath("a.txt"), objectPath(checksumOf("changed"))) {
+		t.Error("replaced name is not a link to its new object")
+	}
+	if !sameFile(t, h.filePath("b.txt"), objectPath(checksumOf("shared"))) {
+		t.Error("other name no longer links to the shared object")
+	}
+}
+
+func TestContentLayoutRefusesAppend(t *testing.T) {
+	h := newTestHandler(t, Config{StorageLayout: StorageLayoutContent})
+	app := newTestApp(h)
+	mergeContent(t, app, "a.txt", "shared")
+	mergeContent(t, app, "b.txt", "shared")
+	if status, body := uploadChunk(t, app, "a.txt", 0, []byte("more")); status != fiber.StatusOK {
+		t.Fatalf("upload: status %d: %v", status, body)
+	}
+
+	status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "a.txt", "total_chunks": 1, "append": true})
+	if status != fiber.StatusBadRequest || body["code"] != ErrInvalidRequest.Code {
+		t.Fatalf("append in the content layout: status %d: %v, want 400 %s", status, body, ErrInvalidRequest.Code)
+	}
+	if data, err := os.ReadFile(h.filePath("b.txt")); err != nil || string(data) != "shared" {
+		t.Errorf("b.txt holds %q, %v after the refused append, want %q", data, err, "shared")
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AllowContentTypes returns a middleware that rejects uploads whose declared
+// content type is not in allowed with 415, before the handler stores
+// anything. For multipart chunk uploads the declared type is the Content-Type
+// of every "file" part, for raw bodies that of the request; a missing one
+// counts as application/octet-stream. Entries match exactly or, like
+// "image/*", by their top-level type. With no types configured every upload
+// is let through.
+//
+// This only checks what the client claims, it does not sniff the content.
+func AllowContentTypes(allowed []string) fiber.Handler {
+	if len(allowed) == 0 {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	patterns := make([]string, len(allowed))
+	for i, pattern := range allowed {
+		patterns[i] = strings.ToLower(pattern)
+	}
+
+	return func(c *fiber.Ctx) error {
+		declared := []string{string(c.Request().Header.ContentType())}
+		if strings.HasPrefix(declared[0], fiber.MIMEMultipartForm) {
+			// The parsed form is cached, so the handler does not parse it again
+			form, err := multipartForm(c)
+			if err != nil {
+				return c.Next() // The handler reports the malformed form
+			}
+			declared = declared[:0]
+			for _, file := range form.File["file"] {
+				declared = append(declared, file.Header.Get(fiber.HeaderContentType))
+			}
+		}
+
+		for _, contentType := range declared {
+			mediaType := "application/octet-stream"
+			if contentType != "" {
+				parsed, _, err := mime.ParseMediaType(contentType)
+				if err != nil {
+					return contentTypeNotAllowed(c, contentType)
+				}
+				mediaType = parsed
+			}
+			if !typeAllowed(patterns, mediaType) {
+				return contentTypeNotAllowed(c, mediaType)
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// typeAllowed reports whether mediaType matches one of patterns.
+func typeAllowed(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func contentTypeNotAllowed(c *fiber.Ctx, contentType string) error {
+	return RespondError(c, ErrUnsupportedType.With(fiber.Map{
+		"content_type": contentType,
+	}))
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime/multipart"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v2"
+)
+
+// LimitDecompression returns a middleware decoding request bodies sent with
+// a Content-Encoding of gzip, deflate or br. fiber and fasthttp would decode
+// them in full, in memory, however far they expand, so a small body of
+// zeros could take the server's memory. Here a body may decompress to at
+// most maxSize bytes and, with a positive maxRatio, to at most maxRatio times
+// its compressed size; beyond either limit the request is answered with 413
+// before anything is stored.
+//
+// The decoded body replaces the compressed one and Content-Encoding is
+// removed, so handlers see a plain request. With a positive maxMemory,
+// multipart forms are parsed from the decoded stream like StreamedBody does,
+// spilling file content beyond maxMemory bytes to temporary files. Bodies in
+// other encodings are left alone.
+func LimitDecompression(maxSize int64, maxRatio int, maxMemory int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		encodings := contentEncodings(c.Get(fiber.HeaderContentEncoding))
+		if len(encodings) == 0 || !decodable(encodings) {
+			return c.Next()
+		}
+
+		compressed := c.Request().Body()
+		limit := maxSize
+		if maxRatio > 0 {
+			limit = min(limit, int64(len(compressed))*int64(maxRatio))
+		}
+		tooLarge := ErrDecompressionLimit.With(fiber.Map{
+			"max_decompressed_size": maxSize,
+			"max_compression_ratio": maxRatio,
+		})
+
+		// Encodings are listed in the order they were applied, so they are
+		// undone from the last
+		var r io.Reader = bytes.NewReader(compressed)
+		for i := len(encodings) - 1; i >= 0; i-- {
+			decoder, err := decodeReader(encodings[i], r)
+			if err != nil {
+				return RespondError(c, ErrInvalidRequest.WithMessage("Malformed compressed body").Wrap(err))
+			}
+			r = decoder
+		}
+		body := &limitedReader{r: r, n: limit}
+
+		boundary := string(c.Request().Header.MultipartFormBoundary())
+		if boundary != "" && maxMemory > 0 {
+			form, err := multipart.NewReader(body, boundary).ReadForm(maxMemory)
+			if errors.Is(err, errBodyTooLarge) {
+				return RespondError(c, tooLarge)
+			}
+			if err != nil {
+				return RespondError(c, ErrInvalidRequest.WithMessage("Malformed multipart form").Wrap(err))
+			}
+			c.Locals(multipartFormKey, streamedForm{form})
+		} else {
+			data, err := io.ReadAll(body)
+			if errors.Is(err, errBodyTooLarge) {
+				return RespondError(c, tooLarge)
+			}
+			if err != nil {
+				return RespondError(c, ErrInvalidRequest.WithMessage("Malformed compressed body").Wrap(err))
+			}
+			c.Request().SetBody(data)
+		}
+		c.Request().Header.Del(fiber.HeaderContentEncoding)
+
+		return c.Next()
+	}
+}
+
+// contentEncodings splits a Content-Encoding header into its lower-case
+// codings, leaving out "identity".
+func contentEncodings(header string) []string {
+	var encodings []string
+	for _, encoding := range strings.Split(header, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" && encoding != "identity" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings
+}
+
+// decodable reports whether decodeReader knows every one of encodings.
+func decodable(encodings []string) bool {
+	for _, encoding := range encodings {
+		switch encoding {
+		case "gzip", "deflate", "br":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// decodeReader returns a reader decoding r from encoding. "deflate" is the
+// zlib format, as HTTP defines it.
+func decodeReader(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	default:
+		return brotli.NewReader(r), nil
+	}
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// gzipped returns data compressed with gzip.
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// compressBody replaces the body of req with its gzip compression, sent with
+// a Content-Encoding of gzip.
+func compressBody(t *testing.T, req *http.Request) {
+	t.Helper()
+	plain, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := gzipped(t, plain)
+	req.Body = io.NopCloser(bytes.NewReader(compressed))
+	req.ContentLength = int64(len(compressed))
+	req.Header.Set(fiber.HeaderContentEncoding, "gzip")
+}
+
+func TestLimitDecompression(t *testing.T) {
+	// A megabyte of zeros compresses to about a kilobyte
+	const size = 1024 * 1024
+	tests := []struct {
+		name     string
+		maxSize  int64
+		maxRatio int
+		// rejected is set when the decoded body is over a limit
+		rejected bool
+	}{
+		{name: "within limits", maxSize: 2 * size},
+		{name: "size", maxSize: size / 2, rejected: true},
+		{name: "ratio", maxSize: 2 * size, maxRatio: 100, rejected: true},
+	}
+	for _, tt := range tests {
+		// Without a memory limit the body is decoded into memory, with one
+		// the form is parsed from the decoded stream
+		for mode, maxMemory := range map[string]int64{"buffered": 0, "streamed": 64 * 1024} {
+			t.Run(tt.name+"/"+mode, func(t *testing.T) {
+				h := newTestHandler(t, Config{})
+				app := fiber.New()
+				app.Post("/upload-file", LimitDecompression(tt.maxSize, tt.maxRatio, maxMemory), Recover(h.UploadFile))
+
+				req := multipartRequest(t, map[string]string{"chunk_index": "0"}, testFile{name: "zeros.bin", data: make([]byte, size)})
+				compressBody(t, req)
+
+				status, body := send(t, app, req)
+				if !tt.rejected {
+					if status != fiber.StatusOK {
+						t.Fatalf("status %d: %v, want 200", status, body)
+					}
+					parts := partFiles(t)
+					if len(parts) != 1 {
+						t.Fatalf("part files = %v, want one", parts)
+					}
+					if info, err := os.Stat(parts[0]); err != nil || info.Size() != size {
+						t.Errorf("stored chunk: %v, %v, want the %d decoded bytes", info, err, size)
+					}
+					return
+				}
+
+				if status != fiber.StatusRequestEntityTooLarge || body["code"] != ErrDecompressionLimit.Code {
+					t.Fatalf("status %d: %v, want 413 %s", status, body, ErrDecompressionLimit.Code)
+				}
+				if body["max_decompressed_size"] != float64(tt.maxSize) || body["max_compression_ratio"] != float64(tt.maxRatio) {
+					t.Errorf("limits in the response = %v and %v, want %d and %d", body["max_decompressed_size"], body["max_compression_ratio"], tt.maxSize, tt.maxRatio)
+				}
+				if parts := partFiles(t); len(parts) != 0 {
+					t.Errorf("part files stored for a rejected body: %v", parts)
+				}
+			})
+		}
+	}
+}
+
+func TestUploadFileChunkEncodingTooLarge(t *testing.T) {
+	const size = 1024 * 1024
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "size", cfg: Config{MaxDecompressedSize: size / 2}},
+		{name: "ratio", cfg: Config{MaxCompressionRatio: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.cfg)
+			app := newTestApp(h)
+
+			// Only the chunk's content is compressed, the form around it is plain
+			req := multipartRequest(t, map[string]string{"chunk_index": "0"}, testFile{name: "zeros.bin", data: gzipped(t, make([]byte, size))})
+			req.Header.Set(ChunkEncodingHeader, "gzip")
+
+			status, body := send(t, app, req)
+			if status != fiber.StatusRequestEntityTooLarge || body["code"] != ErrDecompressionLimit.Code {
+				t.Fatalf("status %d: %v, want 413 %s", status, body, ErrDecompressionLimit.Code)
+			}
+			if parts := partFiles(t); len(parts) != 0 {
+				t.Errorf("part files stored for a rejected chunk: %v", parts)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// maxDeleteBatch bounds the number of files removed by a single request.
+const maxDeleteBatch = 1000
+
+// deleteResult is the outcome of removing one file of a batch.
+type deleteResult struct {
+	File    string `json:"file"`
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DeleteFiles handles POST /files/delete, removing the listed merged files and
+// their metadata sidecars. Every name is processed independently and the
+// response reports the outcome per file, so one bad entry does not stop the
+// rest of the batch.
+func (h *ApiHandler) DeleteFiles(c *fiber.Ctx) error {
+	if err := h.checkMaintenance(c); err != nil {
+		return RespondError(c, err)
+	}
+
+	body := new(domain.DeleteFilesRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+	if len(body.FileNames) == 0 || len(body.FileNames) > maxDeleteBatch {
+		return RespondError(c, ErrInvalidRequest.WithMessage(fmt.Sprintf("file_names must list between 1 and %d files", maxDeleteBatch)))
+	}
+
+	results := make([]deleteResult, 0, len(body.FileNames))
+	deleted := 0
+	for _, fileName := range body.FileNames {
+		result := deleteResult{File: fileName}
+		if err := h.deleteFile(fileName); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Deleted = true
+			deleted++
+
+			h.audit(domain.AuditEvent{
+				Time:     time.Now(),
+				Action:   domain.AuditDelete,
+				FileName: fileName,
+				Client:   clientIdentity(c),
+				Status:   domain.MergeStatusSuccess,
+			})
+		}
+		results = append(results, result)
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":   false,
+		"message": fmt.Sprintf("Deleted %d of %d files", deleted, len(results)),
+		"deleted": deleted,
+		"failed":  len(results) - deleted,
+		"results": results,
+	})
+}
+
+// deleteFile removes a merged file and its sidecar while holding the file's
+// lock, so it cannot interleave with a merge writing the same file.
+func (h *ApiHandler) deleteFile(fileName string) error {
+	if !validFileName(fileName) {
+		return fmt.Errorf("invalid file name")
+	}
+
+	unlock := h.lockFile(fileName)
+	defer unlock()
+
+	if err := os.Remove(h.filePath(fileName)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file not found")
+		}
+		// The per-file report is shown to clients, so paths stay in the log
+		log.Printf("failed to delete %s: %v", fileName, err)
+		return fmt.Errorf("failed to delete file")
+	}
+	if err := os.Remove(h.metadataPath(fileName)); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to delete metadata of %s: %v", fileName, err)
+		return fmt.Errorf("file deleted but its metadata was not")
+	}
+	if err := os.Remove(h.mergeLogPath(fileName)); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to delete merge log of %s: %v", fileName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Hash algorithms selectable in Config.HashAlgorithms.
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+var hashConstructors = map[string]func() hash.Hash{
+	HashMD5:    md5.New,
+	HashSHA1:   sha1.New,
+	HashSHA256: sha256.New,
+	HashSHA512: sha512.New,
+}
+
+// normalizeHashAlgorithms lowercases and deduplicates algorithms, drops the
+// unknown ones and makes sure SHA-256, which checksums and ETags are based
+// on, comes first.
+func normalizeHashAlgorithms(algorithms []string) []string {
+	normalized := []string{HashSHA256}
+	for _, algorithm := range algorithms {
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		if _, ok := hashConstructors[algorithm]; !ok {
+			log.Printf("ignoring unknown hash algorithm %q", algorithm)
+			continue
+		}
+		if !slices.Contains(normalized, algorithm) {
+			normalized = append(normalized, algorithm)
+		}
+	}
+
+	return normalized
+}
+
+// digester computes every configured digest of a stream in a single pass.
+type digester struct {
+	algorithms []string
+	hashers    []hash.Hash
+}
+
+func (h *ApiHandler) newDigester() *digester {
+	d := &digester{algorithms: h.cfg.HashAlgorithms}
+	for _, algorithm := range d.algorithms {
+		d.hashers = append(d.hashers, hashConstructors[algorithm]())
+	}
+	return d
+}
+
+// Write feeds p to every hasher. Hashes never return an error.
+func (d *digester) Write(p []byte) (int, error) {
+	for _, hasher := range d.hashers {
+		hasher.Write(p)
+	}
+	return len(p), nil
+}
+
+// sums returns the hex encoded digests keyed by algorithm.
+func (d *digester) sums() map[string]string {
+	sums := make(map[string]string, len(d.hashers))
+	for i, hasher := range d.hashers {
+		sums[d.algorithms[i]] = hex.EncodeToString(hasher.Sum(nil))
+	}
+	return sums
+}
+
+// digestFile returns the size and every configured digest of the file at path.
+func (h *ApiHandler) digestFile(path string) (int64, map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	buf := getBuffer(h.cfg.BufferSize)
+	defer putBuffer(buf)
+
+	digests := h.newDigester()
+	size, err := io.CopyBuffer(digests, file, *buf)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return size, digests.sums(), nil
+}
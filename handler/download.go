@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errRangeNotSatisfiable reports a Range that lies outside the file.
+var errRangeNotSatisfiable = errors.New("range lies outside the file")
+
+// Download handles GET and HEAD /download/:file_name. HEAD returns the same
+// headers as GET (Content-Length, Content-Type, ETag, Last-Modified,
+// Accept-Ranges) without the body, so clients can check a file and plan
+// ranges cheaply; unknown files get 404 either way. A single byte range in the Range
+// header is served as 206 Partial Content; an interrupted download resumes by
+// requesting the remaining bytes with the file's ETag in If-Range, which acts
+// as the resume token: if the file changed in between, the whole new file is
+// sent instead of a range of it. With Config.GzipDownloads, whole files of
+// compressible types are gzip encoded on the fly for clients accepting it.
+func (h *ApiHandler) Download(c *fiber.Ctx) error {
+	fileName := c.Params("file_name")
+	if !validFileName(fileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+
+	file, err := os.Open(h.filePath(fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return RespondError(c, ErrFileNotFound.With(fiber.Map{
+				"file": fileName,
+			}))
+		}
+		return RespondError(c, ErrInternal.WithMessage("Failed to open file").Wrap(err))
+	}
+	// Ownership moves to the response stream once the body is sent
+	sending := false
+	defer func() {
+		if !sending {
+			file.Close()
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file").Wrap(err))
+	}
+	size := info.Size()
+
+	meta, err := h.storedMetadata(fileName, size)
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file metadata").Wrap(err))
+	}
+	etag := formatETag(meta.Checksum)
+
+	// A one-time file is only ever sent whole, since a range of it would
+	// have to either delete the file or leave it downloadable forever
+	if meta.DownloadOnce {
+		c.Set(fiber.HeaderAcceptRanges, "none")
+	} else {
+		c.Set(fiber.HeaderAcceptRanges, "bytes")
+	}
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, info.ModTime().UTC().Format(http.TimeFormat))
+
+	start, end := int64(0), size // Half-open, like the upload ranges
+	status := fiber.StatusOK
+	if header := c.Get(fiber.HeaderRange); header != "" && !meta.DownloadOnce && ifRangeMatches(c.Get(fiber.HeaderIfRange), etag) {
+		r, ok, err := parseRange(header, size)
+		if err != nil {
+			c.Set(fiber.HeaderContentRange, "bytes */"+strconv.FormatInt(size, 10))
+			return RespondError(c, ErrRangeNotSatisfied.Wrap(err).With(fiber.Map{
+				"size": size,
+			}))
+		}
+		if ok {
+			start, end = r.Start, r.End
+			status = fiber.StatusPartialContent
+			c.Set(fiber.HeaderContentRange, "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end-1, 10)+"/"+strconv.FormatInt(size, 10))
+		}
+	}
+
+	c.Attachment(fileName)
+	c.Status(status)
+	if h.cfg.GzipDownloads {
+		c.Vary(fiber.HeaderAcceptEncoding)
+	}
+	compress := status == fiber.StatusOK && h.gzipDownload(c, meta)
+	if compress {
+		c.Set(fiber.HeaderETag, gzipETag(meta.Checksum))
+	}
+	if c.Method() == fiber.MethodHead {
+		if compress {
+			// The compressed length is only known once the body is sent
+			c.Set(fiber.HeaderContentEncoding, "gzip")
+			c.Response().SkipBody = true
+			return nil
+		}
+		c.Response().Header.SetContentLength(int(end - start))
+		c.Response().SkipBody = true
+		return nil
+	}
+
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file").Wrap(err))
+	}
+
+	if meta.DownloadOnce {
+		// A second download of a one-time file while the first is still
+		// running would let both succeed
+		if _, busy := h.downloads.LoadOrStore(fileName, struct{}{}); busy {
+			return RespondError(c, ErrConflict.WithMessage("File is already being downloaded").With(fiber.Map{
+				"file": fileName,
+			}))
+		}
+		sending = true
+		return h.sendOnce(c, fileName, file, info, compress)
+	}
+
+	sending = true
+	if compress {
+		return h.sendGzip(c, file)
+	}
+	return c.SendStream(readCloser{io.LimitReader(file, end-start), file}, int(end-start))
+}
+
+// readCloser pairs a limited reader with the file it reads from, so the
+// response stream closes the file once the body is sent.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// ifRangeMatches reports whether a Range request may be honoured given the
+// If-Range header value. Only strong ETags are compared; a date or a stale
+// ETag means the client's partial copy is outdated.
+func ifRangeMatches(ifRange, etag string) bool {
+	return ifRange == "" || ifRange == etag
+}
+
+// parseRange parses a Range header with a single byte range against a file
+// of the given size. ok is false when the header should be ignored, e.g. for
+// other units or multiple ranges, and the whole file served instead. An error
+// means the range lies outside the file.
+func parseRange(header string, size int64) (byteRange, bool, error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return byteRange{}, false, nil
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, nil
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return byteRange{}, false, nil
+		}
+		if n == 0 || size == 0 {
+			return byteRange{}, false, errRangeNotSatisfiable
+		}
+		return byteRange{Start: max(size-n, 0), End: size}, true, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, nil
+	}
+	if start >= size {
+		return byteRange{}, false, errRangeNotSatisfiable
+	}
+
+	end := size
+	if last != "" {
+		lastByte, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || lastByte < start {
+			return byteRange{}, false, nil
+		}
+		end = min(lastByte+1, size)
+	}
+
+	return byteRange{Start: start, End: end}, true, nil
+}
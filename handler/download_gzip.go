@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// compressedTypes are content types whose formats are compressed already;
+// gzip would burn CPU on them without saving bytes.
+var compressedTypes = map[string]bool{
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/zstd":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/pdf":              true,
+	"application/octet-stream":     true,
+}
+
+// gzipDownload reports whether the whole-file download of c is compressed on
+// the fly: Config.GzipDownloads is on, the client accepts gzip and the content
+// type is worth compressing. The type comes from a "content_type" entry in the
+// file's metadata when the uploader sent one, else from the file extension.
+func (h *ApiHandler) gzipDownload(c *fiber.Ctx, meta *domain.FileMetadata) bool {
+	if !h.cfg.GzipDownloads || !c.Context().Request.Header.HasAcceptEncoding("gzip") {
+		return false
+	}
+
+	contentType := meta.Metadata["content_type"]
+	if contentType == "" {
+		contentType = string(c.Response().Header.ContentType())
+	}
+	return compressible(contentType)
+}
+
+// compressible reports whether content of the given type shrinks under gzip.
+// Images, audio and video are compressed by their formats, except for SVG;
+// unknown binary content (application/octet-stream) is left alone too.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return false
+		}
+	}
+	return !compressedTypes[mediaType]
+}
+
+// gzipETag returns the ETag of the gzip encoded representation of a file,
+// which must differ from that of the file itself.
+func gzipETag(checksum string) string {
+	return formatETag(checksum + "-gzip")
+}
+
+// sendGzip streams file gzip compressed. The compressed size is unknown up
+// front, so the response is chunked.
+func (h *ApiHandler) sendGzip(c *fiber.Ctx, file *os.File) error {
+	c.Set(fiber.HeaderContentEncoding, "gzip")
+
+	// The writer runs on its own goroutine, so it must not touch c
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer file.Close()
+		h.copyGzip(w, file)
+	})
+
+	return nil
+}
+
+// copyGzip writes src to w through a gzip writer and flushes w, reporting
+// whether the whole stream was handed to the connection.
+func (h *ApiHandler) copyGzip(w *bufio.Writer, src io.Reader) bool {
+	buf := getBuffer(h.cfg.BufferSize)
+	defer putBuffer(buf)
+
+	gz := gzip.NewWriter(w)
+	if _, err := io.CopyBuffer(gz, src, *buf); err != nil {
+		return false
+	}
+	if err := gz.Close(); err != nil {
+		return false
+	}
+	return w.Flush() == nil
+}
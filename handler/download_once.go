@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// sendOnce streams a file merged with download_once and deletes it, with its
+// sidecars, once the whole body was handed to the connection. A download
+// interrupted by the client fails a write before that point and keeps the
+// file for another attempt. The caller has claimed fileName in h.downloads.
+// With compress the body is gzip encoded like in sendGzip.
+func (h *ApiHandler) sendOnce(c *fiber.Ctx, fileName string, file *os.File, info os.FileInfo, compress bool) error {
+	client := clientIdentity(c)
+	if compress {
+		c.Set(fiber.HeaderContentEncoding, "gzip")
+	}
+
+	// The writer runs on its own goroutine, so it must not touch c
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.downloads.Delete(fileName)
+		defer file.Close()
+
+		if compress {
+			if !h.copyGzip(w, file) {
+				return
+			}
+		} else {
+			buf := getBuffer(h.cfg.BufferSize)
+			defer putBuffer(buf)
+
+			if _, err := io.CopyBuffer(w, file, *buf); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		h.removeDownloaded(fileName, info, client)
+	})
+	if !compress {
+		c.Response().Header.SetContentLength(int(info.Size()))
+	}
+
+	return nil
+}
+
+// removeDownloaded deletes a one-time file after its download, unless a
+// merge replaced it in the meantime.
+func (h *ApiHandler) removeDownloaded(fileName string, downloaded os.FileInfo, client string) {
+	unlock := h.lockFile(fileName)
+	defer unlock()
+
+	path := h.filePath(fileName)
+	if current, err := os.Stat(path); err != nil || !os.SameFile(current, downloaded) {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("failed to delete downloaded file %s: %v", fileName, err)
+		return
+	}
+	for _, sidecar := range []string{h.metadataPath(fileName), h.mergeLogPath(fileName)} {
+		if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to delete sidecar %s: %v", sidecar, err)
+		}
+	}
+
+	h.audit(domain.AuditEvent{
+		Time:     time.Now(),
+		Action:   domain.AuditDelete,
+		FileName: fileName,
+		Bytes:    downloaded.Size(),
+		Client:   client,
+		Status:   domain.MergeStatusSuccess,
+	})
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mergeOnce stores data as fileName merged with download_once and returns an
+// app serving it under /download. data is uploaded in chunks of at most a
+// megabyte, below the request body limit.
+func mergeOnce(t *testing.T, h *ApiHandler, fileName string, data []byte) *fiber.App {
+	t.Helper()
+	app := newTestApp(h)
+	app.Get("/download/:file_name", h.Download)
+	chunks := 0
+	for len(data) > 0 {
+		chunk := data[:min(len(data), 1<<20)]
+		if status, body := uploadChunk(t, app, fileName, chunks, chunk); status != fiber.StatusOK {
+			t.Fatalf("upload of chunk %d: status %d: %v", chunks, status, body)
+		}
+		data = data[len(chunk):]
+		chunks++
+	}
+	status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": fileName, "total_chunks": chunks, "download_once": true})
+	if status != fiber.StatusOK {
+		t.Fatalf("merge: status %d: %v", status, body)
+	}
+	return app
+}
+
+// download sends a GET for fileName with the headers given as name and value
+// pairs and returns the response with its body read.
+func download(t *testing.T, app *fiber.App, fileName string, headers ...string) (*http.Response, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, "/download/"+fileName, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestDownloadOnce(t *testing.T) {
+	data := []byte("read me once")
+	tests := []struct {
+		name    string
+		headers []string
+	}{
+		{name: "whole file"},
+		// A one-time file is sent whole even when a range is asked for
+		{name: "range", headers: []string{fiber.HeaderRange, "bytes=0-3"}},
+		{name: "resumed range", headers: []string{fiber.HeaderRange, "bytes=4-", fiber.HeaderIfRange, formatETag(checksumOf(string(data)))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Config{})
+			app := mergeOnce(t, h, "secret.txt", data)
+
+			resp, body := download(t, app, "secret.txt", tt.headers...)
+			if resp.StatusCode != fiber.StatusOK || !bytes.Equal(body, data) {
+				t.Fatalf("status %d: %q, want 200 with the whole file", resp.StatusCode, body)
+			}
+			if accept := resp.Header.Get(fiber.HeaderAcceptRanges); accept != "none" {
+				t.Errorf("Accept-Ranges = %q, want none", accept)
+			}
+			for _, path := range []string{h.filePath("secret.txt"), h.metadataPath("secret.txt")} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s is left after the download: %v", path, err)
+				}
+			}
+			if resp, _ := download(t, app, "secret.txt"); resp.StatusCode != fiber.StatusNotFound {
+				t.Errorf("second download: status %d, want 404", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestDownloadOnceInterrupted(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	// Far more than the socket buffers hold, so the first download is still
+	// streaming while it is only read from in part
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<20)
+	app := mergeOnce(t, h, "large.bin", data)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	url := "http://" + ln.Addr().String() + "/download/large.bin"
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	first, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(first.Body, make([]byte, 1024)); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Body.Close()
+	if second.StatusCode != fiber.StatusConflict {
+		t.Errorf("concurrent download: status %d, want 409", second.StatusCode)
+	}
+
+	// Breaking off the first download releases it and keeps the file
+	first.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, busy := h.downloads.Load("large.bin"); !busy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("interrupted download is still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info, err := os.Stat(h.filePath("large.bin")); err != nil || info.Size() != int64(len(data)) {
+		t.Fatalf("interrupted download left %v, %v, want the whole file", info, err)
+	}
+
+	resp, body := download(t, app, "large.bin")
+	if resp.StatusCode != fiber.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("retried download: status %d with %d bytes, want 200 with %d", resp.StatusCode, len(body), len(data))
+	}
+	if _, err := os.Stat(h.filePath("large.bin")); !os.IsNotExist(err) {
+		t.Errorf("file is left after the retried download: %v", err)
+	}
+}
+
+func TestDownloadObjectRefusesOnce(t *testing.T) {
+	h := newTestHandler(t, Config{StorageLayout: StorageLayoutContent})
+	app := mergeOnce(t, h, "secret.txt", []byte("read me once"))
+	app.Get("/objects/:checksum", h.DownloadObject)
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/objects/"+checksumOf("read me once"), nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("object of a one-time file: status %d, want 404", resp.StatusCode)
+	}
+	if resp, body := download(t, app, "secret.txt"); resp.StatusCode != fiber.StatusOK || string(body) != "read me once" {
+		t.Errorf("download: status %d: %q, want 200 with the file", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// SkippedFilesHeader lists, comma separated and query escaped, the requested
+// files a ZIP download left out.
+const SkippedFilesHeader = "X-Skipped-Files"
+
+// maxZipFiles bounds the number of files a single ZIP download may list. The
+// archive is streamed, so the limit caps the names checked up front and the
+// time one request holds a connection, not memory.
+const maxZipFiles = 1000
+
+// zipEntry is a stored file going into a ZIP download.
+type zipEntry struct {
+	name string
+	info os.FileInfo
+}
+
+// DownloadZip handles POST /download/zip, streaming the listed stored files
+// back as one ZIP archive built while it is sent, so the archive is never
+// held in memory or on disk. Files that do not exist are skipped, as are
+// files merged with download_once, which a download deletes; the skipped
+// names are reported in SkippedFilesHeader. With none of the files left the
+// request is answered with 404.
+func (h *ApiHandler) DownloadZip(c *fiber.Ctx) error {
+	body := new(domain.ZipDownloadRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+	if len(body.FileNames) == 0 || len(body.FileNames) > maxZipFiles {
+		return RespondError(c, ErrInvalidRequest.WithMessage(fmt.Sprintf("file_names must list between 1 and %d files", maxZipFiles)))
+	}
+
+	entries := make([]zipEntry, 0, len(body.FileNames))
+	var skipped []string
+	seen := make(map[string]bool, len(body.FileNames))
+	for _, fileName := range body.FileNames {
+		if !validFileName(fileName) {
+			return RespondError(c, ErrInvalidFileName.With(fiber.Map{
+				"file": fileName,
+			}))
+		}
+		if seen[fileName] {
+			continue
+		}
+		seen[fileName] = true
+
+		info, err := os.Stat(h.filePath(fileName))
+		if err != nil {
+			if os.IsNotExist(err) {
+				skipped = append(skipped, fileName)
+				continue
+			}
+			return RespondError(c, ErrInternal.WithMessage("Failed to read file").Wrap(err))
+		}
+		meta, err := h.readMetadata(fileName)
+		if err != nil && !os.IsNotExist(err) {
+			return RespondError(c, ErrInternal.WithMessage("Failed to read file metadata").Wrap(err))
+		}
+		if meta != nil && meta.DownloadOnce {
+			skipped = append(skipped, fileName)
+			continue
+		}
+		entries = append(entries, zipEntry{name: fileName, info: info})
+	}
+	if len(entries) == 0 {
+		return RespondError(c, ErrFileNotFound.WithMessage("None of the files exist").With(fiber.Map{
+			"missing": skipped,
+		}))
+	}
+
+	if len(skipped) > 0 {
+		escaped := make([]string, len(skipped))
+		for i, name := range skipped {
+			escaped[i] = url.QueryEscape(name)
+		}
+		c.Set(SkippedFilesHeader, strings.Join(escaped, ","))
+	}
+	c.Attachment("files.zip")
+
+	// The writer runs on its own goroutine, so it must not touch c
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		h.writeZip(w, entries)
+	})
+
+	return nil
+}
+
+// writeZip writes entries to w as a ZIP archive and flushes w. A file removed
+// since the request was checked is left out, as the headers are sent by now;
+// a failed write means the client went away and ends the archive.
+func (h *ApiHandler) writeZip(w *bufio.Writer, entries []zipEntry) {
+	buf := getBuffer(h.cfg.BufferSize)
+	defer putBuffer(buf)
+
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		file, err := os.Open(h.filePath(entry.name))
+		if err != nil {
+			log.Printf("leaving %s out of a ZIP download: %v", entry.name, err)
+			continue
+		}
+		header, err := zip.FileInfoHeader(entry.info)
+		if err == nil {
+			header.Name = entry.name
+			header.Method = zip.Deflate
+			var dst io.Writer
+			if dst, err = zw.CreateHeader(header); err == nil {
+				_, err = io.CopyBuffer(dst, file, *buf)
+			}
+		}
+		file.Close()
+		if err != nil {
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return
+	}
+	w.Flush()
+}
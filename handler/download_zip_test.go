@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDownloadZipSkipsFiles(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := mergeOnce(t, h, "once.txt", []byte("read me once"))
+	app.Post("/download/zip", h.DownloadZip)
+	for _, fileName := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(h.filePath(fileName), []byte("content of "+fileName), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := json.Marshal(map[string]any{"file_names": []string{"a.txt", "missing, too.txt", "b.txt", "a.txt", "once.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(fiber.MethodPost, "/download/zip", bytes.NewReader(data))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	archive, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, archive)
+	}
+	if skipped := resp.Header.Get(SkippedFilesHeader); skipped != "missing%2C+too.txt,once.txt" {
+		t.Errorf("%s = %q, want the missing and the one-time file", SkippedFilesHeader, skipped)
+	}
+	if contentType := resp.Header.Get(fiber.HeaderContentType); contentType != "application/zip" {
+		t.Errorf("Content-Type = %q, want application/zip", contentType)
+	}
+	if disposition := resp.Header.Get(fiber.HeaderContentDisposition); disposition != `attachment; filename="files.zip"` {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	var order []string
+	for _, file := range zr.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[file.Name] = string(content)
+		order = append(order, file.Name)
+	}
+	if want := []string{"a.txt", "b.txt"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("archive holds %v, want each requested file once: %v", order, want)
+	}
+	for _, fileName := range order {
+		if got[fileName] != "content of "+fileName {
+			t.Errorf("%s holds %q in the archive", fileName, got[fileName])
+		}
+	}
+	// Listing a one-time file in a ZIP does not count as its download
+	if _, err := os.Stat(h.filePath("once.txt")); err != nil {
+		t.Errorf("one-time file after the ZIP download: %v", err)
+	}
+}
+
+func TestDownloadZipRefuses(t *testing.T) {
+	tests := []struct {
+		name      string
+		fileNames []string
+		status    int
+		code      string
+	}{
+		{name: "none exist", fileNames: []string{"missing.txt", "gone.txt"}, status: fiber.StatusNotFound, code: ErrFileNotFound.Code},
+		{name: "invalid name", fileNames: []string{"a.txt", "../config.go"}, status: ErrInvalidFileName.Status, code: ErrInvalidFileName.Code},
+		{name: "empty list", fileNames: []string{}, status: fiber.StatusBadRequest, code: ErrInvalidRequest.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Config{})
+			app := fiber.New()
+			app.Post("/download/zip", h.DownloadZip)
+			if err := os.WriteFile(h.filePath("a.txt"), []byte("a"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			status, body := postJSON(t, app, "/download/zip", map[string]any{"file_names": tt.fileNames})
+			if status != tt.status || body["code"] != tt.code {
+				t.Fatalf("status %d: %v, want %d %s", status, body, tt.status, tt.code)
+			}
+			if tt.status == fiber.StatusNotFound && !reflect.DeepEqual(body["missing"], []any{"missing.txt", "gone.txt"}) {
+				t.Errorf("missing = %v, want both files", body["missing"])
+			}
+		})
+	}
+}
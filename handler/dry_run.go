@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// Actions a merge would take on the output file, as reported by a dry run.
+const (
+	actionCreate    = "create"
+	actionOverwrite = "overwrite"
+	actionAppend    = "append"
+	actionRename    = "rename"
+	actionReject    = "reject"
+)
+
+// dryRunMerge reports what merging body would do without creating the output
+// file or touching the chunks. The report is always returned with 200; its
+// "valid" field tells whether the real merge would succeed. Dry runs only
+// stat the chunks, so they take no merge slot.
+func (h *ApiHandler) dryRunMerge(c *fiber.Ctx, body *domain.MergeChunksRequest) error {
+	chunkKey, _, err := h.prepareMerge(c.UserContext(), body)
+	if err != nil {
+		return RespondError(c, err)
+	}
+	unlock := h.lockFile(body.FileName)
+	defer unlock()
+
+	if h.cfg.MultipartStorage != nil {
+		return h.dryRunMultipart(c, body, chunkKey)
+	}
+
+	preconditionOK := true
+	if body.IfMatch != "" || body.IfNoneMatch != "" {
+		etag, err := h.currentETag(body.FileName)
+		if err != nil {
+			return RespondError(c, ErrInternal.WithMessage("Failed to read current file").Wrap(err))
+		}
+		preconditionOK = preconditionsMet(body.IfMatch, body.IfNoneMatch, etag)
+	}
+	sizes, missing, err := h.inspectChunks(chunkKey, h.cfg.ChunkBase, body.TotalChunks)
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to inspect chunks").Wrap(err))
+	}
+
+	problems := []string{}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing chunks %v", missing))
+	}
+	if !preconditionOK {
+		problems = append(problems, "precondition failed")
+	}
+
+	// The same checks as the merge, recorded in a report nobody reads
+	checks, err := h.validateChunks(body, chunkKey, sizes, &domain.MergeReport{})
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read manifest").Wrap(err))
+	}
+	for _, problem := range checks {
+		problems = append(problems, problem.cause.Error())
+	}
+	size := sumSizes(sizes)
+
+	action, outName, err := h.plannedOutput(body.FileName, body.Append, body.IfMatch != "")
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to inspect output file").Wrap(err))
+	}
+	if action == actionReject {
+		problems = append(problems, "file already exists")
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":          false,
+		"message":        "Dry run completed, nothing was written",
+		"dry_run":        true,
+		"valid":          len(problems) == 0,
+		"problems":       problems,
+		"file":           outName,
+		"action":         action,
+		"size":           size,
+		"total_chunks":   body.TotalChunks,
+		"chunk_base":     h.cfg.ChunkBase,
+		"chunk_sizes":    sizes,
+		"missing_chunks": missing,
+	})
+}
+
+// plannedOutput mirrors openOutput without creating anything: it returns the
+// action a merge would take and the name it would write to.
+func (h *ApiHandler) plannedOutput(fileName string, appendMode, conditional bool) (string, string, error) {
+	names, err := h.storedNames(fileName)
+	if err != nil {
+		return "", "", err
+	}
+	if _, ok := caseConflict(names, fileName); ok {
+		return actionReject, fileName, nil
+	}
+	exists, err := fileExists(h.filePath(fileName))
+	if err != nil {
+		return "", "", err
+	}
+
+	switch {
+	case appendMode:
+		return actionAppend, fileName, nil
+	case !exists:
+		return actionCreate, fileName, nil
+	case conditional || h.cfg.CollisionPolicy == CollisionOverwrite:
+		return actionOverwrite, fileName, nil
+	case h.cfg.CollisionPolicy == CollisionError:
+		return actionReject, fileName, nil
+	}
+
+	for n := 1; n <= maxRenameAttempts; n++ {
+		candidate := numberedName(fileName, n)
+		if _, ok := caseConflict(names, candidate); ok {
+			continue
+		}
+		exists, err := fileExists(h.filePath(candidate))
+		if err != nil {
+			return "", "", err
+		}
+		if !exists {
+			return actionRename, candidate, nil
+		}
+	}
+
+	return actionReject, fileName, nil
+}
+
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, err
+}
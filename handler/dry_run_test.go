@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDryRunMergeMatchesMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		// prep stores the chunks "ab" and "cd" of data.bin and returns the
+		// merge request
+		prep func(t *testing.T, app *fiber.App) map[string]any
+		// code is the error of the real merge, empty when it succeeds
+		code string
+	}{
+		{
+			name: "valid",
+			prep: func(t *testing.T, app *fiber.App) map[string]any {
+				uploadChunks(t, app, "")
+				postManifest(t, app, "data.bin", checksumOf("ab"), checksumOf("cd"))
+				return map[string]any{"total_chunks": 2}
+			},
+		},
+		{
+			name: "manifest checksum",
+			prep: func(t *testing.T, app *fiber.App) map[string]any {
+				uploadChunks(t, app, "")
+				postManifest(t, app, "data.bin", checksumOf("ab"), checksumOf("xx"))
+				return map[string]any{"total_chunks": 2}
+			},
+			code: ErrChecksumMismatch.Code,
+		},
+		{
+			name: "manifest chunk count",
+			prep: func(t *testing.T, app *fiber.App) map[string]any {
+				uploadChunks(t, app, "")
+				postManifest(t, app, "data.bin", checksumOf("ab"))
+				return map[string]any{"total_chunks": 2}
+			},
+			code: ErrManifestMismatch.Code,
+		},
+		{
+			name: "total size",
+			prep: func(t *testing.T, app *fiber.App) map[string]any {
+				uploadChunks(t, app, "")
+				return map[string]any{"total_chunks": 2, "total_size": 5}
+			},
+			code: ErrSizeMismatch.Code,
+		},
+		{
+			name: "session chunk size",
+			cfg:  Config{ChunkSize: 3},
+			prep: func(t *testing.T, app *fiber.App) map[string]any {
+				status, body := postJSON(t, app, "/upload/init", map[string]any{"file_name": "data.bin"})
+				if status != fiber.StatusCreated {
+					t.Fatalf("init: status %d: %v", status, body)
+				}
+				uploadID := body["upload_id"].(string)
+				uploadChunks(t, app, uploadID)
+				return map[string]any{"total_chunks": 2, "upload_id": uploadID}
+			},
+			code: ErrChunkSizeMismatch.Code,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.cfg)
+			app := newTestApp(h)
+			app.Post("/upload/init", Recover(h.InitUpload))
+			merge := tt.prep(t, app)
+			merge["file_name"] = "data.bin"
+
+			merge["dry_run"] = true
+			status, body := postJSON(t, app, "/merge-chunk", merge)
+			if status != fiber.StatusOK {
+				t.Fatalf("dry run: status %d: %v", status, body)
+			}
+			// Every case but the valid one has exactly one problem
+			problems, _ := body["problems"].([]any)
+			valid, wantProblems := tt.code == "", 1
+			if valid {
+				wantProblems = 0
+			}
+			if body["valid"] != valid || len(problems) != wantProblems {
+				t.Errorf("dry run: valid %v with problems %v, want valid %v", body["valid"], problems, valid)
+			}
+			if files := storedFiles(t); len(files) != 0 {
+				t.Errorf("dry run wrote %v", files)
+			}
+
+			delete(merge, "dry_run")
+			status, body = postJSON(t, app, "/merge-chunk", merge)
+			if tt.code == "" {
+				if status != fiber.StatusOK {
+					t.Errorf("merge: status %d: %v, want 200", status, body)
+				}
+				return
+			}
+			if body["code"] != tt.code {
+				t.Errorf("merge: status %d: %v, want %s", status, body, tt.code)
+			}
+		})
+	}
+}
+
+// uploadChunks stores the chunks "ab" and "cd" of data.bin, in the session
+// uploadID unless it is empty.
+func uploadChunks(t *testing.T, app *fiber.App, uploadID string) {
+	t.Helper()
+	for i, content := range []string{"ab", "cd"} {
+		fields := map[string]string{"chunk_index": fmt.Sprint(i)}
+		if uploadID != "" {
+			fields["upload_id"] = uploadID
+		}
+		req := multipartRequest(t, fields, testFile{name: "data.bin", data: []byte(content)})
+		if status, body := send(t, app, req); status != fiber.StatusOK {
+			t.Fatalf("upload of chunk %d: status %d: %v", i, status, body)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// hideDetailsKey marks, in the request locals, that error details must not
+// reach the client.
+const hideDetailsKey = "uploads-api.hide-details"
+
+// Middleware applies per-request settings from the Config and compresses
+// large enough responses. Register it with app.Use before the routes.
+func (h *ApiHandler) Middleware(c *fiber.Ctx) error {
+	if h.cfg.HideErrorDetails {
+		c.Locals(hideDetailsKey, true)
+	}
+
+	if err := c.Next(); err != nil {
+		return err
+	}
+	h.compress(c)
+
+	return nil
+}
+
+// hideDetails replaces the internal error string of an error response with an
+// ID. The details are logged under the same ID so operators can still find
+// them. Bodies without details are returned unchanged.
+func hideDetails(c *fiber.Ctx, status int, body any) any {
+	if hide, _ := c.Locals(hideDetailsKey).(bool); !hide {
+		return body
+	}
+	m, ok := body.(fiber.Map)
+	if !ok {
+		return body
+	}
+	details, ok := m["details"]
+	if !ok {
+		return body
+	}
+
+	errorID := newErrorID()
+	log.Printf("error %s: %s %s -> %d %v: %v", errorID, c.Method(), c.Path(), status, m["message"], details)
+
+	// Copy so callers reusing the map are not affected
+	redacted := make(fiber.Map, len(m))
+	for key, value := range m {
+		if key != "details" {
+			redacted[key] = value
+		}
+	}
+	redacted["error_id"] = errorID
+
+	return redacted
+}
+
+// newErrorID returns a short random ID correlating a response with its log line.
+func newErrorID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+// formatETag turns a hex encoded SHA-256 into a strong ETag value.
+func formatETag(checksum string) string {
+	return `"` + checksum + `"`
+}
+
+// currentETag returns the ETag of the stored file fileName, or an empty
+// string when the file does not exist. It is the checksum recorded in the
+// file's sidecar, so a conditional merge costs no read of the file; only
+// files stored before sidecars existed are hashed.
+func (h *ApiHandler) currentETag(fileName string) (string, error) {
+	info, err := os.Stat(h.filePath(fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	meta, err := h.storedMetadata(fileName, info.Size())
+	if err != nil {
+		return "", err
+	}
+
+	return formatETag(meta.Checksum), nil
+}
+
+// checksumFile returns the size and hex encoded SHA-256 of the file at path.
+func checksumFile(path string, bufferSize int) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	buf := getBuffer(bufferSize)
+	defer putBuffer(buf)
+
+	hasher := sha256.New()
+	size, err := io.CopyBuffer(hasher, file, *buf)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// preconditionsMet evaluates the If-Match and If-None-Match header values
+// against etag, the ETag of the current file ("" when it does not exist).
+func preconditionsMet(ifMatch, ifNoneMatch, etag string) bool {
+	if ifMatch != "" {
+		if etag == "" || !etagListContains(ifMatch, etag) {
+			return false
+		}
+	}
+	if ifNoneMatch != "" {
+		if etag != "" && etagListContains(ifNoneMatch, etag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// etagListContains reports whether the comma separated header value lists
+// etag or is the "*" wildcard. Weak validators are compared by their opaque tag.
+func etagListContains(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+func TestCurrentETag(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	content := []byte("stored before sidecars existed")
+	if err := os.WriteFile(h.filePath("old.txt"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+
+	etag, err := h.currentETag("old.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := formatETag(hex.EncodeToString(sum[:])); etag != want {
+		t.Errorf("ETag without a sidecar = %s, want the hash of the file %s", etag, want)
+	}
+
+	// The sidecar is trusted over the content, which is not read again
+	recorded := strings.Repeat("a", 64)
+	if err := h.writeMetadata(&domain.FileMetadata{FileName: "old.txt", Size: int64(len(content)), Checksum: recorded}); err != nil {
+		t.Fatal(err)
+	}
+	if etag, err = h.currentETag("old.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if want := formatETag(recorded); etag != want {
+		t.Errorf("ETag with a sidecar = %s, want the recorded checksum %s", etag, want)
+	}
+
+	if etag, err = h.currentETag("missing.txt"); err != nil || etag != "" {
+		t.Errorf("ETag of a missing file = %q, %v, want none", etag, err)
+	}
+}
+
+func TestMergeChunksIfMatch(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := newTestApp(h)
+
+	upload := func(content string) {
+		t.Helper()
+		if status, body := uploadChunk(t, app, "report.txt", 0, []byte(content)); status != fiber.StatusOK {
+			t.Fatalf("upload: status %d: %v", status, body)
+		}
+	}
+	merge := map[string]any{"file_name": "report.txt", "total_chunks": 1}
+
+	upload("first")
+	status, body := postJSON(t, app, "/merge-chunk", merge)
+	if status != fiber.StatusOK {
+		t.Fatalf("first merge: status %d: %v", status, body)
+	}
+	etag := formatETag(body["checksum"].(string))
+
+	upload("second")
+	if status, body = postJSON(t, app, "/merge-chunk", merge, fiber.HeaderIfMatch, `"stale"`); status != fiber.StatusPreconditionFailed {
+		t.Fatalf("merge with a stale ETag: status %d: %v", status, body)
+	}
+	if body["etag"] != etag {
+		t.Errorf("412 reports ETag %v, want %s", body["etag"], etag)
+	}
+	if status, body = postJSON(t, app, "/merge-chunk", merge, fiber.HeaderIfMatch, etag); status != fiber.StatusOK {
+		t.Fatalf("merge with the current ETag: status %d: %v", status, body)
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FileExists handles GET /exists/:file_name, telling clients whether a merged
+// file is already stored so they can skip re-uploading it. It costs a single
+// Stat; with ?sha256=<hex> the stored checksum is compared too, confirming
+// the file is the same and not just of the same name.
+func (h *ApiHandler) FileExists(c *fiber.Ctx) error {
+	fileName := c.Params("file_name")
+	if !validFileName(fileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+
+	info, err := os.Stat(h.filePath(fileName))
+	if os.IsNotExist(err) || (err == nil && !info.Mode().IsRegular()) {
+		return Respond(c, fiber.StatusOK, fiber.Map{
+			"error":  false,
+			"exists": false,
+			"size":   0,
+		})
+	}
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file").Wrap(err))
+	}
+
+	response := fiber.Map{
+		"error":  false,
+		"exists": true,
+		"size":   info.Size(),
+	}
+	if checksum := c.Query("sha256"); checksum != "" {
+		meta, err := h.storedMetadata(fileName, info.Size())
+		if err != nil {
+			return RespondError(c, ErrInternal.WithMessage("Failed to read file metadata").Wrap(err))
+		}
+		response["same"] = strings.EqualFold(checksum, meta.Checksum)
+	}
+
+	return Respond(c, fiber.StatusOK, response)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Extension policies decide how names with several extensions, such as
+// "shell.php.jpg" crafted to slip past upload filters, are stored.
+const (
+	// ExtensionKeep stores the name unchanged.
+	ExtensionKeep = "keep"
+	// ExtensionStrip keeps only the last extension: "shell.php.jpg" becomes
+	// "shell.jpg".
+	ExtensionStrip = "strip"
+	// ExtensionNeutralize turns the inner dots into underscores so only the
+	// last extension remains one: "shell.php.jpg" becomes "shell_php.jpg".
+	ExtensionNeutralize = "neutralize"
+)
+
+// storedName applies Config.NameTransformer and then the configured
+// extension policy to the name a file is about to be stored under, logging
+// every rewrite. A transformed name that is no longer a plain file name is
+// refused rather than stored.
+func (h *ApiHandler) storedName(fileName string) (string, *Error) {
+	stored := fileName
+	if h.cfg.NameTransformer != nil {
+		stored = h.cfg.NameTransformer(fileName)
+		if !validFileName(stored) {
+			return "", ErrInvalidFileName.WithMessage("Name transformation produced an invalid file name").With(fiber.Map{
+				"file": fileName,
+			})
+		}
+	}
+	stored = sanitizeExtensions(stored, h.cfg.ExtensionPolicy)
+	if stored != fileName {
+		log.Printf("storing %q as %q (extension policy %s)", fileName, stored, h.cfg.ExtensionPolicy)
+	}
+
+	return stored, nil
+}
+
+// sanitizeExtensions rewrites names with more than one extension according to
+// policy. Leading dots mark hidden files and are not treated as extensions.
+func sanitizeExtensions(fileName, policy string) string {
+	rest := strings.TrimLeft(fileName, ".")
+	prefix := fileName[:len(fileName)-len(rest)]
+
+	parts := strings.Split(rest, ".")
+	if len(parts) <= 2 {
+		return fileName
+	}
+	base, inner, ext := parts[0], parts[1:len(parts)-1], parts[len(parts)-1]
+
+	switch policy {
+	case ExtensionStrip:
+		return prefix + base + "." + ext
+	case ExtensionNeutralize:
+		return prefix + base + "_" + strings.Join(inner, "_") + "." + ext
+	}
+
+	return fileName
+}
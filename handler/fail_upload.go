@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// FailUpload handles POST /upload/fail, where a client abandons an upload it
+// knows will not complete, e.g. because its source file was deleted. The
+// chunks, manifest and session of the upload, or the temp file of a range
+// upload of the name, are removed at once instead of waiting for the
+// sweeper. Only the reported upload is touched; abandoning one with nothing
+// left to clean up succeeds with zero counts.
+func (h *ApiHandler) FailUpload(c *fiber.Ctx) error {
+	body := new(domain.FailUploadRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+	if body.UploadID == "" && !validFileName(body.FileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+	fileName, chunkKey, err := h.resolveUpload(body.UploadID, body.FileName)
+	if err != nil {
+		return RespondError(c, err)
+	}
+
+	// A merge of the file finishes first, and no chunk of it is merged
+	// after the cleanup
+	unlock := h.lockFile(fileName)
+	defer unlock()
+
+	chunks := len(h.chunks.paths(chunkKey))
+	if err := h.cleanUpTempFiles(chunkKey); err != nil {
+		return storageError(c, "Failed to remove chunks", err)
+	}
+	if err := removeManifest(chunkKey); err != nil {
+		return storageError(c, "Failed to remove manifest", err)
+	}
+	// Parts already in object storage would otherwise be kept, and billed,
+	// until the bucket's lifecycle rules remove them
+	parts, err := h.abortMultipart(c.UserContext(), chunkKey)
+	if err != nil {
+		return RespondError(c, ErrUpstream.WithMessage("Failed to abort multipart upload").Wrap(err))
+	}
+	chunks += parts
+	h.progress.reset(chunkKey)
+	h.sequences.reset(chunkKey)
+	if body.UploadID != "" {
+		h.sessions.remove(body.UploadID)
+	}
+
+	// A range upload is keyed by the file name alone
+	rangeUpload := false
+	if body.UploadID == "" {
+		rangeUpload = h.ranges.remove(fileName)
+		if err := os.Remove(rangePath(fileName)); err != nil && !os.IsNotExist(err) {
+			return storageError(c, "Failed to remove range upload", err)
+		}
+	}
+
+	log.Printf("upload of %s abandoned by the client (%d chunks removed): %s", fileName, chunks, body.Reason)
+	h.audit(domain.AuditEvent{
+		Time:     time.Now(),
+		Action:   domain.AuditAbandon,
+		FileName: fileName,
+		Client:   clientIdentity(c),
+		Status:   domain.MergeStatusFailed,
+	})
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":          false,
+		"message":        "Upload abandoned",
+		"file":           fileName,
+		"removed_chunks": chunks,
+		"range_upload":   rangeUpload,
+	})
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// memoryMultipart is a MultipartStorage counting the parts of its uploads in
+// memory. AbortUpload fails with abortErr while it is set.
+type memoryMultipart struct {
+	mu       sync.Mutex
+	uploads  int
+	parts    map[string]int // By upload ID
+	aborted  []string       // Object name and upload ID
+	abortErr error
+}
+
+func (m *memoryMultipart) CreateUpload(ctx context.Context, name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads++
+	return fmt.Sprintf("upload-%d", m.uploads), nil
+}
+
+func (m *memoryMultipart) UploadPart(ctx context.Context, name, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.parts == nil {
+		m.parts = make(map[string]int)
+	}
+	m.parts[uploadID]++
+	return fmt.Sprintf("etag-%d", partNumber), nil
+}
+
+func (m *memoryMultipart) CompleteUpload(ctx context.Context, name, uploadID string, parts []CompletedPart) (string, error) {
+	return "complete", nil
+}
+
+func (m *memoryMultipart) AbortUpload(ctx context.Context, name, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.abortErr != nil {
+		return m.abortErr
+	}
+	delete(m.parts, uploadID)
+	m.aborted = append(m.aborted, name+" "+uploadID)
+	return nil
+}
+
+func TestFailUploadAbortsMultipart(t *testing.T) {
+	storage := &memoryMultipart{abortErr: errors.New("store unreachable")}
+	h := newTestHandler(t, Config{MultipartStorage: storage})
+	app := newTestApp(h)
+	app.Post("/upload/fail", Recover(h.FailUpload))
+	for i, content := range []string{"first", "second"} {
+		if status, body := uploadChunk(t, app, "video.mp4", i, []byte(content)); status != fiber.StatusOK {
+			t.Fatalf("upload of chunk %d: status %d: %v", i, status, body)
+		}
+	}
+
+	// An upload the store failed to abort is kept for a retry
+	status, body := postJSON(t, app, "/upload/fail", map[string]any{"file_name": "video.mp4"})
+	if status != fiber.StatusBadGateway || body["code"] != ErrUpstream.Code {
+		t.Fatalf("failed abort: status %d: %v, want 502 %s", status, body, ErrUpstream.Code)
+	}
+	if _, ok := h.multipart.get("video.mp4"); !ok {
+		t.Fatal("failed abort forgot the multipart upload")
+	}
+
+	storage.abortErr = nil
+	status, body = postJSON(t, app, "/upload/fail", map[string]any{"file_name": "video.mp4"})
+	if status != fiber.StatusOK {
+		t.Fatalf("abort: status %d: %v", status, body)
+	}
+	if body["removed_chunks"] != float64(2) {
+		t.Errorf("removed_chunks = %v, want the 2 aborted parts", body["removed_chunks"])
+	}
+	if len(storage.aborted) != 1 || storage.aborted[0] != "video.mp4 upload-1" {
+		t.Errorf("aborted uploads = %v, want video.mp4 upload-1", storage.aborted)
+	}
+	if parts := storage.parts["upload-1"]; parts != 0 {
+		t.Errorf("%d parts left in the store", parts)
+	}
+	if _, ok := h.multipart.get("video.mp4"); ok {
+		t.Error("aborted multipart upload is still tracked")
+	}
+}
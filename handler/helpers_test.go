@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testFile is a file part of a request built by multipartRequest.
+type testFile struct {
+	name string
+	data []byte
+}
+
+// chdir changes into dir for the rest of the test. UploadDir and TempDir are
+// relative, so every test handler works in a directory of its own; tests
+// calling it must not run in parallel.
+func chdir(t testing.TB, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// newTestHandler returns a handler storing its files in a fresh temporary
+// directory, which the test is changed into.
+func newTestHandler(t testing.TB, cfg Config) *ApiHandler {
+	t.Helper()
+	chdir(t, t.TempDir())
+	h := NewAPIHandler(cfg).(*ApiHandler)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// newTestApp serves the upload and merge routes of h like main does.
+func newTestApp(h *ApiHandler) *fiber.App {
+	app := fiber.New()
+	app.Post("/upload-file", Recover(h.UploadFile))
+	app.Post("/manifest", Recover(h.UploadManifest))
+	app.Post("/merge-chunk", Recover(h.MergeChunks))
+	return app
+}
+
+// multipartRequest builds a chunk upload with the form fields and a "file"
+// part for every one of files.
+func multipartRequest(t *testing.T, fields map[string]string, files ...testFile) *http.Request {
+	t.Helper()
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range files {
+		part, err := form.CreateFormFile("file", file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(fiber.MethodPost, "/upload-file", body)
+	req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+	return req
+}
+
+// send runs req against app and returns the status and decoded JSON body.
+func send(t *testing.T, app *fiber.App, req *http.Request) (int, map[string]any) {
+	t.Helper()
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := map[string]any{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatalf("response is not JSON: %v: %s", err, data)
+		}
+	}
+	return resp.StatusCode, body
+}
+
+// uploadChunk uploads data as chunk index of fileName.
+func uploadChunk(t *testing.T, app *fiber.App, fileName string, index int, data []byte) (int, map[string]any) {
+	t.Helper()
+	req := multipartRequest(t, map[string]string{"chunk_index": strconv.Itoa(index)}, testFile{name: fileName, data: data})
+	return send(t, app, req)
+}
+
+// postJSON posts body as JSON to path, with the headers given as name and
+// value pairs.
+func postJSON(t *testing.T, app *fiber.App, path string, body any, headers ...string) (int, map[string]any) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(fiber.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return send(t, app, req)
+}
+
+// partFiles returns the part files in TempDir, sorted.
+func partFiles(t *testing.T) []string {
+	t.Helper()
+	parts, err := filepath.Glob(filepath.Join(TempDir, "*"+partSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(parts)
+	return parts
+}
+
+// storedFiles returns the names in UploadDir, sorted.
+func storedFiles(t *testing.T) []string {
+	t.Helper()
+	entries, err := os.ReadDir(UploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"os"
+	"strings"
+)
+
+// duplicateChunk reports whether chunk index of chunkKey is already stored
+// with the given size and client-supplied SHA-256, returning what was
+// recorded for it, when Config.IdempotentChunks is set. Only chunks received
+// since the upload was last merged are known, and their part file must still
+// be in place.
+func (h *ApiHandler) duplicateChunk(chunkKey string, index int, checksum string, size int64) (chunkInfo, bool) {
+	if !h.cfg.IdempotentChunks || checksum == "" {
+		return chunkInfo{}, false
+	}
+	stored, ok := h.progress.chunk(chunkKey, index)
+	if !ok || stored.size != size || !strings.EqualFold(stored.checksum, checksum) {
+		return chunkInfo{}, false
+	}
+	path, ok := h.chunks.path(chunkKey, index)
+	if !ok {
+		return chunkInfo{}, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != size {
+		return chunkInfo{}, false
+	}
+
+	return stored, true
+}
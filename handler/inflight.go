@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+	"sync"
+)
+
+// Duplicate chunk policies decide what happens to a chunk arriving while
+// the same chunk of the same upload is still being written, as happens when
+// clients retry aggressively in parallel.
+const (
+	// DuplicateChunksWrite writes every copy; the last complete one wins.
+	DuplicateChunksWrite = "write"
+	// DuplicateChunksReject refuses the later copies with 409.
+	DuplicateChunksReject = "reject"
+	// DuplicateChunksWait has the later copies wait for the first write and
+	// answers them with its result, without writing them.
+	DuplicateChunksWait = "wait"
+)
+
+// errChunkInFlight is returned for a chunk refused by DuplicateChunksReject.
+var errChunkInFlight = errors.New("chunk is already being uploaded")
+
+// chunkWrite is a chunk being written, with its result once done is closed.
+type chunkWrite struct {
+	done    chan struct{}
+	info    chunkInfo
+	message string
+	err     error
+}
+
+// inflightRegistry tracks the chunks being written by their part file.
+type inflightRegistry struct {
+	mu     sync.Mutex
+	writes map[string]*chunkWrite
+}
+
+func newInflightRegistry() *inflightRegistry {
+	return &inflightRegistry{writes: make(map[string]*chunkWrite)}
+}
+
+// begin registers a write of the part file path. It reports false with the
+// write in progress when there is one, which the caller must not duplicate.
+func (r *inflightRegistry) begin(path string) (*chunkWrite, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if write, ok := r.writes[path]; ok {
+		return write, false
+	}
+	write := &chunkWrite{done: make(chan struct{})}
+	r.writes[path] = write
+	return write, true
+}
+
+// finish records the result of write and removes it, releasing the copies
+// waiting for it.
+func (r *inflightRegistry) finish(path string, write *chunkWrite, info chunkInfo, message string, err error) {
+	r.mu.Lock()
+	delete(r.writes, path)
+	r.mu.Unlock()
+
+	write.info, write.message, write.err = info, message, err
+	close(write.done)
+}
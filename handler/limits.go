@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxMultipartOverhead is the room allowed on top of MaxChunkSize for the
+// multipart boundaries, part headers and form fields of a chunk upload.
+const maxMultipartOverhead = 64 * 1024
+
+// errChunkTooLarge is returned by maxBytesReader once the limit is exceeded.
+var errChunkTooLarge = errors.New("chunk exceeds the maximum chunk size")
+
+// maxBytesReader reads from r and fails with errChunkTooLarge as soon as more
+// than remaining bytes are read, unlike io.LimitReader which silently stops.
+type maxBytesReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.remaining < 0 {
+		return 0, errChunkTooLarge
+	}
+	// Read one byte past the limit so an exact fit is not mistaken for overflow
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n, errChunkTooLarge
+	}
+
+	return n, err
+}
+
+// chunkTooLarge answers a chunk above the configured maximum size.
+func chunkTooLarge(c *fiber.Ctx, maxSize int64) error {
+	return RespondError(c, ErrChunkTooLarge.With(fiber.Map{
+		"max_chunk_size": maxSize,
+	}))
+}
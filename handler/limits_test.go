@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUploadFileContentLengthTooLarge(t *testing.T) {
+	h := newTestHandler(t, Config{MaxChunkSize: 1024})
+	app := newTestApp(h)
+
+	// The body is not even a form, so only the pre-check can answer 413
+	body := bytes.Repeat([]byte("x"), 1024+maxMultipartOverhead+1)
+	req := httptest.NewRequest(fiber.MethodPost, "/upload-file", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+
+	status, resp := send(t, app, req)
+	if status != fiber.StatusRequestEntityTooLarge || resp["code"] != ErrChunkTooLarge.Code {
+		t.Fatalf("status %d: %v, want 413 %s", status, resp, ErrChunkTooLarge.Code)
+	}
+	if resp["max_chunk_size"] != float64(1024) {
+		t.Errorf("max_chunk_size = %v, want 1024", resp["max_chunk_size"])
+	}
+}
+
+func TestUploadFileChunkedTooLarge(t *testing.T) {
+	h := newTestHandler(t, Config{MaxChunkSize: 1024})
+	app := fiber.New()
+	app.Post("/upload-file", func(c *fiber.Ctx) error {
+		if length := c.Request().Header.ContentLength(); length >= 0 {
+			t.Errorf("request has a Content-Length of %d, want chunked transfer encoding", length)
+		}
+		return c.Next()
+	}, Recover(h.UploadFile))
+
+	req := multipartRequest(t, map[string]string{"chunk_index": "0"}, testFile{name: "big.bin", data: bytes.Repeat([]byte("x"), 2048)})
+	req.Body = io.NopCloser(req.Body)
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+
+	status, resp := send(t, app, req)
+	if status != fiber.StatusRequestEntityTooLarge || resp["code"] != ErrChunkTooLarge.Code {
+		t.Fatalf("status %d: %v, want 413 %s", status, resp, ErrChunkTooLarge.Code)
+	}
+	if parts := partFiles(t); len(parts) != 0 {
+		t.Errorf("part files stored for a rejected chunk: %v", parts)
+	}
+}
+
+func TestStoreChunkStopsPastMaxChunkSize(t *testing.T) {
+	h := newTestHandler(t, Config{MaxChunkSize: 1024})
+
+	// A source longer than declared is cut off while copying
+	tempFile := filepath.Join(TempDir, "oversized"+partSuffix)
+	_, _, err := h.storeChunk(bytes.NewReader(bytes.Repeat([]byte("x"), 2048)), 10, tempFile, nil)
+	if !errors.Is(err, errChunkTooLarge) {
+		t.Fatalf("err = %v, want errChunkTooLarge", err)
+	}
+	entries, err := os.ReadDir(TempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != chunkJournalName {
+			t.Errorf("%s left in the temp dir", entry.Name())
+		}
+	}
+}
+
+func TestMaxBytesReader(t *testing.T) {
+	data, err := io.ReadAll(&maxBytesReader{r: bytes.NewReader(make([]byte, 8)), remaining: 8})
+	if err != nil || len(data) != 8 {
+		t.Errorf("exact fit: read %d bytes, %v, want 8 bytes", len(data), err)
+	}
+
+	_, err = io.ReadAll(&maxBytesReader{r: bytes.NewReader(make([]byte, 9)), remaining: 8})
+	if !errors.Is(err, errChunkTooLarge) {
+		t.Errorf("one byte over: err = %v, want errChunkTooLarge", err)
+	}
+}
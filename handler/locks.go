@@ -0,0 +1,47 @@
+package handler
+
+import "sync"
+
+// keyedMutex hands out one mutex per key so operations on the same file are
+// serialized while operations on different files run in parallel. Entries are
+// reference counted and dropped once nobody holds or waits for them, so the
+// map only ever holds the keys in use rather than every file ever seen.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is the mutex of one key and the number of holders and waiters.
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]*keyedLock)}
+}
+
+// Lock blocks until the lock for key is held and returns the function that
+// releases it. The function must be called exactly once.
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
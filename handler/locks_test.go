@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestKeyedMutexDropsReleasedKeys(t *testing.T) {
+	k := newKeyedMutex()
+
+	const keys, holders = 500, 4
+	var wg sync.WaitGroup
+	for i := range keys {
+		for range holders {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				unlock := k.Lock(fmt.Sprintf("file-%d.bin", i))
+				unlock()
+			}()
+		}
+	}
+	wg.Wait()
+	if n := len(k.locks); n != 0 {
+		t.Errorf("%d lock entries left once every key was released, want 0", n)
+	}
+
+	// Held keys stay until their last holder lets go
+	first := k.Lock("held.bin")
+	second := make(chan func())
+	go func() { second <- k.Lock("held.bin") }()
+	for k.refs("held.bin") < 2 {
+		runtime.Gosched()
+	}
+	first()
+	if n := k.refs("held.bin"); n != 1 {
+		t.Errorf("key has %d references while a waiter holds it, want 1", n)
+	}
+	(<-second)()
+	if n := len(k.locks); n != 0 {
+		t.Errorf("%d lock entries after the last release, want 0", n)
+	}
+}
+
+// refs returns the holders and waiters of key.
+func (k *keyedMutex) refs(key string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if lock, ok := k.locks[key]; ok {
+		return lock.refs
+	}
+	return 0
+}
+
+func TestMergeResetsRegistries(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := newTestApp(h)
+
+	const files = 50
+	for i := range files {
+		fileName := fmt.Sprintf("file-%d.txt", i)
+		fields := map[string]string{"chunk_index": "0", "sequence": strconv.Itoa(i + 1)}
+		if status, body := send(t, app, multipartRequest(t, fields, testFile{name: fileName, data: []byte("content")})); status != fiber.StatusOK {
+			t.Fatalf("upload of %s: status %d: %v", fileName, status, body)
+		}
+	}
+	if n := len(h.progress.files); n != files {
+		t.Fatalf("progress tracks %d uploads, want %d", n, files)
+	}
+
+	for i := range files {
+		fileName := fmt.Sprintf("file-%d.txt", i)
+		if status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": fileName, "total_chunks": 1}); status != fiber.StatusOK {
+			t.Fatalf("merge of %s: status %d: %v", fileName, status, body)
+		}
+	}
+	if n := len(h.progress.files); n != 0 {
+		t.Errorf("progress tracks %d merged uploads, want 0", n)
+	}
+	if n := len(h.sequences.highest); n != 0 {
+		t.Errorf("sequences tracks %d merged uploads, want 0", n)
+	}
+	if n := len(h.fileLocks.locks); n != 0 {
+		t.Errorf("%d file locks left after the merges, want 0", n)
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// maintenanceState is a snapshot of maintenance mode. It is replaced as a
+// whole, so a write handler never sees the flag of one toggle with the
+// Retry-After of another.
+type maintenanceState struct {
+	Enabled    bool       `json:"enabled"`
+	RetryAfter int64      `json:"retry_after"`
+	Message    string     `json:"message,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// maintenanceMode holds the current maintenance state.
+type maintenanceMode struct {
+	state atomic.Pointer[maintenanceState]
+}
+
+func newMaintenanceMode(enabled bool, retryAfter time.Duration) *maintenanceMode {
+	m := &maintenanceMode{}
+	state := &maintenanceState{Enabled: enabled, RetryAfter: int64(retryAfter / time.Second)}
+	if enabled {
+		now := time.Now()
+		state.Since = &now
+	}
+	m.state.Store(state)
+	return m
+}
+
+func (m *maintenanceMode) current() *maintenanceState {
+	return m.state.Load()
+}
+
+// err returns the error endpoints that write answer with in state s, nil
+// while maintenance mode is off.
+func (s *maintenanceState) err() *Error {
+	if !s.Enabled {
+		return nil
+	}
+	err := ErrMaintenance.With(fiber.Map{"retry_after": s.RetryAfter})
+	if s.Message != "" {
+		err = err.WithMessage(s.Message)
+	}
+	return err
+}
+
+// maintenanceError returns the error endpoints that write answer with while
+// maintenance mode is on, nil while it is off.
+func (h *ApiHandler) maintenanceError() *Error {
+	return h.maintenance.current().err()
+}
+
+// checkMaintenance is maintenanceError for HTTP requests, also telling the
+// client when to retry. The error and the header come from one snapshot, so
+// they agree even while maintenance mode is toggled.
+func (h *ApiHandler) checkMaintenance(c *fiber.Ctx) *Error {
+	state := h.maintenance.current()
+	err := state.err()
+	if err != nil {
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(state.RetryAfter, 10))
+	}
+	return err
+}
+
+// Maintenance handles GET /maintenance, reporting whether maintenance mode is
+// on.
+func (h *ApiHandler) Maintenance(c *fiber.Ctx) error {
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":       false,
+		"maintenance": h.maintenance.current(),
+	})
+}
+
+// SetMaintenance handles POST /maintenance, turning maintenance mode on or
+// off at runtime. While it is on, uploads, merges and the other endpoints
+// that write are answered with 503; downloads, reads and health checks are
+// still served, and requests already running finish, so operators can drain
+// the writes before maintenance without stopping the server.
+func (h *ApiHandler) SetMaintenance(c *fiber.Ctx) error {
+	body := new(domain.MaintenanceRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+	if body.Enabled == nil {
+		return RespondError(c, ErrInvalidRequest.WithMessage("enabled is required"))
+	}
+
+	state := &maintenanceState{
+		Enabled:    *body.Enabled,
+		RetryAfter: int64(h.cfg.MaintenanceRetryAfter / time.Second),
+		Message:    body.Message,
+	}
+	if body.RetryAfter != nil {
+		if *body.RetryAfter < 0 {
+			return RespondError(c, ErrInvalidRequest.WithMessage("retry_after must not be negative"))
+		}
+		state.RetryAfter = *body.RetryAfter
+	}
+	if state.Enabled {
+		now := time.Now()
+		state.Since = &now
+		// Turning it on again keeps the time maintenance started
+		if previous := h.maintenance.current(); previous.Enabled {
+			state.Since = previous.Since
+		}
+	}
+	h.maintenance.state.Store(state)
+	if state.Enabled {
+		log.Printf("maintenance mode enabled by %s", clientIdentity(c))
+	} else {
+		log.Printf("maintenance mode disabled by %s", clientIdentity(c))
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":       false,
+		"maintenance": state,
+	})
+}
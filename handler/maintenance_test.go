@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckMaintenance(t *testing.T) {
+	tests := []struct {
+		name  string
+		state *maintenanceState
+		// retryAfter is the Retry-After header expected, empty for none
+		retryAfter string
+	}{
+		{name: "off", state: &maintenanceState{RetryAfter: 30}},
+		{name: "on", state: &maintenanceState{Enabled: true, RetryAfter: 600, Message: "Upgrading storage"}, retryAfter: "600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Config{})
+			app := fiber.New()
+			app.Post("/maintenance-check", func(c *fiber.Ctx) error {
+				if err := h.checkMaintenance(c); err != nil {
+					return RespondError(c, err)
+				}
+				return c.SendStatus(fiber.StatusNoContent)
+			})
+			h.maintenance.state.Store(tt.state)
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/maintenance-check", strings.NewReader("")), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if header := resp.Header.Get(fiber.HeaderRetryAfter); header != tt.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", header, tt.retryAfter)
+			}
+			if !tt.state.Enabled {
+				if resp.StatusCode != fiber.StatusNoContent {
+					t.Errorf("status %d with maintenance off, want 204", resp.StatusCode)
+				}
+				return
+			}
+
+			var body map[string]any
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusServiceUnavailable || body["code"] != ErrMaintenance.Code {
+				t.Fatalf("status %d: %v, want 503 %s", resp.StatusCode, body, ErrMaintenance.Code)
+			}
+			if body["retry_after"] != float64(tt.state.RetryAfter) || body["message"] != tt.state.Message {
+				t.Errorf("body = %v, want the retry_after and message of the state", body)
+			}
+		})
+	}
+}
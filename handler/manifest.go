@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// ManifestSuffix is appended to the chunk key to name the stored manifest in
+// the temp directory.
+const ManifestSuffix = ".manifest.json"
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// chunkManifest is the stored form of a manifest: the expected SHA-256 of
+// every chunk, in index order from the chunk base.
+type chunkManifest struct {
+	Chunks []string `json:"chunks"`
+}
+
+func manifestPath(chunkKey string) string {
+	return filepath.Join(TempDir, chunkKey+ManifestSuffix)
+}
+
+// readManifest loads the manifest of chunkKey, returning nil when the upload
+// has none.
+func readManifest(chunkKey string) (*chunkManifest, error) {
+	data, err := os.ReadFile(manifestPath(chunkKey))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	manifest := new(chunkManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("corrupt manifest for %s: %w", chunkKey, err)
+	}
+
+	return manifest, nil
+}
+
+// removeManifest deletes the manifest of chunkKey once its chunks are merged.
+func removeManifest(chunkKey string) error {
+	if err := os.Remove(manifestPath(chunkKey)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// verifyManifest checks every chunk of chunkKey against the manifest and
+// returns the indices that do not match along with each chunk's checksum
+// (empty for chunks that could not be read). The checksums computed while
+// the chunks were uploaded are used when known, so only chunks from before a
+// restart are hashed here, streamed from disk so the check holds no chunk in
+// memory. Chunks that cannot be read are left to the merge to report.
+func (h *ApiHandler) verifyManifest(manifest *chunkManifest, chunkKey string) ([]int, []string) {
+	mismatched := []int{}
+	checksums := make([]string, len(manifest.Chunks))
+	for i, expected := range manifest.Chunks {
+		index := h.cfg.ChunkBase + i
+		checksum, ok := h.progress.checksum(chunkKey, index)
+		if !ok {
+			path, _ := h.chunks.path(chunkKey, index)
+			h.openChunks <- struct{}{}
+			_, sum, err := checksumFile(path, h.cfg.BufferSize)
+			<-h.openChunks
+			if err != nil {
+				continue
+			}
+			checksum = sum
+		}
+		if !strings.EqualFold(checksum, expected) {
+			mismatched = append(mismatched, index)
+		}
+		checksums[i] = checksum
+	}
+
+	return mismatched, checksums
+}
+
+// UploadManifest handles POST /manifest, storing the expected SHA-256 of each
+// chunk of an upload. The next merge verifies every chunk against it before
+// writing anything and then removes it.
+func (h *ApiHandler) UploadManifest(c *fiber.Ctx) error {
+	if err := h.checkMaintenance(c); err != nil {
+		return RespondError(c, err)
+	}
+
+	body := new(domain.ChunkManifestRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+
+	fileName, chunkKey, err := h.resolveUpload(body.UploadID, body.FileName)
+	if err != nil {
+		return RespondError(c, err)
+	}
+	if !validFileName(fileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+	if len(body.Chunks) == 0 {
+		return RespondError(c, ErrInvalidRequest.WithMessage("chunks must list the SHA-256 of every chunk"))
+	}
+	for i, checksum := range body.Chunks {
+		if !sha256Hex.MatchString(checksum) {
+			return RespondError(c, ErrInvalidRequest.WithMessage(fmt.Sprintf("Chunk %d is not a hex encoded SHA-256", h.cfg.ChunkBase+i)))
+		}
+	}
+
+	if err := os.MkdirAll(TempDir, os.ModePerm); err != nil {
+		return storageError(c, "Failed to store manifest", err)
+	}
+	data, err := json.Marshal(chunkManifest{Chunks: body.Chunks})
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to encode manifest").Wrap(err))
+	}
+	// Replace atomically so a merge never reads a half-written manifest
+	tmp := manifestPath(chunkKey) + ".tmp"
+	if err := writeFileNoFollow(tmp, data, 0o644); err != nil {
+		return storageError(c, "Failed to store manifest", err)
+	}
+	if err := os.Rename(tmp, manifestPath(chunkKey)); err != nil {
+		return storageError(c, "Failed to store manifest", err)
+	}
+
+	return Respond(c, fiber.StatusCreated, fiber.Map{
+		"error":   false,
+		"message": "Manifest stored",
+		"file":    fileName,
+		"chunks":  len(body.Chunks),
+	})
+}
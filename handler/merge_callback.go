@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"log"
+	"runtime/debug"
+
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// mergeComplete calls Config.OnMergeComplete for the stored fileName. The
+// file is already stored when it runs, so a panicking callback is logged
+// with its stack and the merge still succeeds.
+func (h *ApiHandler) mergeComplete(fileName string, size int64, checksum string) {
+	if h.cfg.OnMergeComplete == nil {
+		return
+	}
+	completion := domain.MergeCompletion{
+		FileName: fileName,
+		Size:     size,
+		Checksum: checksum,
+	}
+	if h.cfg.MultipartStorage == nil {
+		completion.Path = h.filePath(fileName)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("merge completion callback panicked for %s: %v\n%s", fileName, r, debug.Stack())
+		}
+	}()
+	h.cfg.OnMergeComplete(completion)
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+func TestMergeCompletePanicLogsStack(t *testing.T) {
+	output := captureLog(t)
+	h := newTestHandler(t, Config{OnMergeComplete: func(domain.MergeCompletion) {
+		panic("callback bug")
+	}})
+	app := newTestApp(h)
+
+	if status, body := uploadChunk(t, app, "done.txt", 0, []byte("content")); status != fiber.StatusOK {
+		t.Fatalf("upload: status %d: %v", status, body)
+	}
+	// The file is stored before the callback runs, so its panic does not
+	// fail the merge
+	if status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "done.txt", "total_chunks": 1}); status != fiber.StatusOK {
+		t.Fatalf("merge: status %d: %v", status, body)
+	}
+
+	logged := output.String()
+	for _, want := range []string{"merge completion callback panicked for done.txt: callback bug", "goroutine ", "runtime/debug.Stack"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log lacks %q:\n%s", want, logged)
+		}
+	}
+}
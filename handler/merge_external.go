@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// chunkNumber finds the last number in an external chunk's name, which
+// orders the chunks a pattern matches: "video.part10", "chunk_0003.bin".
+var chunkNumber = regexp.MustCompile(`(\d+)\D*$`)
+
+// externalChunk is a chunk file placed in the temp directory out-of-band.
+type externalChunk struct {
+	name string
+	size int64
+}
+
+// MergeExternal handles POST /merge-external, assembling a file from chunk
+// files that reached the temp directory without going through UploadFile,
+// e.g. copied there by a sidecar or rsync. The chunks are named in order, or
+// matched by a glob and ordered by the number their names end in, which must
+// then run without gaps. The files of uploads in progress and the server's
+// own bookkeeping files can never be merged this way.
+func (h *ApiHandler) MergeExternal(c *fiber.Ctx) error {
+	if err := h.checkMaintenance(c); err != nil {
+		return RespondError(c, err)
+	}
+
+	started := time.Now()
+
+	body := new(domain.MergeExternalRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+	if !validFileName(body.FileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+	if err := validateMetadata(body.Metadata); err != nil {
+		return RespondError(c, ErrInvalidRequest.WithMessage("Invalid metadata").Wrap(err))
+	}
+	if (len(body.Chunks) == 0) == (body.Pattern == "") {
+		return RespondError(c, ErrInvalidRequest.WithMessage("Exactly one of chunks and pattern is required"))
+	}
+
+	names := body.Chunks
+	if body.Pattern != "" {
+		var err error
+		if names, err = h.matchExternalChunks(body.Pattern); err != nil {
+			return RespondError(c, err)
+		}
+	}
+	chunks, err := h.statExternalChunks(names)
+	if err != nil {
+		return RespondError(c, err)
+	}
+
+	var total int64
+	for _, chunk := range chunks {
+		total += chunk.size
+	}
+	if body.TotalSize != nil && total != *body.TotalSize {
+		return RespondError(c, ErrSizeMismatch.With(fiber.Map{
+			"expected_size":   *body.TotalSize,
+			"actual_size":     total,
+			"last_chunk_size": chunks[len(chunks)-1].size,
+		}))
+	}
+
+	fileName, nameErr := h.storedName(body.FileName)
+	if nameErr != nil {
+		return RespondError(c, nameErr)
+	}
+	select {
+	case h.mergeSlots <- struct{}{}:
+		defer func() { <-h.mergeSlots }()
+	default:
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return RespondError(c, ErrBusy)
+	}
+	unlock := h.lockFile(fileName)
+	defer unlock()
+
+	run := &mergeRun{client: clientIdentity(c)}
+	output, size, sums, err := h.writeExternal(run, fileName, chunks)
+	if errors.Is(err, errFileExists) {
+		h.mergeFailed(run, fileName, err)
+		return RespondError(c, fileExistsError(fileName, err))
+	}
+	if err != nil {
+		h.mergeFailed(run, fileName, err)
+		return storageError(c, "Failed to merge external chunks", err)
+	}
+	outName := output.name
+
+	checksum := sums[HashSHA256]
+	if err := h.storeObject(h.filePath(outName), checksum); err != nil {
+		h.mergeFailed(run, fileName, err)
+		return storageError(c, "Failed to store object", err)
+	}
+	meta, err := h.storeMetadata(outName, body.FileName, size, sums, body.Metadata, false, false)
+	if err != nil {
+		h.mergeFailed(run, fileName, err)
+		return RespondError(c, ErrInternal.WithMessage("Failed to write file metadata").Wrap(err))
+	}
+	h.chownStored(run, outName)
+	sizes := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		sizes[i] = chunk.size
+	}
+	h.writeMergeLog(run, &domain.MergeLog{
+		FileName:   outName,
+		ChunkCount: len(chunks),
+		ChunkSizes: sizes,
+		Appended:   size,
+		Size:       size,
+		Checksum:   checksum,
+		StartedAt:  started,
+		DurationMs: time.Since(started).Milliseconds(),
+	})
+
+	if !body.RetainChunks {
+		for _, chunk := range chunks {
+			if err := os.Remove(filepath.Join(TempDir, chunk.name)); err != nil && !os.IsNotExist(err) {
+				run.warn("failed to remove external chunk %s: %v", chunk.name, err)
+			}
+		}
+	}
+
+	c.Set(fiber.HeaderETag, formatETag(checksum))
+	h.stats.fileStored(size, output.replacing, output.replaced)
+	h.mergeSucceeded(run, outName, size, checksum)
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":    false,
+		"message":  "Chunks merged successfully",
+		"file":     outName,
+		"size":     size,
+		"chunks":   len(chunks),
+		"checksum": checksum,
+		"digests":  sums,
+		"metadata": meta.Metadata,
+	})
+}
+
+// matchExternalChunks returns the temp directory files matching pattern,
+// ordered by the number their names end in.
+func (h *ApiHandler) matchExternalChunks(pattern string) ([]string, error) {
+	if strings.ContainsAny(pattern, "/\\") {
+		return nil, ErrInvalidRequest.WithMessage("pattern must match file names in the temp directory, not paths")
+	}
+	paths, err := filepath.Glob(filepath.Join(TempDir, pattern))
+	if err != nil {
+		return nil, ErrInvalidRequest.WithMessage("Invalid pattern").Wrap(err)
+	}
+
+	type numbered struct {
+		name   string
+		number int
+	}
+	var matches []numbered
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if !h.externalChunkName(name) {
+			continue
+		}
+		digits := chunkNumber.FindStringSubmatch(name)
+		if digits == nil {
+			return nil, ErrInvalidRequest.WithMessage(fmt.Sprintf("Chunk %s has no number to order it by", name))
+		}
+		number, err := strconv.Atoi(digits[1])
+		if err != nil {
+			return nil, ErrInvalidRequest.WithMessage(fmt.Sprintf("Chunk %s has no number to order it by", name)).Wrap(err)
+		}
+		matches = append(matches, numbered{name: name, number: number})
+	}
+	if len(matches) == 0 {
+		return nil, ErrNotFound.WithMessage("No chunks match the pattern")
+	}
+	slices.SortFunc(matches, func(a, b numbered) int { return a.number - b.number })
+
+	names := make([]string, len(matches))
+	missing := []int{}
+	for i, match := range matches {
+		names[i] = match.name
+		if i == 0 {
+			continue
+		}
+		previous := matches[i-1].number
+		if match.number == previous {
+			return nil, ErrInvalidRequest.WithMessage(fmt.Sprintf("Chunks %s and %s have the same number", matches[i-1].name, match.name))
+		}
+		for number := previous + 1; number < match.number; number++ {
+			missing = append(missing, number)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, ErrChunkMissing.With(fiber.Map{
+			"missing_chunks": missing,
+		})
+	}
+
+	return names, nil
+}
+
+// statExternalChunks checks that every named chunk is a regular file in the
+// temp directory and returns the chunks with their sizes, in order.
+func (h *ApiHandler) statExternalChunks(names []string) ([]externalChunk, error) {
+	chunks := make([]externalChunk, 0, len(names))
+	missing := []string{}
+	for _, name := range names {
+		if !h.externalChunkName(name) {
+			return nil, ErrInvalidRequest.WithMessage(fmt.Sprintf("%q cannot be merged as an external chunk", name))
+		}
+		// Lstat, so a symlink cannot pull in a file from outside the temp directory
+		info, err := os.Lstat(filepath.Join(TempDir, name))
+		if os.IsNotExist(err) {
+			missing = append(missing, name)
+			continue
+		}
+		if err != nil {
+			return nil, ErrInternal.WithMessage("Failed to inspect chunks").Wrap(err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, ErrInvalidRequest.WithMessage(fmt.Sprintf("%s is not a regular file", name))
+		}
+		chunks = append(chunks, externalChunk{name: name, size: info.Size()})
+	}
+	if len(missing) > 0 {
+		return nil, ErrChunkMissing.With(fiber.Map{
+			"missing_chunks": missing,
+		})
+	}
+
+	return chunks, nil
+}
+
+// externalChunkName reports whether the temp directory file name may be
+// merged as an external chunk: not a part file of an upload in progress and
+// none of the journal, manifests, range uploads or staging files.
+func (h *ApiHandler) externalChunkName(name string) bool {
+	if !validFileName(name) || strings.HasPrefix(name, chunkJournalName) {
+		return false
+	}
+	for _, suffix := range []string{ManifestSuffix, ".range", ".tmp"} {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	return !h.chunks.owned(name)
+}
+
+// writeExternal streams chunks into a new output file for fileName, named by
+// the collision policy, and returns the committed output, its size and
+// digests. A failed merge leaves no output behind.
+func (h *ApiHandler) writeExternal(run *mergeRun, fileName string, chunks []externalChunk) (*mergeOutput, int64, map[string]string, error) {
+	output, err := h.openOutput(fileName, false, false)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer output.Close()
+	outName := output.name
+	merged := false
+	defer func() {
+		if !merged {
+			if err := output.discard(); err != nil {
+				log.Printf("failed to remove partial output %s: %v", outName, err)
+			}
+		}
+	}()
+
+	digests := h.newDigester()
+	writers := []io.Writer{output, digests}
+	mirror, err := h.openMirror(run, outName)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if mirror != nil {
+		defer mirror.abort()
+		writers = append(writers, mirror)
+	}
+
+	buf := getBuffer(h.cfg.BufferSize)
+	defer putBuffer(buf)
+
+	writer := io.MultiWriter(writers...)
+	var size int64
+	for _, chunk := range chunks {
+		n, err := copyChunk(writer, filepath.Join(TempDir, chunk.name), *buf)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to copy chunk %s: %w", chunk.name, err)
+		}
+		size += n
+	}
+	if err := output.Close(); err != nil {
+		return nil, 0, nil, err
+	}
+	if err := h.finishMirror(run, mirror, outName); err != nil {
+		return nil, 0, nil, err
+	}
+	if err := output.commit(); err != nil {
+		return nil, 0, nil, err
+	}
+
+	merged = true
+	return output, size, digests.sums(), nil
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// placeExternal writes the chunk files into the temp directory the way an
+// out-of-band copy would, each holding its own name.
+func placeExternal(t *testing.T, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(TempDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(TempDir, name), []byte(name+";"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newExternalApp serves the routes of h for external merges.
+func newExternalApp(h *ApiHandler) *fiber.App {
+	app := newTestApp(h)
+	app.Post("/merge-external", Recover(h.MergeExternal))
+	return app
+}
+
+func TestMergeExternalOrdersByNumber(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := newExternalApp(h)
+	// Sorted as strings, part10 would come before part2
+	var want string
+	for number := 1; number <= 10; number++ {
+		name := "video.part" + strconv.Itoa(number)
+		placeExternal(t, name)
+		want += name + ";"
+	}
+	// The part file of an upload in progress and the chunk journal match
+	// the pattern too, but are never merged
+	if status, body := uploadChunk(t, app, "video.part", 0, []byte("in progress")); status != fiber.StatusOK {
+		t.Fatalf("upload: status %d: %v", status, body)
+	}
+
+	status, body := postJSON(t, app, "/merge-external", map[string]any{"file_name": "video.mp4", "pattern": "*"})
+	if status != fiber.StatusOK || body["chunks"] != float64(10) {
+		t.Fatalf("status %d: %v, want 200 with 10 chunks", status, body)
+	}
+	if data, err := os.ReadFile(h.filePath("video.mp4")); err != nil || string(data) != want {
+		t.Errorf("video.mp4 holds %q, %v, want %q", data, err, want)
+	}
+	if parts := partFiles(t); len(parts) != 1 {
+		t.Errorf("part files = %v, want the upload in progress kept", parts)
+	}
+}
+
+func TestMergeExternalRefusesUnorderedChunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		request map[string]any
+		status  int
+		code    string
+		missing any
+	}{
+		{
+			name:    "gaps",
+			files:   []string{"data_0001.bin", "data_0002.bin", "data_0005.bin"},
+			request: map[string]any{"pattern": "data_*.bin"},
+			status:  fiber.StatusConflict,
+			code:    ErrChunkMissing.Code,
+			missing: []any{float64(3), float64(4)},
+		},
+		{
+			name:    "same number",
+			files:   []string{"data_1.bin", "data_01.bin", "data_2.bin"},
+			request: map[string]any{"pattern": "data_*.bin"},
+			status:  fiber.StatusBadRequest,
+			code:    ErrInvalidRequest.Code,
+		},
+		{
+			name:    "no number",
+			files:   []string{"data_1.bin", "data_last.bin"},
+			request: map[string]any{"pattern": "data_*.bin"},
+			status:  fiber.StatusBadRequest,
+			code:    ErrInvalidRequest.Code,
+		},
+		{
+			name:    "nothing matched",
+			request: map[string]any{"pattern": "data_*.bin"},
+			status:  fiber.StatusNotFound,
+			code:    ErrNotFound.Code,
+		},
+		{
+			name:    "path in pattern",
+			request: map[string]any{"pattern": "../uploads/*"},
+			status:  fiber.StatusBadRequest,
+			code:    ErrInvalidRequest.Code,
+		},
+		{
+			name:    "listed chunks missing",
+			files:   []string{"a.bin"},
+			request: map[string]any{"chunks": []string{"a.bin", "b.bin", "c.bin"}},
+			status:  fiber.StatusConflict,
+			code:    ErrChunkMissing.Code,
+			missing: []any{"b.bin", "c.bin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Config{})
+			app := newExternalApp(h)
+			placeExternal(t, tt.files...)
+
+			tt.request["file_name"] = "out.bin"
+			status, body := postJSON(t, app, "/merge-external", tt.request)
+			if status != tt.status || body["code"] != tt.code {
+				t.Fatalf("status %d: %v, want %d %s", status, body, tt.status, tt.code)
+			}
+			if tt.missing != nil && !reflect.DeepEqual(body["missing_chunks"], tt.missing) {
+				t.Errorf("missing_chunks = %v, want %v", body["missing_chunks"], tt.missing)
+			}
+			if _, err := os.Stat(h.filePath("out.bin")); !os.IsNotExist(err) {
+				t.Errorf("refused merge stored the output: %v", err)
+			}
+			for _, name := range tt.files {
+				if _, err := os.Stat(filepath.Join(TempDir, name)); err != nil {
+					t.Errorf("refused merge removed %s: %v", name, err)
+				}
+			}
+		})
+	}
+}
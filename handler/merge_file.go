@@ -0,0 +1,557 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mergeChunkError is a chunk of a merge that could not be read or written.
+type mergeChunkError struct {
+	// op is "read" or "write"
+	op    string
+	index int
+	err   error
+}
+
+func (e *mergeChunkError) Error() string {
+	return fmt.Sprintf("failed to %s chunk %d: %v", e.op, e.index, e.err)
+}
+
+func (e *mergeChunkError) Unwrap() error {
+	return e.err
+}
+
+// MergeFile merges the chunks of the upload req names into a stored file
+// with the checks and side effects of POST /merge-chunk, for other
+// transports and background jobs: preconditions, the manifest, the collision
+// policy, the mirror, metadata, the audit log and webhook, and the cleanup
+// of the chunks. Previews, dry runs and multi-source merges are only
+// available over HTTP. Errors are *Error values, with internal details
+// already removed when Config.HideErrorDetails is set.
+func (h *ApiHandler) MergeFile(ctx context.Context, req domain.MergeChunksRequest) (domain.MergeResult, error) {
+	ctx, span := h.tracer.Start(ctx, "MergeFile")
+	defer span.End()
+
+	result, err := h.mergeFileRequest(ctx, &req)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && h.cfg.HideErrorDetails && apiErr.Err != nil {
+		log.Printf("merge of %s failed: %v", req.FileName, err)
+		err = apiErr.Wrap(nil)
+	}
+	return result, err
+}
+
+func (h *ApiHandler) mergeFileRequest(ctx context.Context, req *domain.MergeChunksRequest) (domain.MergeResult, error) {
+	if err := h.maintenanceError(); err != nil {
+		return domain.MergeResult{}, err
+	}
+	if req.DryRun || req.From != nil || req.To != nil || len(req.Sources) > 0 {
+		return domain.MergeResult{}, ErrInvalidRequest.WithMessage("dry_run, from, to and sources are only available over HTTP")
+	}
+	return h.mergeFile(ctx, req, time.Now())
+}
+
+// prepareMerge resolves and validates the upload req merges and switches
+// req.FileName to the name it is stored under, which everything after it
+// uses. It returns the upload's chunk key and the name the client sent,
+// which is kept in the metadata.
+func (h *ApiHandler) prepareMerge(ctx context.Context, req *domain.MergeChunksRequest) (string, string, error) {
+	fileName, chunkKey, err := h.resolveUpload(req.UploadID, req.FileName)
+	if err != nil {
+		return "", "", err
+	}
+	req.FileName = fileName
+	trace.SpanFromContext(ctx).SetAttributes(attrFileName.String(fileName), attrUploadID.String(req.UploadID), attrTotalChunks.Int(req.TotalChunks))
+
+	if !validFileName(req.FileName) {
+		return "", "", ErrInvalidFileName
+	}
+	if err := validateMetadata(req.Metadata); err != nil {
+		return "", "", ErrInvalidRequest.WithMessage("Invalid metadata").Wrap(err)
+	}
+	if req.TotalChunks < 0 {
+		return "", "", ErrInvalidRequest.WithMessage("total_chunks must not be negative")
+	}
+	// Objects of the content layout may be shared by several names and never
+	// change, so there is nothing to append to
+	if req.Append && h.cfg.StorageLayout == StorageLayoutContent {
+		return "", "", ErrInvalidRequest.WithMessage("append is not available with content-addressed storage")
+	}
+
+	originalName := req.FileName
+	storedName, nameErr := h.storedName(req.FileName)
+	if nameErr != nil {
+		return "", "", nameErr
+	}
+	req.FileName = storedName
+	return chunkKey, originalName, nil
+}
+
+// acquireMerge takes one of the merge slots, which bound the merges running
+// at once since each reads all its chunks concurrently. It fails with
+// ErrBusy when none is free; release gives the slot back.
+func (h *ApiHandler) acquireMerge() (release func(), err error) {
+	select {
+	case h.mergeSlots <- struct{}{}:
+		return func() { <-h.mergeSlots }, nil
+	default:
+		return nil, ErrBusy
+	}
+}
+
+// mergeFile is MergeFile for a request that is neither a preview, a dry run
+// nor a multi-source merge, started at started.
+func (h *ApiHandler) mergeFile(ctx context.Context, req *domain.MergeChunksRequest, started time.Time) (domain.MergeResult, error) {
+	chunkKey, originalName, err := h.prepareMerge(ctx, req)
+	if err != nil {
+		return domain.MergeResult{}, err
+	}
+	release, err := h.acquireMerge()
+	if err != nil {
+		return domain.MergeResult{}, err
+	}
+	defer release()
+
+	// Serialize merges of the same file so the precondition check below and
+	// the replacement of the file happen atomically
+	unlock := h.lockFile(req.FileName)
+	defer unlock()
+	run := h.beginMerge(req, started)
+
+	// In multipart mode the parts already live in the object store
+	if h.cfg.MultipartStorage != nil {
+		return h.completeMultipart(ctx, run, req, chunkKey)
+	}
+
+	outPath := h.filePath(req.FileName)
+	if req.IfMatch != "" || req.IfNoneMatch != "" {
+		etag, err := h.currentETag(req.FileName)
+		if err != nil {
+			return domain.MergeResult{}, ErrInternal.WithMessage("Failed to read current file").Wrap(err)
+		}
+		if !preconditionsMet(req.IfMatch, req.IfNoneMatch, etag) {
+			return domain.MergeResult{}, ErrPreconditionFailed.With(fiber.Map{
+				"etag": etag,
+			})
+		}
+	}
+
+	// Make sure every chunk is present before creating the output file.
+	// A zero-length part file is a valid (empty) chunk, e.g. the last chunk
+	// of a file whose size is an exact multiple of the chunk size.
+	sizes, missing, err := h.inspectChunks(chunkKey, h.cfg.ChunkBase, req.TotalChunks)
+	if err != nil {
+		h.mergeFailed(run, req.FileName, err)
+		return domain.MergeResult{}, ErrInternal.WithMessage("Failed to inspect chunks").Wrap(err)
+	}
+	report := run.report
+	h.reportChunks(report, chunkKey, sizes)
+	if len(missing) > 0 {
+		return domain.MergeResult{}, h.missingChunks(run, req, missing)
+	}
+	problems, err := h.validateChunks(req, chunkKey, sizes, report)
+	if err != nil {
+		h.mergeFailed(run, req.FileName, err)
+		return domain.MergeResult{}, ErrInternal.WithMessage("Failed to read manifest").Wrap(err)
+	}
+	if len(problems) > 0 {
+		h.mergeFailed(run, req.FileName, problems[0].cause)
+		return domain.MergeResult{}, problems[0].err
+	}
+
+	// Create the output file where all chunks will be merged, or in append
+	// mode open the existing one so the chunks are streamed onto its end
+	existed, err := fileExists(outPath)
+	if err != nil {
+		h.mergeFailed(run, req.FileName, err)
+		return domain.MergeResult{}, storageFailure("Failed to inspect output file", err)
+	}
+	output, err := h.openOutput(req.FileName, req.Append, req.IfMatch != "")
+	if errors.Is(err, errFileExists) {
+		h.mergeFailed(run, req.FileName, err)
+		return domain.MergeResult{}, fileExistsError(req.FileName, err)
+	}
+	if err != nil {
+		h.mergeFailed(run, req.FileName, err)
+		return domain.MergeResult{}, storageFailure("Failed to create output file", err)
+	}
+	defer output.Close()
+	outputFile, outName := output.File, output.name
+
+	// If any step below fails, undo what was written so no partial file is
+	// left behind: an append is cut back to the original end, anything else
+	// is removed. A replaced file is only touched by the final commit
+	var originalSize int64
+	if req.Append {
+		if info, err := outputFile.Stat(); err == nil {
+			originalSize = info.Size()
+		}
+	}
+	merged := false
+	defer func() {
+		if merged {
+			return
+		}
+		if req.Append && existed {
+			if err := outputFile.Truncate(originalSize); err != nil {
+				log.Printf("failed to roll back append to %s: %v", outName, err)
+			}
+			return
+		}
+		if err := output.discard(); err != nil {
+			log.Printf("failed to remove partial output %s: %v", outName, err)
+		}
+	}()
+
+	// The chunks were all measured above, so the final size is known
+	if err := h.preallocateOutput(outputFile, sumSizes(sizes)); err != nil {
+		h.mergeFailed(run, req.FileName, err)
+		if errors.Is(err, errNoSpace) {
+			return domain.MergeResult{}, ErrStorageFull.WithMessage("Not enough disk space for the merged file").With(fiber.Map{
+				"size": sumSizes(sizes),
+			})
+		}
+		return domain.MergeResult{}, storageFailure("Failed to allocate output file", err)
+	}
+
+	// Tee the stream to the mirror storage too. Appends are mirrored whole
+	// once done since the stream only carries the appended bytes
+	var mirror *mirrorWriter
+	var tee io.Writer
+	if !req.Append {
+		mirror, err = h.openMirror(run, outName)
+		if err != nil {
+			h.mergeFailed(run, req.FileName, err)
+			return domain.MergeResult{}, ErrInternal.WithMessage("Failed to open mirror destination").Wrap(err)
+		}
+		if mirror != nil {
+			defer mirror.abort()
+			tee = mirror
+		}
+	}
+	result, err := h.assemble(ctx, chunkKey, req.TotalChunks, outputFile, tee)
+	for _, warning := range result.Warnings {
+		run.warn("%s: %s", req.FileName, warning)
+	}
+	if err != nil {
+		h.mergeFailed(run, req.FileName, err)
+		var chunkErr *mergeChunkError
+		switch {
+		case !errors.As(err, &chunkErr):
+			return domain.MergeResult{}, ErrInternal.WithMessage("Failed to merge chunks").Wrap(err)
+		case chunkErr.op == "write":
+			return domain.MergeResult{}, ErrInternal.WithMessage(fmt.Sprintf("Failed to write chunk %d to output file", chunkErr.index)).Wrap(chunkErr.err)
+		case tooManyOpenFiles(err):
+			return domain.MergeResult{}, ErrTooManyOpenFiles.Wrap(err)
+		}
+		return domain.MergeResult{}, ErrInternal.WithMessage(fmt.Sprintf("Failed to read chunk %d", chunkErr.index)).Wrap(chunkErr.err)
+	}
+	result.FileName = outName
+	result.Appended = result.Size
+
+	if err := h.finishMirror(run, mirror, outName); err != nil {
+		h.mergeFailed(run, req.FileName, err)
+		return domain.MergeResult{}, ErrInternal.WithMessage("Failed to write mirror destination").Wrap(err)
+	}
+
+	// The streamed hash only covers the appended bytes, so the whole file is
+	// hashed again to get the size and ETag of the grown file
+	if req.Append {
+		result.Size, result.Digests, err = h.digestFile(outPath)
+		if err != nil {
+			h.mergeFailed(run, req.FileName, err)
+			return domain.MergeResult{}, ErrInternal.WithMessage("Failed to checksum appended file").Wrap(err)
+		}
+
+		if err := h.mirrorFile(run, outName); err != nil {
+			h.mergeFailed(run, req.FileName, err)
+			return domain.MergeResult{}, ErrInternal.WithMessage("Failed to write mirror destination").Wrap(err)
+		}
+	}
+
+	// A one-time file never becomes an object: objects outlive their
+	// names and would keep serving it after its download
+	checksum := result.Digests[HashSHA256]
+	if !req.DownloadOnce {
+		if err := h.storeObject(output.writtenPath(), checksum); err != nil {
+			h.mergeFailed(run, req.FileName, err)
+			return domain.MergeResult{}, storageFailure("Failed to store object", err)
+		}
+	}
+	// The sidecar is written before the file replaces the stored one, and
+	// the replaced file's sidecar is put back should that fail
+	var replaced *domain.FileMetadata
+	if output.temp {
+		replaced, _ = h.readMetadata(outName)
+	}
+	meta, err := h.storeMetadata(outName, originalName, result.Size, result.Digests, req.Metadata, req.Append, req.DownloadOnce)
+	if err != nil {
+		h.mergeFailed(run, req.FileName, err)
+		return domain.MergeResult{}, ErrInternal.WithMessage("Failed to write file metadata").Wrap(err)
+	}
+	if err := output.commit(); err != nil {
+		h.restoreMetadata(outName, replaced)
+		h.mergeFailed(run, req.FileName, err)
+		return domain.MergeResult{}, storageFailure("Failed to replace stored file", err)
+	}
+	result.Metadata = meta.Metadata
+	// The file and its metadata are complete; later failures keep them
+	merged = true
+	h.chownStored(run, outName)
+	h.writeMergeLog(run, &domain.MergeLog{
+		FileName:   outName,
+		ChunkCount: req.TotalChunks,
+		ChunkSizes: sizes,
+		Appended:   result.Appended,
+		Size:       result.Size,
+		Checksum:   checksum,
+		StartedAt:  started,
+		DurationMs: time.Since(started).Milliseconds(),
+		Append:     req.Append,
+		UploadID:   req.UploadID,
+	})
+
+	// Only now that the file is complete are the chunks removed, so a merge
+	// failing at any earlier step can simply be retried. Retained chunks are
+	// left for the sweeper once the retention expires
+	if !req.RetainChunks {
+		err := h.cleanUpTempFiles(chunkKey)
+		if err == nil {
+			err = removeManifest(chunkKey)
+		}
+		if err != nil {
+			h.mergeFailed(run, req.FileName, err)
+			return domain.MergeResult{}, ErrInternal.WithMessage("Failed to clean up temporary files").Wrap(err)
+		}
+	}
+
+	// A preview of the upload is superseded by the complete file
+	if err := os.Remove(previewPath(req.FileName)); err != nil && !os.IsNotExist(err) {
+		run.warn("failed to remove preview of %s: %v", req.FileName, err)
+	}
+
+	// The chunks have been consumed, so the next upload of this name starts from zero
+	h.progress.reset(chunkKey)
+	h.sequences.reset(chunkKey)
+	if req.UploadID != "" && !req.RetainChunks {
+		h.sessions.remove(req.UploadID) // Retained chunks may still be merged again
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attrSize.Int64(result.Size))
+	h.stats.fileStored(result.Size, output.replacing, output.replaced)
+	h.mergeSucceeded(run, outName, result.Size, checksum)
+
+	return result, nil
+}
+
+// assemble writes chunks [ChunkBase, ChunkBase+totalChunks) of the upload
+// stored under key, its file name or upload ID, to w in index order and
+// returns their size and digests, passing every chunk written to w on to tee
+// when it is not nil. The chunks are left in place, and checking that they
+// are all present is up to the caller. When w is an *os.File, failed writes
+// are retried like a merge's.
+func (h *ApiHandler) assemble(ctx context.Context, key string, totalChunks int, w io.Writer, tee io.Writer) (domain.MergeResult, error) {
+	result := domain.MergeResult{Warnings: []string{}}
+
+	// A file output can be cut back to where a chunk started, so a failed
+	// write of it can be retried. Appends start at the end of the file
+	output, retryable := w.(*os.File)
+	var offset int64
+	if retryable {
+		info, err := output.Stat()
+		if err != nil {
+			return result, err
+		}
+		offset = info.Size()
+	}
+
+	// Each chunk gets its own buffered channel so the readers never block
+	// and the writer below can consume them strictly in index order
+	// results[i] holds chunk ChunkBase+i
+	results := make([]chan chunkResult, totalChunks)
+	for i := range results {
+		results[i] = make(chan chunkResult, 1)
+	}
+
+	// Chunks are read concurrently, but at most MergeReadAhead of them may be
+	// read and not yet written: a reader takes a token before it starts and
+	// the writer gives it back once the chunk is on disk. When the disk is the
+	// bottleneck the readers wait instead of piling chunks up in memory.
+	// Tokens are taken in index order, so the chunk the writer waits for
+	// always gets one. done stops the dispatch when the merge returns early
+	readAhead := make(chan struct{}, h.cfg.MergeReadAhead)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := range results {
+			select {
+			case readAhead <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			// The readers also take turns on a shared budget of open files,
+			// so even a merge of thousands of chunks stays below the
+			// process's limit
+			go func(i int) {
+				_, span := h.tracer.Start(ctx, "read_chunk", trace.WithAttributes(attrChunkIndex.Int(h.cfg.ChunkBase+i)))
+				defer span.End()
+
+				path, _ := h.chunks.path(key, h.cfg.ChunkBase+i)
+				var data []byte
+				retries, err := h.retryChunk(done, "read", h.cfg.ChunkBase+i, func(int) error {
+					var err error
+					h.openChunks <- struct{}{}
+					data, err = readChunk(path)
+					<-h.openChunks
+					return err
+				})
+				span.SetAttributes(attrChunkSize.Int(len(data)))
+				if err != nil {
+					span.SetStatus(codes.Error, err.Error())
+				}
+				results[i] <- chunkResult{data: data, err: err, retries: retries}
+			}(i)
+		}
+	}()
+
+	// Hash the merged stream while writing it so the digests need no second
+	// pass. Only chunks the output took are passed on, so a retried write
+	// reaches the digests and tee once
+	digests := h.newDigester()
+	var writer io.Writer = digests
+	if tee != nil {
+		writer = io.MultiWriter(digests, tee)
+	}
+	for i, pending := range results {
+		chunkIndex := h.cfg.ChunkBase + i
+		var chunk chunkResult
+		select {
+		case chunk = <-pending:
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+		if chunk.err != nil {
+			return result, &mergeChunkError{op: "read", index: chunkIndex, err: chunk.err}
+		}
+		if chunk.retries > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("chunk %d was read after %d retries", chunkIndex, chunk.retries))
+		}
+
+		_, writeSpan := h.tracer.Start(ctx, "write_chunk", trace.WithAttributes(attrChunkIndex.Int(chunkIndex), attrChunkSize.Int(len(chunk.data))))
+		var retries int
+		var err error
+		if retryable {
+			retries, err = h.writeOutput(done, output, offset+result.Size, chunkIndex, chunk.data)
+		} else {
+			_, err = w.Write(chunk.data)
+		}
+		if err == nil {
+			_, err = writer.Write(chunk.data)
+		}
+		if err != nil {
+			writeSpan.SetStatus(codes.Error, err.Error())
+		}
+		writeSpan.End()
+		if err != nil {
+			return result, &mergeChunkError{op: "write", index: chunkIndex, err: err}
+		}
+		if retries > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("chunk %d was written after %d retries", chunkIndex, retries))
+		}
+		result.Size += int64(len(chunk.data))
+		<-readAhead // The chunk is written, let the next reader start
+	}
+
+	result.Digests = digests.sums()
+	return result, nil
+}
+
+// chunkProblem is a reason the chunks of a merge cannot be merged as
+// requested: err answers the merge, cause explains it in the log and in the
+// problems of a dry run.
+type chunkProblem struct {
+	err   *Error
+	cause error
+}
+
+// validateChunks checks the present chunks of chunkKey, sized by
+// inspectChunks, against req before anything is written: their alignment to
+// the session's chunk size, total_size, and the manifest's chunk count and
+// checksums. Merges fail on the first problem, dry runs list them all. The
+// checksums are only verified once everything else matches, since that may
+// read every chunk. The checks are recorded in report; the error is a
+// manifest that could not be read.
+func (h *ApiHandler) validateChunks(req *domain.MergeChunksRequest, chunkKey string, sizes []int64, report *domain.MergeReport) ([]chunkProblem, error) {
+	var problems []chunkProblem
+	if chunkSize := h.sessionChunkSize(req.UploadID); chunkSize > 0 {
+		report.ChunkSize = chunkSize
+		if unaligned := unalignedChunks(sizes, h.cfg.ChunkBase, chunkSize); len(unaligned) > 0 {
+			problems = append(problems, chunkProblem{
+				err: ErrChunkSizeMismatch.With(fiber.Map{
+					"chunk_size":       chunkSize,
+					"unaligned_chunks": unaligned,
+				}),
+				cause: fmt.Errorf("chunks %v do not match chunk size %d", unaligned, chunkSize),
+			})
+		}
+	}
+	if req.TotalSize != nil {
+		actual := sumSizes(sizes)
+		matched := actual == *req.TotalSize
+		report.SizeMatched = &matched
+		if !matched {
+			problems = append(problems, chunkProblem{
+				err: ErrSizeMismatch.With(fiber.Map{
+					"expected_size":   *req.TotalSize,
+					"actual_size":     actual,
+					"last_chunk_size": lastChunkSize(sizes),
+				}),
+				cause: fmt.Errorf("chunks hold %d bytes, expected %d", actual, *req.TotalSize),
+			})
+		}
+	}
+
+	manifest, err := readManifest(chunkKey)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return problems, nil
+	}
+	if len(manifest.Chunks) != req.TotalChunks {
+		return append(problems, chunkProblem{
+			err: ErrManifestMismatch.With(fiber.Map{
+				"manifest_chunks": len(manifest.Chunks),
+				"total_chunks":    req.TotalChunks,
+			}),
+			cause: fmt.Errorf("manifest lists %d chunks, merging %d", len(manifest.Chunks), req.TotalChunks),
+		}), nil
+	}
+	if len(problems) > 0 {
+		return problems, nil
+	}
+
+	mismatched, checksums := h.verifyManifest(manifest, chunkKey)
+	h.reportManifest(report, manifest, checksums)
+	report.ManifestVerified = len(mismatched) == 0
+	if len(mismatched) > 0 {
+		problems = append(problems, chunkProblem{
+			err: ErrChecksumMismatch.With(fiber.Map{
+				"mismatched_chunks": mismatched,
+			}),
+			cause: fmt.Errorf("chunks %v do not match the manifest", mismatched),
+		})
+	}
+	return problems, nil
+}
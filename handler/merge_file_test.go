@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+func TestMergeFile(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	ctx := context.Background()
+	for i, content := range []string{"first", "second"} {
+		if _, err := h.StoreChunk(ctx, domain.StoreChunkRequest{FileName: "direct.txt", ChunkIndex: i, Data: []byte(content)}); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+	}
+
+	_, err := h.MergeFile(ctx, domain.MergeChunksRequest{FileName: "direct.txt", TotalChunks: 3})
+	if !errors.Is(err, ErrChunkMissing) {
+		t.Fatalf("merge of a missing chunk: err = %v, want %s", err, ErrChunkMissing.Code)
+	}
+	_, err = h.MergeFile(ctx, domain.MergeChunksRequest{FileName: "direct.txt", TotalChunks: 2, DryRun: true})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("dry run: err = %v, want %s", err, ErrInvalidRequest.Code)
+	}
+
+	result, err := h.MergeFile(ctx, domain.MergeChunksRequest{FileName: "direct.txt", TotalChunks: 2, Metadata: map[string]string{"source": "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FileName != "direct.txt" || result.Size != 11 || result.Appended != 11 {
+		t.Errorf("result = %+v, want direct.txt of 11 bytes", result)
+	}
+	if result.Digests[HashSHA256] != checksumOf("firstsecond") {
+		t.Errorf("sha256 = %s, want %s", result.Digests[HashSHA256], checksumOf("firstsecond"))
+	}
+	if result.Metadata["source"] != "test" {
+		t.Errorf("metadata = %v, want the request's", result.Metadata)
+	}
+	data, err := os.ReadFile(h.filePath("direct.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "firstsecond" {
+		t.Errorf("stored file holds %q, want %q", data, "firstsecond")
+	}
+	if parts := partFiles(t); len(parts) != 0 {
+		t.Errorf("part files left after the merge: %v", parts)
+	}
+}
+
+// slowWriter discards what it is given after a pause, like a disk slower
+// than the reads of the chunks.
+type slowWriter struct {
+	delay time.Duration
+}
+
+func (w slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return len(p), nil
+}
+
+// liveHeap returns the bytes of live heap objects, without stopping the world.
+func liveHeap() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// heapPeak samples liveHeap until stop is called, which returns the highest
+// sample.
+func heapPeak() (stop func() uint64) {
+	var peak uint64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(100 * time.Microsecond)
+		defer ticker.Stop()
+		for {
+			peak = max(peak, liveHeap())
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() uint64 {
+		close(done)
+		wg.Wait()
+		return peak
+	}
+}
+
+// BenchmarkMergeReadAhead merges chunks into a writer slower than the reads
+// with several MergeReadAhead depths and reports the peak heap above the
+// live heap before each merge. The peak grows with the depth, up to every
+// chunk of the merge once no reader has to wait.
+func BenchmarkMergeReadAhead(b *testing.B) {
+	const chunks, chunkSize = 32, 1024 * 1024
+	for _, depth := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			h := newTestHandler(b, Config{MergeReadAhead: depth})
+			data := bytes.Repeat([]byte("x"), chunkSize)
+			for i := range chunks {
+				path, err := h.chunks.assign("large.bin", i)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0o644); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(chunks * chunkSize)
+			var peak uint64
+			for range b.N {
+				runtime.GC()
+				base := liveHeap()
+				stop := heapPeak()
+				_, err := h.assemble(context.Background(), "large.bin", chunks, slowWriter{delay: time.Millisecond}, nil)
+				top := stop()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if top > base {
+					peak = max(peak, top-base)
+				}
+			}
+			b.ReportMetric(float64(peak)/(1024*1024), "peak-MiB")
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// MergeLogSuffix is appended to a stored file's name to form its merge log.
+const MergeLogSuffix = ".merge.json"
+
+// mergeLogPath returns the merge log path of the stored file name.
+func (h *ApiHandler) mergeLogPath(name string) string {
+	return filepath.Join(h.fileDir(name), name+MergeLogSuffix)
+}
+
+// writeMergeLog records how a merge assembled its file when Config.MergeLog
+// is set; otherwise it removes any log left from an earlier merge, which no
+// longer describes the file. The log only serves debugging, so failing to
+// write it is logged rather than failing a merge whose file is complete.
+func (h *ApiHandler) writeMergeLog(run *mergeRun, entry *domain.MergeLog) {
+	var err error
+	if h.cfg.MergeLog {
+		err = h.saveMergeLog(entry)
+	} else if err = os.Remove(h.mergeLogPath(entry.FileName)); os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		run.warn("failed to update merge log of %s: %v", entry.FileName, err)
+	}
+}
+
+// saveMergeLog stores entry, replacing the previous log atomically.
+func (h *ApiHandler) saveMergeLog(entry *domain.MergeLog) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := h.mergeLogPath(entry.FileName) + ".tmp"
+	if err := writeFileNoFollow(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, h.mergeLogPath(entry.FileName))
+}
+
+// moveMergeLog carries the merge log of a renamed file over to its new name.
+func (h *ApiHandler) moveMergeLog(fileName, newName string) error {
+	entry, err := h.readMergeLog(fileName)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	entry.FileName = newName
+	if err := h.saveMergeLog(entry); err != nil {
+		return err
+	}
+
+	return os.Remove(h.mergeLogPath(fileName))
+}
+
+// readMergeLog loads the merge log of the stored file name, or returns nil
+// when it has none.
+func (h *ApiHandler) readMergeLog(name string) (*domain.MergeLog, error) {
+	data, err := os.ReadFile(h.mergeLogPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	entry := new(domain.MergeLog)
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// reportRegistry keeps the report of the latest merge of every file until it
+// expires.
+type reportRegistry struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	reports map[string]storedReport
+}
+
+type storedReport struct {
+	report  *domain.MergeReport
+	expires time.Time
+}
+
+func newReportRegistry(ttl time.Duration) *reportRegistry {
+	return &reportRegistry{ttl: ttl, reports: make(map[string]storedReport)}
+}
+
+// put stores report under its file name, replacing an earlier one, and drops
+// the expired reports so the registry only grows with recent merges.
+func (r *reportRegistry) put(report *domain.MergeReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for name, stored := range r.reports {
+		if now.After(stored.expires) {
+			delete(r.reports, name)
+		}
+	}
+	r.reports[report.FileName] = storedReport{report: report, expires: now.Add(r.ttl)}
+}
+
+func (r *reportRegistry) get(fileName string) (*domain.MergeReport, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.reports[fileName]
+	if !ok || time.Now().After(stored.expires) {
+		return nil, false
+	}
+	return stored.report, true
+}
+
+// mergeRun is a merge in progress: the client that asked for it and, for
+// merges that keep one, its report.
+type mergeRun struct {
+	client string
+	report *domain.MergeReport
+}
+
+// beginMerge starts the run and the report of merging body. The merge fills
+// the report in as its checks pass and mergeSucceeded or mergeFailed stores it.
+func (h *ApiHandler) beginMerge(body *domain.MergeChunksRequest, started time.Time) *mergeRun {
+	return &mergeRun{
+		client: body.Client,
+		report: &domain.MergeReport{
+			FileName:     body.FileName,
+			UploadID:     body.UploadID,
+			TotalChunks:  body.TotalChunks,
+			Chunks:       []domain.ChunkReport{},
+			ExpectedSize: body.TotalSize,
+			Warnings:     []string{},
+			StartedAt:    started,
+		},
+	}
+}
+
+// reportChunks lists the present chunks, sized by inspectChunks, in report
+// with the checksums recorded while they were uploaded.
+func (h *ApiHandler) reportChunks(report *domain.MergeReport, chunkKey string, sizes []int64) {
+	for i, size := range sizes {
+		if size < 0 {
+			continue
+		}
+		index := h.cfg.ChunkBase + i
+		checksum, _ := h.progress.checksum(chunkKey, index)
+		report.Chunks = append(report.Chunks, domain.ChunkReport{Index: index, Size: size, Checksum: checksum})
+	}
+}
+
+// reportManifest adds the outcome of verifyManifest to report: every chunk's
+// checksum, the manifest's and whether they matched.
+func (h *ApiHandler) reportManifest(report *domain.MergeReport, manifest *chunkManifest, checksums []string) {
+	for i := range report.Chunks {
+		chunk := &report.Chunks[i]
+		position := chunk.Index - h.cfg.ChunkBase
+		if checksums[position] == "" {
+			continue // Not read, the writer reports it
+		}
+		matched := strings.EqualFold(checksums[position], manifest.Chunks[position])
+		chunk.Checksum = checksums[position]
+		chunk.Expected = manifest.Chunks[position]
+		chunk.Matched = &matched
+	}
+}
+
+// warn logs a problem that does not fail the merge and adds it to the
+// warnings of its report.
+func (r *mergeRun) warn(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	log.Print(message)
+	if r.report != nil {
+		r.report.Warnings = append(r.report.Warnings, message)
+	}
+}
+
+// finishReport completes and stores the report of run, if any, under the
+// name the merge responds with.
+func (h *ApiHandler) finishReport(run *mergeRun, fileName, status string, err error) {
+	report := run.report
+	if report == nil || h.cfg.MergeReportTTL < 0 {
+		return
+	}
+	run.report = nil // A report is stored once
+
+	report.FileName = fileName
+	report.Status = status
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.FinishedAt = time.Now()
+	report.DurationMs = report.FinishedAt.Sub(report.StartedAt).Milliseconds()
+	h.reports.put(report)
+}
+
+// MergeReport handles GET /merge-report/:file_name, returning the report of
+// the file's latest merge, failed or successful, until it expires.
+func (h *ApiHandler) MergeReport(c *fiber.Ctx) error {
+	fileName := c.Params("file_name")
+	if !validFileName(fileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+
+	report, ok := h.reports.get(fileName)
+	if !ok {
+		return RespondError(c, ErrNotFound.WithMessage("Merge report not found").With(fiber.Map{
+			"file": fileName,
+		}))
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":  false,
+		"report": report,
+	})
+}
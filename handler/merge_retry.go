@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+)
+
+// retryChunk runs op on a chunk of a merge, retrying it after failures up to
+// Config.MergeRetries times with a backoff that starts at
+// Config.MergeRetryBackoff and doubles. A missing chunk is not retried, nor is
+// anything once done is closed because the merge has given up. It returns the
+// retries it took and op's last error.
+func (h *ApiHandler) retryChunk(done <-chan struct{}, action string, chunkIndex int, op func(attempt int) error) (int, error) {
+	retries := max(h.cfg.MergeRetries, 0)
+	backoff := h.cfg.MergeRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := op(attempt)
+		if err == nil || attempt == retries || errors.Is(err, fs.ErrNotExist) {
+			return attempt, err
+		}
+
+		log.Printf("failed to %s chunk %d (attempt %d of %d), retrying in %s: %v", action, chunkIndex, attempt+1, retries+1, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-done:
+			return attempt, err
+		}
+		backoff *= 2
+	}
+}
+
+// writeOutput writes a chunk's data to output at offset, where the previous
+// chunk ended, retrying failed writes. A failed write may have stored part of
+// the data, so every retry first cuts the output back to offset.
+func (h *ApiHandler) writeOutput(done <-chan struct{}, output *os.File, offset int64, chunkIndex int, data []byte) (int, error) {
+	return h.retryChunk(done, "write", chunkIndex, func(attempt int) error {
+		if attempt > 0 {
+			if err := output.Truncate(offset); err != nil {
+				return err
+			}
+			if _, err := output.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		_, err := output.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// mergeSource is a source of a multi-source merge with its chunks resolved.
+type mergeSource struct {
+	domain.MergeSource
+	chunkKey string
+}
+
+// mergeSources assembles body.FileName from the chunks of every upload in
+// body.Sources, in the order listed, as when an archive is built from parts
+// uploaded independently. Every chunk of every source must be present before
+// anything is written; the sources are cleaned up like a regular merge once
+// the file is stored.
+func (h *ApiHandler) mergeSources(c *fiber.Ctx, body *domain.MergeChunksRequest, started time.Time) error {
+	switch {
+	case body.UploadID != "" || body.TotalChunks != 0:
+		return RespondError(c, ErrInvalidRequest.WithMessage("sources replace upload_id and total_chunks"))
+	case body.Append || body.DryRun || body.From != nil || body.To != nil:
+		return RespondError(c, ErrInvalidRequest.WithMessage("append, dry_run, from and to are not available with sources"))
+	case h.cfg.MultipartStorage != nil:
+		return RespondError(c, ErrNotImplemented.WithMessage("Merging several sources is not available with multipart storage"))
+	}
+	if !validFileName(body.FileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+	if err := validateMetadata(body.Metadata); err != nil {
+		return RespondError(c, ErrInvalidRequest.WithMessage("Invalid metadata").Wrap(err))
+	}
+
+	sources, err := h.resolveSources(body.Sources)
+	if err != nil {
+		return RespondError(c, err)
+	}
+
+	// Missing chunks are reported for every source at once, so a client can
+	// re-upload them all before retrying
+	missing := map[string][]int{}
+	var chunks []externalChunk
+	var total int64
+	for _, source := range sources {
+		sizes, absent, err := h.inspectChunks(source.chunkKey, h.cfg.ChunkBase, source.TotalChunks)
+		if err != nil {
+			return RespondError(c, ErrInternal.WithMessage("Failed to inspect chunks").Wrap(err))
+		}
+		if len(absent) > 0 {
+			missing[source.FileName] = absent
+			continue
+		}
+		for index := range source.TotalChunks {
+			path, _ := h.chunks.path(source.chunkKey, h.cfg.ChunkBase+index)
+			chunks = append(chunks, externalChunk{name: filepath.Base(path), size: sizes[index]})
+			total += sizes[index]
+		}
+	}
+	if len(missing) > 0 {
+		return RespondError(c, ErrChunkMissing.With(fiber.Map{
+			"missing_chunks": missing,
+		}))
+	}
+	if body.TotalSize != nil && total != *body.TotalSize {
+		return RespondError(c, ErrSizeMismatch.With(fiber.Map{
+			"expected_size": *body.TotalSize,
+			"actual_size":   total,
+		}))
+	}
+
+	originalName := body.FileName
+	fileName, nameErr := h.storedName(body.FileName)
+	if nameErr != nil {
+		return RespondError(c, nameErr)
+	}
+	body.FileName = fileName
+	select {
+	case h.mergeSlots <- struct{}{}:
+		defer func() { <-h.mergeSlots }()
+	default:
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return RespondError(c, ErrBusy)
+	}
+	unlock := h.lockFile(fileName)
+	defer unlock()
+	run := h.beginMerge(body, started)
+
+	output, size, sums, err := h.writeExternal(run, fileName, chunks)
+	if errors.Is(err, errFileExists) {
+		h.mergeFailed(run, fileName, err)
+		return RespondError(c, fileExistsError(fileName, err))
+	}
+	if err != nil {
+		h.mergeFailed(run, fileName, err)
+		return storageError(c, "Failed to merge sources", err)
+	}
+	outName := output.name
+
+	checksum := sums[HashSHA256]
+	if !body.DownloadOnce {
+		if err := h.storeObject(h.filePath(outName), checksum); err != nil {
+			h.mergeFailed(run, fileName, err)
+			return storageError(c, "Failed to store object", err)
+		}
+	}
+	meta, err := h.storeMetadata(outName, originalName, size, sums, body.Metadata, false, body.DownloadOnce)
+	if err != nil {
+		h.mergeFailed(run, fileName, err)
+		return RespondError(c, ErrInternal.WithMessage("Failed to write file metadata").Wrap(err))
+	}
+	h.chownStored(run, outName)
+	sizes := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		sizes[i] = chunk.size
+	}
+	h.writeMergeLog(run, &domain.MergeLog{
+		FileName:   outName,
+		ChunkCount: len(chunks),
+		ChunkSizes: sizes,
+		Appended:   size,
+		Size:       size,
+		Checksum:   checksum,
+		StartedAt:  started,
+		DurationMs: time.Since(started).Milliseconds(),
+	})
+
+	// The file is stored, so a source failing to clean up only leaves its
+	// chunks for the sweeper
+	for _, source := range sources {
+		if !body.RetainChunks {
+			err := h.cleanUpTempFiles(source.chunkKey)
+			if err == nil {
+				err = removeManifest(source.chunkKey)
+			}
+			if err != nil {
+				run.warn("failed to clean up the chunks of %s: %v", source.FileName, err)
+			}
+		}
+		h.progress.reset(source.chunkKey)
+		h.sequences.reset(source.chunkKey)
+	}
+
+	c.Set(fiber.HeaderETag, formatETag(checksum))
+	h.stats.fileStored(size, output.replacing, output.replaced)
+	h.mergeSucceeded(run, outName, size, checksum)
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":    false,
+		"message":  "Sources merged successfully",
+		"file":     outName,
+		"size":     size,
+		"sources":  len(sources),
+		"chunks":   len(chunks),
+		"checksum": checksum,
+		"digests":  sums,
+		"metadata": meta.Metadata,
+	})
+}
+
+// resolveSources validates the sources of a multi-source merge and finds
+// the chunks of each. A source may be listed only once, and has at least one
+// chunk.
+func (h *ApiHandler) resolveSources(list []domain.MergeSource) ([]mergeSource, error) {
+	sources := make([]mergeSource, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for i, source := range list {
+		if !validFileName(source.FileName) {
+			return nil, ErrInvalidFileName.WithMessage(fmt.Sprintf("Invalid file name in source %d", i))
+		}
+		if source.TotalChunks < 1 {
+			return nil, ErrInvalidRequest.WithMessage(fmt.Sprintf("total_chunks of source %s must be at least 1", source.FileName))
+		}
+		if seen[source.FileName] {
+			return nil, ErrInvalidRequest.WithMessage(fmt.Sprintf("Source %s is listed more than once", source.FileName))
+		}
+		seen[source.FileName] = true
+
+		_, chunkKey, err := h.resolveUpload("", source.FileName)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, mergeSource{MergeSource: source, chunkKey: chunkKey})
+	}
+
+	return sources, nil
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMergeSourcesReportsEveryMissingChunk(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := newTestApp(h)
+	upload := func(fileName string, index int, data string) {
+		t.Helper()
+		if status, body := uploadChunk(t, app, fileName, index, []byte(data)); status != fiber.StatusOK {
+			t.Fatalf("upload of %s chunk %d: status %d: %v", fileName, index, status, body)
+		}
+	}
+	upload("a.part", 0, "a0")
+	upload("b.part", 1, "b1")
+	upload("c.part", 0, "c0")
+	upload("c.part", 1, "c1")
+	merge := map[string]any{
+		"file_name": "archive.bin",
+		"sources": []map[string]any{
+			{"file_name": "a.part", "total_chunks": 2},
+			{"file_name": "b.part", "total_chunks": 3},
+			{"file_name": "c.part", "total_chunks": 2},
+		},
+	}
+
+	status, body := postJSON(t, app, "/merge-chunk", merge)
+	if status != fiber.StatusConflict || body["code"] != ErrChunkMissing.Code {
+		t.Fatalf("status %d: %v, want 409 %s", status, body, ErrChunkMissing.Code)
+	}
+	want := map[string]any{"a.part": []any{float64(1)}, "b.part": []any{float64(0), float64(2)}}
+	if !reflect.DeepEqual(body["missing_chunks"], want) {
+		t.Errorf("missing_chunks = %v, want %v", body["missing_chunks"], want)
+	}
+	if _, err := os.Stat(h.filePath("archive.bin")); !os.IsNotExist(err) {
+		t.Errorf("refused merge stored the output: %v", err)
+	}
+	if parts := partFiles(t); len(parts) != 4 {
+		t.Errorf("%d part files left after the refused merge, want all 4", len(parts))
+	}
+
+	// Once the reported chunks are uploaded the same request goes through
+	upload("a.part", 1, "a1")
+	upload("b.part", 0, "b0")
+	upload("b.part", 2, "b2")
+	if status, body := postJSON(t, app, "/merge-chunk", merge); status != fiber.StatusOK {
+		t.Fatalf("retried merge: status %d: %v", status, body)
+	}
+	if data, err := os.ReadFile(h.filePath("archive.bin")); err != nil || string(data) != "a0a1b0b1b2c0c1" {
+		t.Errorf("archive.bin holds %q, %v, want the sources in order", data, err)
+	}
+	if parts := partFiles(t); len(parts) != 0 {
+		t.Errorf("part files left after the merge: %v", parts)
+	}
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// MetadataSuffix is appended to a stored file's name to form its sidecar.
+const MetadataSuffix = ".meta.json"
+
+// Limits on client-provided metadata, so it cannot be used to store
+// arbitrary amounts of data next to a file.
+const (
+	maxMetadataKeys       = 32
+	maxMetadataValueBytes = 1024
+	maxMetadataBytes      = 8 * 1024
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// metadataPath returns the sidecar path of the stored file name.
+func (h *ApiHandler) metadataPath(name string) string {
+	return filepath.Join(h.fileDir(name), name+MetadataSuffix)
+}
+
+// validateMetadata checks client-provided metadata against the key name and
+// size limits.
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("at most %d metadata keys are allowed", maxMetadataKeys)
+	}
+
+	total := 0
+	for key, value := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid metadata key %q: use 1-64 letters, digits, '_', '-' or '.'", key)
+		}
+		if len(value) > maxMetadataValueBytes {
+			return fmt.Errorf("metadata value of %q exceeds %d bytes", key, maxMetadataValueBytes)
+		}
+		total += len(key) + len(value)
+	}
+	if total > maxMetadataBytes {
+		return fmt.Errorf("metadata exceeds %d bytes", maxMetadataBytes)
+	}
+
+	return nil
+}
+
+// readMetadata loads the sidecar of the stored file name. It returns an error
+// satisfying os.IsNotExist when the file has no sidecar.
+func (h *ApiHandler) readMetadata(name string) (*domain.FileMetadata, error) {
+	data, err := os.ReadFile(h.metadataPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := new(domain.FileMetadata)
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("corrupt metadata for %s: %w", name, err)
+	}
+
+	return meta, nil
+}
+
+// writeMetadata stores meta in its sidecar, replacing it atomically so
+// readers never see a half-written file.
+func (h *ApiHandler) writeMetadata(meta *domain.FileMetadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := h.metadataPath(meta.FileName) + ".tmp"
+	if err := writeFileNoFollow(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, h.metadataPath(meta.FileName))
+}
+
+// storeMetadata records the size and digests of a freshly stored file
+// together with the client's metadata, the name the client sent when it was
+// stored under another one and whether it may be downloaded only once.
+// Appends keep the existing metadata and let the new keys override it.
+func (h *ApiHandler) storeMetadata(name, originalName string, size int64, digests map[string]string, metadata map[string]string, appendMode, downloadOnce bool) (*domain.FileMetadata, error) {
+	meta := &domain.FileMetadata{
+		FileName:     name,
+		Size:         size,
+		Checksum:     digests[HashSHA256],
+		Digests:      digests,
+		StoredAt:     time.Now(),
+		Metadata:     metadata,
+		DownloadOnce: downloadOnce,
+	}
+	if originalName != name {
+		meta.OriginalName = originalName
+	}
+
+	if appendMode {
+		previous, err := h.readMetadata(name)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if previous != nil && len(previous.Metadata) > 0 {
+			merged := make(map[string]string, len(previous.Metadata)+len(metadata))
+			for key, value := range previous.Metadata {
+				merged[key] = value
+			}
+			for key, value := range metadata {
+				merged[key] = value
+			}
+			if err := validateMetadata(merged); err != nil {
+				return nil, err
+			}
+			meta.Metadata = merged
+		}
+	}
+
+	return meta, h.writeMetadata(meta)
+}
+
+// restoreMetadata puts previous back as the sidecar of the stored file name
+// after a merge replacing it failed to commit, or removes the sidecar when
+// the file had none.
+func (h *ApiHandler) restoreMetadata(name string, previous *domain.FileMetadata) {
+	var err error
+	if previous != nil {
+		err = h.writeMetadata(previous)
+	} else if err = os.Remove(h.metadataPath(name)); os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		log.Printf("failed to restore metadata of %s: %v", name, err)
+	}
+}
+
+// isSidecarName reports whether name is reserved for sidecar files.
+func isSidecarName(name string) bool {
+	for _, suffix := range []string{MetadataSuffix, MergeLogSuffix} {
+		if strings.HasSuffix(name, suffix) || strings.HasSuffix(name, suffix+".tmp") {
+			return true
+		}
+	}
+
+	// Nor can a name collide with the temp file of a replacing merge
+	return strings.HasSuffix(name, mergeTempSuffix)
+}
+
+// storedMetadata returns the sidecar of the stored file fileName of the
+// given size. Files stored before sidecars existed get a checksum computed on
+// demand.
+func (h *ApiHandler) storedMetadata(fileName string, size int64) (*domain.FileMetadata, error) {
+	meta, err := h.readMetadata(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		_, checksum, hashErr := checksumFile(h.filePath(fileName), h.cfg.BufferSize)
+		meta, err = &domain.FileMetadata{FileName: fileName, Size: size, Checksum: checksum}, hashErr
+	}
+
+	return meta, err
+}
+
+// FileInfo handles GET /files/:file_name, returning the size, checksum and
+// client metadata of a stored file.
+func (h *ApiHandler) FileInfo(c *fiber.Ctx) error {
+	fileName := c.Params("file_name")
+	if !validFileName(fileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+
+	info, err := os.Stat(h.filePath(fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return RespondError(c, ErrFileNotFound.With(fiber.Map{
+				"file": fileName,
+			}))
+		}
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file").Wrap(err))
+	}
+
+	meta, err := h.storedMetadata(fileName, info.Size())
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file metadata").Wrap(err))
+	}
+
+	mergeLog, err := h.readMergeLog(fileName)
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read merge log").Wrap(err))
+	}
+
+	c.Set(fiber.HeaderETag, formatETag(meta.Checksum))
+	response := fiber.Map{
+		"error":       false,
+		"file":        fileName,
+		"size":        info.Size(),
+		"modified_at": info.ModTime(),
+		"stored_at":   meta.StoredAt,
+		"checksum":    meta.Checksum,
+		"digests":     meta.Digests,
+		"metadata":    meta.Metadata,
+	}
+	if meta.OriginalName != "" {
+		response["original_name"] = meta.OriginalName
+	}
+	if meta.DownloadOnce {
+		response["download_once"] = true
+	}
+	if mergeLog != nil {
+		response["merge_log"] = mergeLog
+	}
+
+	return Respond(c, fiber.StatusOK, response)
+}
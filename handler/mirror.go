@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Storage is a destination merged files can be written to, such as the
+// secondary destination that mirrors every merge.
+type Storage interface {
+	// Create opens name for writing. What is written should only replace
+	// an existing file once the writer is closed, so that a failed merge
+	// leaves the previous copy in place.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// Aborter is implemented by writers of a Storage that can drop what was
+// written to them. A failed merge aborts the mirror instead of closing it.
+type Aborter interface {
+	Abort() error
+}
+
+// DirStorage stores files in a local directory, e.g. a second volume.
+type DirStorage struct {
+	Dir string
+}
+
+// Create writes name to a temp file in the directory, renamed over name on
+// Close and removed on Abort.
+func (s DirStorage) Create(name string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.Dir, name)
+	if err := refuseSymlink(path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+mergeTempSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &dirFile{File: file, path: path}, nil
+}
+
+// dirFile is a file of a DirStorage being written under a temp name.
+type dirFile struct {
+	*os.File
+	path string
+}
+
+// Close moves the written file to its name, replacing the previous one.
+func (f *dirFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort drops the written file, keeping the previous one.
+func (f *dirFile) Abort() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// mirrorWriter forwards the merged stream to the mirror storage. In
+// best-effort mode a failing mirror is dropped and the primary write carries
+// on; otherwise the error is returned and fails the merge.
+type mirrorWriter struct {
+	dst        io.WriteCloser
+	bestEffort bool
+	err        error
+	closed     bool
+}
+
+func (w *mirrorWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		if w.bestEffort {
+			return len(p), nil
+		}
+		return 0, w.err
+	}
+
+	if _, err := w.dst.Write(p); err != nil {
+		w.err = fmt.Errorf("mirror write failed: %w", err)
+		if w.bestEffort {
+			return len(p), nil
+		}
+		return 0, w.err
+	}
+
+	return len(p), nil
+}
+
+// Close closes the mirror and returns the first error it hit, if any. A
+// mirror that failed a write is aborted rather than stored. It is safe to
+// call more than once.
+func (w *mirrorWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	if w.err != nil {
+		w.abort()
+		return w.err
+	}
+	w.closed = true
+
+	if err := w.dst.Close(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("mirror close failed: %w", err)
+	}
+
+	return w.err
+}
+
+// abort drops what was written to the mirror after the merge failed. A
+// destination that cannot abort is closed. It does nothing once the mirror
+// is closed.
+func (w *mirrorWriter) abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	if aborter, ok := w.dst.(Aborter); ok {
+		aborter.Abort()
+		return
+	}
+	w.dst.Close()
+}
+
+// openMirror opens name on the mirror storage. It returns nil when no mirror
+// is configured or, in best-effort mode, when the mirror cannot be opened.
+func (h *ApiHandler) openMirror(run *mergeRun, name string) (*mirrorWriter, error) {
+	if h.cfg.MirrorStorage == nil {
+		return nil, nil
+	}
+
+	dst, err := h.cfg.MirrorStorage.Create(name)
+	if err != nil {
+		if h.cfg.MirrorBestEffort {
+			run.warn("mirror of %s skipped: %v", name, err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open mirror: %w", err)
+	}
+
+	return &mirrorWriter{dst: dst, bestEffort: h.cfg.MirrorBestEffort}, nil
+}
+
+// finishMirror closes mirror, storing the copy, and decides whether its
+// failure fails the merge.
+func (h *ApiHandler) finishMirror(run *mergeRun, mirror *mirrorWriter, name string) error {
+	if mirror == nil {
+		return nil
+	}
+
+	if err := mirror.Close(); err != nil {
+		if h.cfg.MirrorBestEffort {
+			run.warn("mirror of %s failed: %v", name, err)
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// mirrorFile copies a stored file to the mirror in one go, for files that
+// were not assembled through the merged stream (appends and range uploads).
+func (h *ApiHandler) mirrorFile(run *mergeRun, name string) error {
+	mirror, err := h.openMirror(run, name)
+	if err != nil || mirror == nil {
+		return err
+	}
+
+	file, err := os.Open(h.filePath(name))
+	if err != nil {
+		mirror.abort()
+		return err
+	}
+	defer file.Close()
+
+	buf := getBuffer(h.cfg.BufferSize)
+	defer putBuffer(buf)
+
+	if _, err := io.CopyBuffer(mirror, file, *buf); err != nil {
+		mirror.abort()
+		return err
+	}
+
+	return h.finishMirror(run, mirror, name)
+}
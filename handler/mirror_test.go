@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDirStorageReplacesOnClose(t *testing.T) {
+	storage := DirStorage{Dir: t.TempDir()}
+	path := filepath.Join(storage.Dir, "copy.bin")
+	if err := os.WriteFile(path, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	write := func(data string) *dirFile {
+		t.Helper()
+		w, err := storage.Create("copy.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		// Nothing replaces the previous copy while the new one is written
+		if data, err := os.ReadFile(path); err != nil || string(data) != "previous" {
+			t.Fatalf("copy being written: %q, %v, want the previous one", data, err)
+		}
+		return w.(*dirFile)
+	}
+	assertDir := func(want string) {
+		t.Helper()
+		entries, err := os.ReadDir(storage.Dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if len(entries) != 1 || err != nil || string(data) != want {
+			t.Errorf("dir holds %d files with the copy %q, %v, want only the copy %q", len(entries), data, err, want)
+		}
+	}
+
+	if err := write("aborted").Abort(); err != nil {
+		t.Fatal(err)
+	}
+	assertDir("previous")
+
+	if err := write("closed").Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertDir("closed")
+}
+
+func TestMirrorKeptOnFailedMerge(t *testing.T) {
+	mirror := DirStorage{Dir: t.TempDir()}
+	h := newTestHandler(t, Config{MergeRetries: -1, MirrorStorage: mirror})
+	app := newTestApp(h)
+	upload := func() {
+		t.Helper()
+		for i, content := range []string{"first", "second"} {
+			if status, body := uploadChunk(t, app, "mirrored.bin", i, []byte(content)); status != fiber.StatusOK {
+				t.Fatalf("upload of chunk %d: status %d: %v", i, status, body)
+			}
+		}
+	}
+	upload()
+	if status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "mirrored.bin", "total_chunks": 2}); status != fiber.StatusOK {
+		t.Fatalf("first merge: status %d: %v", status, body)
+	}
+
+	// A directory in place of the last chunk fails the merge halfway through
+	upload()
+	path, _ := h.chunks.path("mirrored.bin", 1)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "mirrored.bin", "total_chunks": 2}); status != fiber.StatusInternalServerError {
+		t.Fatalf("status %d: %v, want 500", status, body)
+	}
+
+	entries, err := os.ReadDir(mirror.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(mirror.Dir, "mirrored.bin"))
+	if len(entries) != 1 || err != nil || string(data) != "firstsecond" {
+		t.Errorf("mirror dir holds %d files with the copy %q, %v, want only the first merge's %q", len(entries), data, err, "firstsecond")
+	}
+}
@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// maxPartNumber is the highest part number object stores such as S3 accept.
+const maxPartNumber = 10000
+
+// MultipartStorage is an object store with multipart uploads, e.g. S3. When
+// configured, every chunk is streamed straight to the store as one part and
+// the merge only asks the store to assemble them, so nothing touches the
+// local disk.
+type MultipartStorage interface {
+	// CreateUpload starts a multipart upload of the object name.
+	CreateUpload(ctx context.Context, name string) (string, error)
+	// UploadPart stores part partNumber (1-based) of size bytes and returns
+	// the ETag needed to complete the upload.
+	UploadPart(ctx context.Context, name, uploadID string, partNumber int, r io.Reader, size int64) (string, error)
+	// CompleteUpload assembles the parts, in order, into the object and
+	// returns its ETag.
+	CompleteUpload(ctx context.Context, name, uploadID string, parts []CompletedPart) (string, error)
+	// AbortUpload discards a multipart upload and the parts stored for it.
+	AbortUpload(ctx context.Context, name, uploadID string) error
+}
+
+// CompletedPart identifies an uploaded part when completing an upload.
+type CompletedPart struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// multipartUpload tracks the parts uploaded so far for one file.
+type multipartUpload struct {
+	mu       sync.Mutex
+	name     string // Of the object
+	uploadID string
+	parts    map[int]CompletedPart // By chunk index
+}
+
+// multipartRegistry holds the multipart uploads in progress keyed by chunk key.
+type multipartRegistry struct {
+	mu      sync.Mutex
+	uploads map[string]*multipartUpload
+}
+
+func newMultipartRegistry() *multipartRegistry {
+	return &multipartRegistry{uploads: make(map[string]*multipartUpload)}
+}
+
+// start returns the upload of key, creating it in the store on first use.
+// Concurrent first chunks wait for a single CreateUpload.
+func (r *multipartRegistry) start(ctx context.Context, storage MultipartStorage, key, name string) (*multipartUpload, error) {
+	r.mu.Lock()
+	upload, ok := r.uploads[key]
+	if !ok {
+		upload = &multipartUpload{parts: make(map[int]CompletedPart)}
+		r.uploads[key] = upload
+	}
+	r.mu.Unlock()
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if upload.uploadID == "" {
+		uploadID, err := storage.CreateUpload(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		upload.name = name
+		upload.uploadID = uploadID
+	}
+
+	return upload, nil
+}
+
+func (r *multipartRegistry) get(key string) (*multipartUpload, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload, ok := r.uploads[key]
+	return upload, ok
+}
+
+func (r *multipartRegistry) remove(key string) {
+	r.mu.Lock()
+	delete(r.uploads, key)
+	r.mu.Unlock()
+}
+
+// abortMultipart discards the multipart upload of key in the storage, with
+// the parts uploaded so far, before forgetting it, and returns the number of
+// parts discarded. When the storage fails the upload is kept, so the abort
+// can be retried.
+func (h *ApiHandler) abortMultipart(ctx context.Context, key string) (int, error) {
+	upload, ok := h.multipart.get(key)
+	if !ok {
+		return 0, nil
+	}
+
+	upload.mu.Lock()
+	name, uploadID, parts := upload.name, upload.uploadID, len(upload.parts)
+	upload.mu.Unlock()
+	if uploadID != "" {
+		if err := h.cfg.MultipartStorage.AbortUpload(ctx, name, uploadID); err != nil {
+			return 0, err
+		}
+	}
+
+	h.multipart.remove(key)
+	return parts, nil
+}
+
+// uploadPart streams a chunk to the multipart storage instead of the temp
+// directory. A retried chunk simply replaces the part of the first attempt.
+func (h *ApiHandler) uploadPart(c *fiber.Ctx, body *domain.UploadFileRequest, fileName, chunkKey string, file *multipart.FileHeader) error {
+	partNumber := body.ChunkIndex - h.cfg.ChunkBase + 1
+	if partNumber > maxPartNumber {
+		return RespondError(c, ErrInvalidRequest.WithMessage(fmt.Sprintf("At most %d chunks can be uploaded to multipart storage", maxPartNumber)))
+	}
+
+	fileReader, err := file.Open()
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to open uploaded file").Wrap(err))
+	}
+	defer fileReader.Close()
+
+	// The object is named once, here, so it must already be the stored name
+	fileName, nameErr := h.storedName(fileName)
+	if nameErr != nil {
+		return RespondError(c, nameErr)
+	}
+	upload, err := h.multipart.start(c.UserContext(), h.cfg.MultipartStorage, chunkKey, fileName)
+	if err != nil {
+		return RespondError(c, ErrUpstream.WithMessage("Failed to start multipart upload").Wrap(err))
+	}
+
+	etag, err := h.cfg.MultipartStorage.UploadPart(c.UserContext(), fileName, upload.uploadID, partNumber, fileReader, file.Size)
+	if err != nil {
+		return RespondError(c, ErrUpstream.WithMessage("Failed to upload part").Wrap(err))
+	}
+
+	upload.mu.Lock()
+	upload.parts[body.ChunkIndex] = CompletedPart{Number: partNumber, ETag: etag, Size: file.Size}
+	upload.mu.Unlock()
+
+	h.audit(domain.AuditEvent{
+		Time:       time.Now(),
+		Action:     domain.AuditChunkReceived,
+		FileName:   fileName,
+		ChunkIndex: &body.ChunkIndex,
+		Bytes:      file.Size,
+		Client:     clientIdentity(c),
+		Status:     domain.MergeStatusSuccess,
+	})
+
+	if body.Sequence != nil {
+		h.sequences.advance(chunkKey, *body.Sequence)
+	}
+	receivedBytes, next := h.progress.record(chunkKey, h.cfg.ChunkBase, body.ChunkIndex, chunkInfo{size: file.Size})
+	next, complete := h.acknowledge(body, next)
+
+	h.setProgressHeaders(c, chunkKey)
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":          false,
+		"message":        "File uploaded successfully",
+		"file":           fileName,
+		"received_bytes": receivedBytes,
+		"next_chunk":     next,
+		"complete":       complete,
+	})
+}
+
+// multipartParts collects the parts of chunks [ChunkBase,
+// ChunkBase+totalChunks) of chunkKey uploaded to the storage, sorted for
+// completion, with their total size, the missing indices and the storage's
+// upload ID.
+func (h *ApiHandler) multipartParts(chunkKey string, totalChunks int) (string, []CompletedPart, []int, int64) {
+	upload, ok := h.multipart.get(chunkKey)
+	if !ok {
+		upload = &multipartUpload{}
+	}
+
+	upload.mu.Lock()
+	uploadID := upload.uploadID
+	parts := make([]CompletedPart, 0, totalChunks)
+	missing := []int{}
+	var size int64
+	for i := range totalChunks {
+		part, ok := upload.parts[h.cfg.ChunkBase+i]
+		if !ok {
+			missing = append(missing, h.cfg.ChunkBase+i)
+			continue
+		}
+		parts = append(parts, part)
+		size += part.Size
+	}
+	upload.mu.Unlock()
+	slices.SortFunc(parts, func(a, b CompletedPart) int { return a.Number - b.Number })
+
+	return uploadID, parts, missing, size
+}
+
+// dryRunMultipart is dryRunMerge in multipart mode, where the parts already
+// live in the object store.
+func (h *ApiHandler) dryRunMultipart(c *fiber.Ctx, body *domain.MergeChunksRequest, chunkKey string) error {
+	_, _, missing, size := h.multipartParts(chunkKey, body.TotalChunks)
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":          false,
+		"message":        "Dry run completed, nothing was written",
+		"dry_run":        true,
+		"valid":          len(missing) == 0 && body.TotalChunks > 0,
+		"file":           body.FileName,
+		"size":           size,
+		"total_chunks":   body.TotalChunks,
+		"missing_chunks": missing,
+	})
+}
+
+// completeMultipart finishes a merge in multipart mode by asking the storage
+// to assemble the uploaded parts. It runs with the file lock held.
+func (h *ApiHandler) completeMultipart(ctx context.Context, run *mergeRun, body *domain.MergeChunksRequest, chunkKey string) (domain.MergeResult, error) {
+	uploadID, parts, missing, size := h.multipartParts(chunkKey, body.TotalChunks)
+	if len(missing) > 0 {
+		return domain.MergeResult{}, h.missingChunks(run, body, missing)
+	}
+	if len(parts) == 0 {
+		// Object stores cannot complete a multipart upload without parts
+		return domain.MergeResult{}, ErrInvalidRequest.WithMessage("Multipart storage needs at least one chunk")
+	}
+	if run.report != nil && body.TotalSize != nil {
+		matched := size == *body.TotalSize
+		run.report.SizeMatched = &matched
+	}
+	if body.TotalSize != nil && size != *body.TotalSize {
+		h.mergeFailed(run, body.FileName, fmt.Errorf("chunks hold %d bytes, expected %d", size, *body.TotalSize))
+		return domain.MergeResult{}, ErrSizeMismatch.With(fiber.Map{
+			"expected_size":   *body.TotalSize,
+			"actual_size":     size,
+			"last_chunk_size": parts[len(parts)-1].Size,
+		})
+	}
+
+	etag, err := h.cfg.MultipartStorage.CompleteUpload(ctx, body.FileName, uploadID, parts)
+	if err != nil {
+		h.mergeFailed(run, body.FileName, err)
+		return domain.MergeResult{}, ErrUpstream.WithMessage("Failed to complete multipart upload").Wrap(err)
+	}
+
+	h.multipart.remove(chunkKey)
+	h.progress.reset(chunkKey)
+	h.sequences.reset(chunkKey)
+	if body.UploadID != "" {
+		h.sessions.remove(body.UploadID)
+	}
+	h.mergeSucceeded(run, body.FileName, size, "")
+
+	return domain.MergeResult{FileName: body.FileName, Size: size, Appended: size, ETag: etag}, nil
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// multipartFormKey stores the form StreamedBody parsed in c.Locals.
+const multipartFormKey = "multipart_form"
+
+// errBodyTooLarge reports a streamed request body over the body limit.
+var errBodyTooLarge = errors.New("request body is too large")
+
+// streamedForm is a multipart form parsed by StreamedBody. fasthttp closes
+// it with the request, once the response is written, removing the files the
+// form spilled to disk.
+type streamedForm struct {
+	*multipart.Form
+}
+
+func (f streamedForm) Close() error {
+	if err := f.RemoveAll(); err != nil {
+		log.Printf("failed to remove spilled multipart files: %v", err)
+	}
+	return nil
+}
+
+// StreamedBody returns a middleware for a server streaming request bodies
+// (fiber's StreamRequestBody, with DisablePreParseMultipartForm). Streaming
+// skips the server's BodyLimit check, so this one enforces limit instead:
+// by Content-Length when it is sent, while reading otherwise.
+//
+// Multipart forms are parsed from the stream here, keeping at most
+// maxMemory bytes of file content in memory and spilling the rest to
+// temporary files; fasthttp's own parser has a fixed threshold. Other bodies
+// of unknown length are read up front, those of known length are left for
+// the handler.
+func StreamedBody(limit int, maxMemory int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		length := c.Request().Header.ContentLength()
+		if length > limit {
+			return RespondError(c, ErrBodyTooLarge.With(fiber.Map{"max_body_size": limit}))
+		}
+		stream := c.Context().RequestBodyStream()
+		if stream == nil {
+			return c.Next()
+		}
+		body := &limitedReader{r: stream, n: int64(limit)}
+
+		// Compressed forms are left to LimitDecompression, which decodes them
+		// within its limits
+		boundary := string(c.Request().Header.MultipartFormBoundary())
+		if boundary != "" && c.Get(fiber.HeaderContentEncoding) == "" {
+			form, err := multipart.NewReader(body, boundary).ReadForm(maxMemory)
+			if errors.Is(err, errBodyTooLarge) {
+				return RespondError(c, ErrBodyTooLarge.With(fiber.Map{"max_body_size": limit}))
+			}
+			if err != nil {
+				return RespondError(c, ErrInvalidRequest.WithMessage("Malformed multipart form").Wrap(err))
+			}
+			c.Locals(multipartFormKey, streamedForm{form})
+			return c.Next()
+		}
+
+		if length < 0 {
+			data, err := io.ReadAll(body)
+			if errors.Is(err, errBodyTooLarge) {
+				return RespondError(c, ErrBodyTooLarge.With(fiber.Map{"max_body_size": limit}))
+			}
+			if err != nil {
+				return RespondError(c, ErrInvalidRequest.WithMessage("Failed to read request body").Wrap(err))
+			}
+			c.Request().SetBody(data)
+		}
+
+		return c.Next()
+	}
+}
+
+// limitedReader reads from r, failing with errBodyTooLarge once more than n
+// bytes are read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// multipartForm returns the request's multipart form, parsed by StreamedBody
+// or else by fasthttp.
+func multipartForm(c *fiber.Ctx) (*multipart.Form, error) {
+	if form, ok := c.Locals(multipartFormKey).(streamedForm); ok {
+		return form.Form, nil
+	}
+	return c.MultipartForm()
+}
+
+// formFile returns the first file of the form field key, like c.FormFile.
+func formFile(c *fiber.Ctx, key string) (*multipart.FileHeader, error) {
+	form, err := multipartForm(c)
+	if err != nil {
+		return nil, err
+	}
+	files := form.File[key]
+	if len(files) == 0 {
+		return nil, fasthttp.ErrMissingFile
+	}
+	return files[0], nil
+}
+
+// bodyParser decodes the request body into out like c.BodyParser. A form
+// parsed by StreamedBody is decoded here, since fiber would try to read the
+// already consumed stream again.
+func bodyParser(c *fiber.Ctx, out any) error {
+	form, ok := c.Locals(multipartFormKey).(streamedForm)
+	if !ok {
+		return c.BodyParser(out)
+	}
+	return decodeForm(form.Value, out)
+}
+
+// decodeForm sets the fields of the struct out points to from the form
+// values named by their "form" tags. It covers the field types of the
+// domain requests: strings, booleans, integers and pointers to them.
+func decodeForm(values map[string][]string, out any) error {
+	target := reflect.ValueOf(out).Elem()
+	for i := 0; i < target.NumField(); i++ {
+		name := target.Type().Field(i).Tag.Get("form")
+		if name == "" || len(values[name]) == 0 {
+			continue
+		}
+
+		field := target.Field(i)
+		if field.Kind() == reflect.Pointer {
+			field.Set(reflect.New(field.Type().Elem()))
+			field = field.Elem()
+		}
+		raw := values[name][0]
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Bool:
+			value, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetBool(value)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetInt(value)
+		default:
+			return fmt.Errorf("%s: unsupported field type %s", name, field.Type())
+		}
+	}
+	return nil
+}
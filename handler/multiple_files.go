@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"mime/multipart"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+const (
+	// MultipleFilesReject answers a request with several files in its "file"
+	// field with 400: one chunk per request.
+	MultipleFilesReject = "reject"
+	// MultipleFilesSequential stores the files of the "file" field as
+	// consecutive chunks, starting at chunk_index.
+	MultipleFilesSequential = "sequential"
+)
+
+// chunkFiles returns the files of the request's "file" field, first among
+// them the one formFile returned. Several files are refused unless
+// Config.MultipleFiles lets them through as consecutive chunks of one upload.
+func (h *ApiHandler) chunkFiles(c *fiber.Ctx, first *multipart.FileHeader) ([]*multipart.FileHeader, error) {
+	form, err := multipartForm(c)
+	if err != nil || len(form.File["file"]) <= 1 {
+		return []*multipart.FileHeader{first}, nil
+	}
+	files := form.File["file"]
+
+	if h.cfg.MultipleFiles != MultipleFilesSequential {
+		return nil, ErrInvalidRequest.WithMessage("Send one chunk per request").With(fiber.Map{
+			"files": len(files),
+		})
+	}
+	if h.cfg.MultipartStorage != nil {
+		return nil, ErrInvalidRequest.WithMessage("Multipart storage takes one chunk per request")
+	}
+	for _, file := range files[1:] {
+		if file.Filename != first.Filename {
+			return nil, ErrInvalidRequest.WithMessage("All files of one request must be chunks of the same file")
+		}
+	}
+
+	return files, nil
+}
+
+// uploadSequential stores files as the chunks body.ChunkIndex onwards, one
+// after the other. A failure stops at that chunk; the ones before it stay
+// stored and are reported in stored_chunks, so the client can resume.
+func (h *ApiHandler) uploadSequential(c *fiber.Ctx, body *domain.UploadFileRequest, fileName, chunkKey string, files []*multipart.FileHeader) error {
+	client := clientIdentity(c)
+	chunks := make([]fiber.Map, 0, len(files))
+	var receivedBytes int64
+	var next int
+	var complete bool
+
+	for i, file := range files {
+		index := body.ChunkIndex + i
+		failed := func(err error) error {
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				apiErr = ErrInternal.Wrap(err)
+			}
+			return RespondError(c, apiErr.With(fiber.Map{
+				"chunk_index":   index,
+				"stored_chunks": chunks,
+			}))
+		}
+
+		request := *body
+		request.ChunkIndex = index
+		stored, apiErr := h.writeChunk(file, &request, fileName, chunkKey, client, nil)
+		if apiErr != nil {
+			return failed(apiErr)
+		}
+		receivedBytes, next, complete = stored.ReceivedBytes, stored.NextChunk, stored.Complete
+		chunks = append(chunks, fiber.Map{
+			"chunk_index": index,
+			"size":        stored.Size,
+			"checksum":    stored.Checksum,
+		})
+	}
+
+	h.setProgressHeaders(c, chunkKey)
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":          false,
+		"message":        "Files uploaded successfully",
+		"file":           fileName,
+		"chunks":         chunks,
+		"received_bytes": receivedBytes,
+		"next_chunk":     next,
+		"complete":       complete,
+	})
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUploadFileMultipleFiles(t *testing.T) {
+	// Each file fits MaxChunkSize, the request as a whole does not
+	const maxChunkSize, fileSize, files = 40 * 1024, 30 * 1024, 4
+	fields := map[string]string{"chunk_index": "0", "total_chunks": "4"}
+	chunks := make([]testFile, files)
+	var want []byte
+	for i := range chunks {
+		chunks[i] = testFile{name: "batch.bin", data: bytes.Repeat([]byte{byte('a' + i)}, fileSize)}
+		want = append(want, chunks[i].data...)
+	}
+
+	t.Run("sequential", func(t *testing.T) {
+		h := newTestHandler(t, Config{MaxChunkSize: maxChunkSize, MultipleFiles: MultipleFilesSequential})
+		app := newTestApp(h)
+
+		status, body := send(t, app, multipartRequest(t, fields, chunks...))
+		if status != fiber.StatusOK {
+			t.Fatalf("status %d: %v", status, body)
+		}
+		if stored, _ := body["chunks"].([]any); len(stored) != files {
+			t.Errorf("chunks = %v, want %d stored chunks", body["chunks"], files)
+		}
+		if body["complete"] != true || body["received_bytes"] != float64(len(want)) {
+			t.Errorf("complete = %v, received_bytes = %v, want a complete upload of %d bytes", body["complete"], body["received_bytes"], len(want))
+		}
+
+		if status, body = postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "batch.bin", "total_chunks": files}); status != fiber.StatusOK {
+			t.Fatalf("merge: status %d: %v", status, body)
+		}
+		data, err := os.ReadFile(h.filePath("batch.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Error("merged file does not hold the files in order")
+		}
+	})
+
+	t.Run("sequential file too large", func(t *testing.T) {
+		h := newTestHandler(t, Config{MaxChunkSize: maxChunkSize, MultipleFiles: MultipleFilesSequential})
+		app := newTestApp(h)
+		oversized := append([]testFile{}, chunks...)
+		oversized[2] = testFile{name: "batch.bin", data: make([]byte, maxChunkSize+1)}
+
+		status, body := send(t, app, multipartRequest(t, fields, oversized...))
+		if status != fiber.StatusRequestEntityTooLarge || body["code"] != ErrChunkTooLarge.Code {
+			t.Fatalf("status %d: %v, want 413 %s", status, body, ErrChunkTooLarge.Code)
+		}
+		if parts := partFiles(t); len(parts) != 0 {
+			t.Errorf("part files stored for a refused request: %v", parts)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		h := newTestHandler(t, Config{MultipleFiles: MultipleFilesReject})
+		app := newTestApp(h)
+
+		status, body := send(t, app, multipartRequest(t, fields, chunks...))
+		if status != fiber.StatusBadRequest || body["files"] != float64(files) {
+			t.Fatalf("status %d: %v, want 400 reporting %d files", status, body, files)
+		}
+	})
+}
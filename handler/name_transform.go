@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Built-in name transformers selectable by name with NameTransforms.
+const (
+	NameTransformLowercase  = "lowercase"
+	NameTransformSlugify    = "slugify"
+	NameTransformDatePrefix = "date-prefix"
+)
+
+var nameTransformers = map[string]func(string) string{
+	NameTransformLowercase:  strings.ToLower,
+	NameTransformSlugify:    SlugifyName,
+	NameTransformDatePrefix: DatePrefixName,
+}
+
+// NameTransforms returns a Config.NameTransformer applying the named
+// built-in transformers in order, or nil when there are none. Unknown names
+// are logged and ignored.
+func NameTransforms(names []string) func(string) string {
+	var transforms []func(string) string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		transform, ok := nameTransformers[name]
+		if !ok {
+			log.Printf("ignoring unknown name transform %q", name)
+			continue
+		}
+		transforms = append(transforms, transform)
+	}
+	if len(transforms) == 0 {
+		return nil
+	}
+
+	return func(name string) string {
+		for _, transform := range transforms {
+			name = transform(name)
+		}
+		return name
+	}
+}
+
+// SlugifyName lowercases name and replaces every run of characters other
+// than ASCII letters, digits, dots, hyphens and underscores with a hyphen,
+// dropping those at the start, the end and before a dot: "Quarterly Report
+// (final).PDF" becomes "quarterly-report-final.pdf".
+func SlugifyName(name string) string {
+	var b strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(name) {
+		if r >= unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-", r)) {
+			pending = true
+			continue
+		}
+		if pending && b.Len() > 0 && r != '.' {
+			b.WriteByte('-')
+		}
+		pending = false
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// DatePrefixName prefixes name with the current UTC date: "report.pdf"
+// stored on 1 May 2024 becomes "2024-05-01_report.pdf".
+func DatePrefixName(name string) string {
+	return time.Now().UTC().Format(time.DateOnly) + "_" + name
+}
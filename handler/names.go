@@ -0,0 +1,14 @@
+package handler
+
+import "strings"
+
+// validFileName reports whether name is a plain file name, so joining it to
+// the uploads or temp directory can never escape that directory or clobber a
+// sidecar file.
+func validFileName(name string) bool {
+	if name == "" || name == "." || name == ".." || isSidecarName(name) {
+		return false
+	}
+
+	return !strings.ContainsAny(name, "/\\\x00")
+}
@@ -0,0 +1,22 @@
+package handler
+
+// FileOwner is the owner and group merged files are given, for deployments
+// where another process, such as a web server, reads the uploads directory.
+// A negative ID leaves the respective part unchanged.
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// chownStored gives the stored file fileName the configured owner. Ownership
+// is a convenience for other readers of the files, so a failure, typically
+// the server lacking the privilege, is a warning rather than a failed merge.
+func (h *ApiHandler) chownStored(run *mergeRun, fileName string) {
+	if h.cfg.FileOwner == nil {
+		return
+	}
+	path := h.filePath(fileName)
+	if err := chown(path, h.cfg.FileOwner.UID, h.cfg.FileOwner.GID); err != nil {
+		run.warn("failed to change owner of %s: %v", fileName, err)
+	}
+}
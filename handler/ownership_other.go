@@ -0,0 +1,8 @@
+//go:build !unix
+
+package handler
+
+// chown does nothing: file ownership by numeric IDs is a Unix concept.
+func chown(path string, uid, gid int) error {
+	return nil
+}
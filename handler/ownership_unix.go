@@ -0,0 +1,10 @@
+//go:build unix
+
+package handler
+
+import "os"
+
+// chown changes the owner and group of path, leaving negative IDs alone.
+func chown(path string, uid, gid int) error {
+	return os.Lchown(path, uid, gid)
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errNoSpace is returned when the disk cannot hold a merged file.
+var errNoSpace = errors.New("not enough disk space for the merged file")
+
+// preallocateOutput reserves size bytes of disk space for output from its
+// current end, where the merge starts writing, when Config.PreallocateMerges
+// is set. Big files then get contiguous extents instead of growing a chunk
+// at a time, and a disk too small for the whole file fails the merge with
+// errNoSpace before anything is written. The file's size is left alone, so
+// appends and rollbacks work unchanged. Filesystems and platforms without
+// preallocation merge as before.
+func (h *ApiHandler) preallocateOutput(output *os.File, size int64) error {
+	if !h.cfg.PreallocateMerges || size <= 0 {
+		return nil
+	}
+	info, err := output.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = preallocate(output, info.Size(), size)
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return errNoSpace
+	case errors.Is(err, errors.ErrUnsupported), errors.Is(err, syscall.EOPNOTSUPP), errors.Is(err, syscall.ENOSYS):
+		return nil
+	}
+	return err
+}
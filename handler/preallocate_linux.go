@@ -0,0 +1,21 @@
+//go:build linux
+
+package handler
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE: allocate without growing the file.
+const fallocKeepSize = 0x1
+
+// preallocate allocates length bytes of file from offset with fallocate.
+func preallocate(file *os.File, offset, length int64) error {
+	for {
+		err := syscall.Fallocate(int(file.Fd()), fallocKeepSize, offset, length)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
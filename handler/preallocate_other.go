@@ -0,0 +1,13 @@
+//go:build !linux
+
+package handler
+
+import (
+	"errors"
+	"os"
+)
+
+// preallocate is not supported: only Linux allocates without growing the file.
+func preallocate(file *os.File, offset, length int64) error {
+	return errors.ErrUnsupported
+}
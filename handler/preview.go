@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// PreviewDir holds the files assembled from a subset of an upload's chunks.
+const PreviewDir = "./previews"
+
+// previewPath returns the preview path of the stored file name.
+func previewPath(name string) string {
+	return filepath.Join(PreviewDir, name)
+}
+
+// mergePreview assembles chunks From..To (inclusive) of the upload body
+// names into a preview of body.FileName, e.g. to render the start of a large
+// video before its upload completes. The chunks are read, never removed, and
+// the upload stays open. It takes a merge slot and the file lock like a merge.
+func (h *ApiHandler) mergePreview(c *fiber.Ctx, body *domain.MergeChunksRequest) error {
+	chunkKey, _, err := h.prepareMerge(c.UserContext(), body)
+	if err != nil {
+		return RespondError(c, err)
+	}
+	if body.From == nil || body.To == nil || *body.From < h.cfg.ChunkBase || *body.To < *body.From ||
+		(body.TotalChunks > 0 && *body.To >= h.cfg.ChunkBase+body.TotalChunks) {
+		return RespondError(c, ErrInvalidRequest.WithMessage(fmt.Sprintf("from and to must be chunk indices, from at least %d and to not before from", h.cfg.ChunkBase)))
+	}
+	if h.cfg.MultipartStorage != nil {
+		return RespondError(c, ErrInvalidRequest.WithMessage("Previews are not available with multipart storage"))
+	}
+
+	release, err := h.acquireMerge()
+	if err != nil {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return RespondError(c, err)
+	}
+	defer release()
+	unlock := h.lockFile(body.FileName)
+	defer unlock()
+
+	from, count := *body.From, *body.To-*body.From+1
+	_, missing, err := h.inspectChunks(chunkKey, from, count)
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to inspect chunks").Wrap(err))
+	}
+	if len(missing) > 0 {
+		return RespondError(c, ErrChunkMissing.With(fiber.Map{
+			"missing_chunks": missing,
+		}))
+	}
+
+	size, sums, err := h.writePreview(body.FileName, chunkKey, from, count)
+	if err != nil {
+		return storageError(c, "Failed to write preview", err)
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":    false,
+		"message":  "Preview merged successfully",
+		"preview":  true,
+		"file":     body.FileName,
+		"path":     filepath.ToSlash(previewPath(body.FileName)),
+		"from":     from,
+		"to":       *body.To,
+		"size":     size,
+		"checksum": sums[HashSHA256],
+	})
+}
+
+// writePreview streams count chunks of chunkKey starting at from into the
+// preview of fileName, replacing an earlier preview atomically.
+func (h *ApiHandler) writePreview(fileName, chunkKey string, from, count int) (int64, map[string]string, error) {
+	if err := os.MkdirAll(PreviewDir, os.ModePerm); err != nil {
+		return 0, nil, err
+	}
+	preview, err := os.CreateTemp(PreviewDir, ".preview-*")
+	if err != nil {
+		return 0, nil, err
+	}
+	defer os.Remove(preview.Name()) // Fails harmlessly once renamed
+	defer preview.Close()
+
+	digests := h.newDigester()
+	size, err := h.copyChunks(io.MultiWriter(preview, digests), chunkKey, from, count)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := preview.Chmod(0o644); err != nil {
+		return 0, nil, err
+	}
+	if err := preview.Close(); err != nil {
+		return 0, nil, err
+	}
+	if err := os.Rename(preview.Name(), previewPath(fileName)); err != nil {
+		return 0, nil, err
+	}
+
+	return size, digests.sums(), nil
+}
+
+// copyChunks copies count chunks of chunkKey starting at from to w, in
+// order, and returns the bytes written.
+func (h *ApiHandler) copyChunks(w io.Writer, chunkKey string, from, count int) (int64, error) {
+	buf := getBuffer(h.cfg.BufferSize)
+	defer putBuffer(buf)
+
+	var size int64
+	for index := from; index < from+count; index++ {
+		path, _ := h.chunks.path(chunkKey, index)
+		n, err := copyChunk(w, path, *buf)
+		if err != nil {
+			return size, fmt.Errorf("failed to copy chunk %d: %w", index, err)
+		}
+		size += n
+	}
+
+	return size, nil
+}
+
+// copyChunk copies the part file at path to w.
+func copyChunk(w io.Writer, path string, buf []byte) (int64, error) {
+	chunk, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer chunk.Close()
+
+	return io.CopyBuffer(w, chunk, buf)
+}
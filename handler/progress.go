@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Headers repeating an upload's progress on chunk upload responses, for
+// clients and proxies that would rather not parse the body.
+const (
+	// ReceivedChunksHeader is the number of distinct chunks received so far
+	ReceivedChunksHeader = "X-Upload-Received-Chunks"
+	// TotalBytesHeader is the number of bytes those chunks hold
+	TotalBytesHeader = "X-Upload-Total-Bytes"
+)
+
+// chunkInfo is what the server remembers about a received chunk.
+type chunkInfo struct {
+	size int64
+	// checksum is the hex encoded SHA-256 computed while the chunk was
+	// written, empty when it was not hashed (e.g. multipart storage)
+	checksum string
+}
+
+// fileProgress holds the chunks received for one file. next is the first
+// index not received yet, i.e. the end of the contiguous run from the base.
+type fileProgress struct {
+	chunks map[int]chunkInfo
+	next   int
+}
+
+// progressRegistry tracks the chunks received per file since its last merge.
+// Re-uploading a chunk replaces its entry, so retries are not counted twice.
+type progressRegistry struct {
+	mu    sync.Mutex
+	files map[string]*fileProgress
+}
+
+func newProgressRegistry() *progressRegistry {
+	return &progressRegistry{files: make(map[string]*fileProgress)}
+}
+
+// record stores chunk index of fileName, whose chunks are numbered from
+// base. It returns the total bytes received for the file so far and the next
+// chunk index the client is expected to send.
+func (r *progressRegistry) record(fileName string, base, index int, info chunkInfo) (int64, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress, ok := r.files[fileName]
+	if !ok {
+		progress = &fileProgress{chunks: make(map[int]chunkInfo), next: base}
+		r.files[fileName] = progress
+	}
+	progress.chunks[index] = info
+	for {
+		if _, ok := progress.chunks[progress.next]; !ok {
+			break
+		}
+		progress.next++
+	}
+
+	var total int64
+	for _, chunk := range progress.chunks {
+		total += chunk.size
+	}
+
+	return total, progress.next
+}
+
+// checksum returns the SHA-256 recorded for chunk index of fileName.
+func (r *progressRegistry) checksum(fileName string, index int) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress, ok := r.files[fileName]
+	if !ok {
+		return "", false
+	}
+	chunk, ok := progress.chunks[index]
+	return chunk.checksum, ok && chunk.checksum != ""
+}
+
+// chunk returns what was recorded for chunk index of fileName.
+func (r *progressRegistry) chunk(fileName string, index int) (chunkInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress, ok := r.files[fileName]
+	if !ok {
+		return chunkInfo{}, false
+	}
+	chunk, ok := progress.chunks[index]
+	return chunk, ok
+}
+
+// totals returns how many chunks of fileName were received and how many
+// bytes they hold.
+func (r *progressRegistry) totals(fileName string) (int, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress, ok := r.files[fileName]
+	if !ok {
+		return 0, 0
+	}
+	var total int64
+	for _, chunk := range progress.chunks {
+		total += chunk.size
+	}
+	return len(progress.chunks), total
+}
+
+// reset forgets fileName, after it was merged or abandoned.
+func (r *progressRegistry) reset(fileName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.files, fileName)
+}
+
+// setProgressHeaders sets the progress headers of the upload chunkKey
+// identifies on the response.
+func (h *ApiHandler) setProgressHeaders(c *fiber.Ctx, chunkKey string) {
+	chunks, size := h.progress.totals(chunkKey)
+	c.Set(ReceivedChunksHeader, strconv.Itoa(chunks))
+	c.Set(TotalBytesHeader, strconv.FormatInt(size, 10))
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// publishTimeout bounds a single publish attempt.
+const publishTimeout = 5 * time.Second
+
+// Publisher hands events about newly stored files to a queue (NATS, Redis,
+// Kafka...) so downstream workers can post-process them asynchronously. See
+// the publisher/redis package for a Redis implementation.
+type Publisher interface {
+	Publish(ctx context.Context, event domain.FileStoredEvent) error
+}
+
+// NopPublisher discards every event. It is the default publisher.
+type NopPublisher struct{}
+
+func (NopPublisher) Publish(context.Context, domain.FileStoredEvent) error {
+	return nil
+}
+
+// publish sends event in the background so a slow or unavailable queue never
+// delays the merge response. Failures are logged.
+func (h *ApiHandler) publish(event domain.FileStoredEvent) {
+	if _, ok := h.cfg.Publisher.(NopPublisher); ok {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+
+		if err := h.cfg.Publisher.Publish(ctx, event); err != nil {
+			log.Printf("failed to publish stored file %s: %v", event.FileName, err)
+		}
+	}()
+}
@@ -0,0 +1,515 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// StatusResumeIncomplete tells a client of a range upload that more bytes are
+// expected. It reuses 308 as the resumable upload protocols do.
+const StatusResumeIncomplete = fiber.StatusPermanentRedirect
+
+// RangeChecksumHeader optionally carries the hex encoded SHA-256 of the bytes
+// of a range upload request. When sent, the range is read back from the temp
+// file once written and compared with it.
+const RangeChecksumHeader = "X-Range-Checksum"
+
+// byteRange is the half-open range [Start, End) of received bytes.
+type byteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// rangeUpload tracks the bytes received so far for one file uploaded with
+// Content-Range requests.
+type rangeUpload struct {
+	total  int64
+	ranges []byteRange
+	// updated is when the upload was last requested, for the sweeper
+	updated time.Time
+}
+
+// rangeRegistry holds the in-progress range uploads keyed by file name.
+type rangeRegistry struct {
+	mu      sync.Mutex
+	uploads map[string]*rangeUpload
+}
+
+func newRangeRegistry() *rangeRegistry {
+	return &rangeRegistry{uploads: make(map[string]*rangeUpload)}
+}
+
+// get returns the upload of fileName and marks it as just used.
+func (r *rangeRegistry) get(fileName string) (*rangeUpload, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload, ok := r.uploads[fileName]
+	if ok {
+		upload.updated = time.Now()
+	}
+	return upload, ok
+}
+
+// add registers a new upload of total bytes for fileName.
+func (r *rangeRegistry) add(fileName string, total int64) *rangeUpload {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload := &rangeUpload{total: total, updated: time.Now()}
+	r.uploads[fileName] = upload
+	return upload
+}
+
+// remove drops the upload of fileName and reports whether there was one.
+func (r *rangeRegistry) remove(fileName string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.uploads[fileName]
+	delete(r.uploads, fileName)
+	return ok
+}
+
+// count returns the number of range uploads in progress.
+func (r *rangeRegistry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.uploads)
+}
+
+// idle returns the uploads last used before cutoff.
+func (r *rangeRegistry) idle(cutoff time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var names []string
+	for fileName, upload := range r.uploads {
+		if upload.updated.Before(cutoff) {
+			names = append(names, fileName)
+		}
+	}
+	return names
+}
+
+// expire drops the upload of fileName if it was last used before cutoff and
+// reports whether fileName is left without an upload.
+func (r *rangeRegistry) expire(fileName string, cutoff time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload, ok := r.uploads[fileName]
+	if !ok {
+		return true
+	}
+	if !upload.updated.Before(cutoff) {
+		return false
+	}
+	delete(r.uploads, fileName)
+	return true
+}
+
+// rangePath returns the sparse temp file receiving the ranges of fileName.
+func rangePath(fileName string) string {
+	return filepath.Join(TempDir, fileName+".range")
+}
+
+// UploadRange handles PUT /upload/:file_name. The body is written at the
+// offset given by "Content-Range: bytes start-end/total"; once [0, total) has
+// been received the file is moved into the uploads directory without a
+// separate merge. "Content-Range: bytes */total" with an empty body only
+// reports the progress. A new upload reserves its total size in the temp
+// directory up front and may announce at most Config.MaxRangeUploadSize.
+func (h *ApiHandler) UploadRange(c *fiber.Ctx) error {
+	if err := h.checkMaintenance(c); err != nil {
+		return RespondError(c, err)
+	}
+
+	// The name outlives the request as the key of the upload, and fiber's
+	// parameters point into the request buffer, which is reused
+	fileName := strings.Clone(c.Params("file_name"))
+	if !validFileName(fileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+
+	start, end, total, err := parseContentRange(c.Get(fiber.HeaderContentRange))
+	if err != nil {
+		return RespondError(c, ErrInvalidRequest.WithMessage("Invalid Content-Range header").Wrap(err))
+	}
+	if h.cfg.MaxRangeUploadSize > 0 && total > h.cfg.MaxRangeUploadSize {
+		return RespondError(c, ErrUploadTooLarge.With(fiber.Map{
+			"max_range_upload_size": h.cfg.MaxRangeUploadSize,
+		}))
+	}
+
+	// Ensure the temp and uploads directories exist, as UploadFile does
+	for _, dir := range []string{TempDir, UploadDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return RespondError(c, ErrInternal.WithMessage("Failed to prepare storage directories").Wrap(err))
+		}
+	}
+
+	unlock := h.lockFile(fileName)
+	defer unlock()
+
+	upload, ok := h.ranges.get(fileName)
+	if !ok {
+		// The sparse file takes its whole size once the first range is
+		// written, whatever part of it has been received
+		if !h.tempUsage.reserve(total) {
+			return RespondError(c, ErrStorageFull)
+		}
+		upload = h.ranges.add(fileName, total)
+	}
+
+	if upload.total != total {
+		return RespondError(c, ErrConflict.WithMessage(fmt.Sprintf("Total size %d does not match the %d bytes of the upload in progress", total, upload.total)))
+	}
+
+	// A status query carries no body ("bytes */total")
+	if start >= 0 {
+		data := c.Body()
+		if int64(len(data)) != end-start+1 {
+			return RespondError(c, ErrInvalidRequest.WithMessage(fmt.Sprintf("Body has %d bytes but Content-Range announces %d", len(data), end-start+1)))
+		}
+		if err := h.verifyRange(c, fileName, start, data); err != nil {
+			return RespondError(c, err)
+		}
+		expected := strings.ToLower(c.Get(RangeChecksumHeader))
+		if expected != "" && !validChecksum(expected) {
+			return RespondError(c, ErrInvalidRequest.WithMessage(RangeChecksumHeader+" must be a hex encoded SHA-256"))
+		}
+
+		// Every byte must be written exactly once; a range overlapping bytes
+		// already received would silently replace them
+		r := byteRange{Start: start, End: end + 1}
+		if conflicts := overlapping(upload.ranges, r); len(conflicts) > 0 {
+			return RespondError(c, ErrConflict.WithMessage(fmt.Sprintf("Range %d-%d overlaps bytes already received", start, end)).With(fiber.Map{
+				"overlapping": conflicts,
+				"holes":       holes(upload.ranges, total),
+			}))
+		}
+
+		if err := writeRange(rangePath(fileName), data, start, total); err != nil {
+			return storageError(c, "Failed to write range", err)
+		}
+		// The range is not recorded as received when it does not read back as
+		// sent, so the client can upload it again
+		if expected != "" {
+			actual, err := rangeChecksum(rangePath(fileName), start, end-start+1)
+			if err != nil {
+				return storageError(c, "Failed to read back range", err)
+			}
+			if actual != expected {
+				return RespondError(c, ErrChecksumMismatch.WithMessage(fmt.Sprintf("Range %d-%d does not match its checksum", start, end)).With(fiber.Map{
+					"expected_checksum": expected,
+					"actual_checksum":   actual,
+				}))
+			}
+		}
+
+		upload.ranges = addRange(upload.ranges, r)
+		h.audit(domain.AuditEvent{
+			Time:     time.Now(),
+			Action:   domain.AuditChunkReceived,
+			FileName: fileName,
+			Bytes:    int64(len(data)),
+			Client:   clientIdentity(c),
+			Status:   domain.MergeStatusSuccess,
+		})
+	}
+
+	if !fullyCovered(upload.ranges, total) {
+		if prefix := contiguousEnd(upload.ranges); prefix > 0 {
+			c.Set("Range", fmt.Sprintf("bytes=0-%d", prefix-1))
+		}
+		return Respond(c, StatusResumeIncomplete, fiber.Map{
+			"error":    false,
+			"message":  "Upload incomplete",
+			"file":     fileName,
+			"received": coveredBytes(upload.ranges),
+			"total":    total,
+			"ranges":   upload.ranges,
+			"holes":    holes(upload.ranges, total),
+		})
+	}
+
+	return h.completeRangeUpload(c, fileName, total)
+}
+
+// RangeStatus handles GET /upload/:file_name, reporting the byte ranges of a
+// range upload received so far and the holes still missing.
+func (h *ApiHandler) RangeStatus(c *fiber.Ctx) error {
+	fileName := c.Params("file_name")
+
+	// The ranges of an upload are only modified under its file lock
+	unlock := h.lockFile(fileName)
+	defer unlock()
+
+	upload, ok := h.ranges.get(fileName)
+	if !ok {
+		return RespondError(c, ErrNotFound.WithMessage("No range upload in progress for this file").With(fiber.Map{
+			"file": fileName,
+		}))
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":    false,
+		"file":     fileName,
+		"total":    upload.total,
+		"received": coveredBytes(upload.ranges),
+		"ranges":   upload.ranges,
+		"holes":    holes(upload.ranges, upload.total),
+		"complete": fullyCovered(upload.ranges, upload.total),
+	})
+}
+
+// completeRangeUpload moves a fully received range upload into the uploads
+// directory, following the collision policy like a merge does.
+func (h *ApiHandler) completeRangeUpload(c *fiber.Ctx, fileName string, total int64) error {
+	run := &mergeRun{client: clientIdentity(c)}
+	h.ranges.remove(fileName)
+
+	// An empty file is complete before any range has been written
+	if total == 0 {
+		if err := writeRange(rangePath(fileName), nil, 0, 0); err != nil {
+			h.mergeFailed(run, fileName, err)
+			return RespondError(c, ErrInternal.WithMessage("Failed to create empty file").Wrap(err))
+		}
+	}
+
+	size, sums, err := h.digestFile(rangePath(fileName))
+	if err == nil && size != total {
+		err = fmt.Errorf("assembled %d bytes, expected %d", size, total)
+	}
+	if err != nil {
+		h.mergeFailed(run, fileName, err)
+		return RespondError(c, ErrInternal.WithMessage("Failed to verify uploaded file").Wrap(err))
+	}
+
+	outName, nameErr := h.storedName(fileName)
+	if nameErr != nil {
+		h.mergeFailed(run, fileName, nameErr)
+		return RespondError(c, nameErr)
+	}
+	// Claim the final name first, then move the finished file over it
+	output, err := h.openOutput(outName, false, false)
+	if err == nil {
+		output.Close()
+		outName = output.name
+		if err = moveAcross(rangePath(fileName), output.writtenPath()); err == nil {
+			err = output.commit()
+		} else {
+			output.discard()
+		}
+	}
+	if err != nil {
+		h.mergeFailed(run, fileName, err)
+		apiErr := ErrInternal.WithMessage("Failed to store uploaded file").Wrap(err).With(fiber.Map{
+			"file": fileName,
+		})
+		if errors.Is(err, errFileExists) {
+			apiErr = fileExistsError(fileName, err)
+		}
+		return RespondError(c, apiErr)
+	}
+
+	if err := h.mirrorFile(run, outName); err != nil {
+		h.mergeFailed(run, fileName, err)
+		return RespondError(c, ErrInternal.WithMessage("Failed to write mirror destination").Wrap(err))
+	}
+
+	checksum := sums[HashSHA256]
+	if err := h.storeObject(h.filePath(outName), checksum); err != nil {
+		h.mergeFailed(run, fileName, err)
+		return storageError(c, "Failed to store object", err)
+	}
+	if _, err := h.storeMetadata(outName, fileName, size, sums, nil, false, false); err != nil {
+		h.mergeFailed(run, fileName, err)
+		return RespondError(c, ErrInternal.WithMessage("Failed to write file metadata").Wrap(err))
+	}
+	h.chownStored(run, outName)
+
+	c.Set(fiber.HeaderETag, formatETag(checksum))
+	h.stats.fileStored(size, output.replacing, output.replaced)
+	h.mergeSucceeded(run, outName, size, checksum)
+
+	return Respond(c, fiber.StatusCreated, fiber.Map{
+		"error":    false,
+		"message":  "File uploaded successfully",
+		"file":     outName,
+		"size":     size,
+		"checksum": checksum,
+		"digests":  sums,
+	})
+}
+
+// writeRange writes data at offset start of the sparse file at path, sizing
+// the file to total bytes on first use.
+func writeRange(path string, data []byte, start, total int64) error {
+	file, err := openNoFollow(path, os.O_CREATE|os.O_WRONLY, 0o666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != total {
+		if err := file.Truncate(total); err != nil {
+			return err
+		}
+	}
+
+	_, err = file.WriteAt(data, start)
+	return err
+}
+
+// rangeChecksum returns the hex encoded SHA-256 of the length bytes of the
+// file at path from start.
+func rangeChecksum(path string, start, length int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, start, length)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// parseContentRange parses "bytes start-end/total". For "bytes */total"
+// start and end are -1.
+func parseContentRange(header string) (start, end, total int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("expected \"bytes start-end/total\", got %q", header)
+	}
+
+	rangeSpec, totalSpec, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("missing total size in %q", header)
+	}
+	total, err = strconv.ParseInt(totalSpec, 10, 64)
+	if err != nil || total < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid total size %q", totalSpec)
+	}
+
+	if rangeSpec == "*" {
+		return -1, -1, total, nil
+	}
+
+	startSpec, endSpec, ok := strings.Cut(rangeSpec, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid range %q", rangeSpec)
+	}
+	start, err = strconv.ParseInt(startSpec, 10, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid range start %q", startSpec)
+	}
+	end, err = strconv.ParseInt(endSpec, 10, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid range end %q", endSpec)
+	}
+	if start < 0 || end < start || end >= total {
+		return 0, 0, 0, fmt.Errorf("range %d-%d is outside of 0-%d", start, end, total-1)
+	}
+
+	return start, end, total, nil
+}
+
+// addRange inserts r into the sorted ranges, coalescing touching and
+// overlapping ranges.
+func addRange(ranges []byteRange, r byteRange) []byteRange {
+	ranges = append(ranges, r)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+
+	merged := ranges[:1]
+	for _, next := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if next.Start <= last.End {
+			last.End = max(last.End, next.End)
+			continue
+		}
+		merged = append(merged, next)
+	}
+
+	return merged
+}
+
+// contiguousEnd returns how many bytes have been received from offset 0
+// without a gap.
+func contiguousEnd(ranges []byteRange) int64 {
+	if len(ranges) == 0 || ranges[0].Start != 0 {
+		return 0
+	}
+
+	return ranges[0].End
+}
+
+// overlapping returns the received ranges sharing at least one byte with r.
+func overlapping(ranges []byteRange, r byteRange) []byteRange {
+	var conflicts []byteRange
+	for _, existing := range ranges {
+		if existing.Start < r.End && r.Start < existing.End {
+			conflicts = append(conflicts, existing)
+		}
+	}
+
+	return conflicts
+}
+
+// holes returns the ranges of [0, total) not received yet.
+func holes(ranges []byteRange, total int64) []byteRange {
+	missing := []byteRange{}
+	var offset int64
+	for _, r := range ranges {
+		if r.Start > offset {
+			missing = append(missing, byteRange{Start: offset, End: r.Start})
+		}
+		offset = r.End
+	}
+	if offset < total {
+		missing = append(missing, byteRange{Start: offset, End: total})
+	}
+
+	return missing
+}
+
+// coveredBytes returns the number of bytes received.
+func coveredBytes(ranges []byteRange) int64 {
+	var n int64
+	for _, r := range ranges {
+		n += r.End - r.Start
+	}
+
+	return n
+}
+
+// fullyCovered reports whether ranges cover exactly [0, total).
+func fullyCovered(ranges []byteRange, total int64) bool {
+	if total == 0 {
+		return len(ranges) == 0
+	}
+
+	return len(ranges) == 1 && ranges[0].Start == 0 && ranges[0].End == total
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// putRange sends data as the range of fileName given by contentRange.
+func putRange(t *testing.T, app *fiber.App, fileName, contentRange string, data []byte) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPut, "/upload/"+fileName, bytes.NewReader(data))
+	req.Header.Set(fiber.HeaderContentRange, contentRange)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestUploadRangeTotalLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		status int
+		code   string
+	}{
+		{name: "max range upload size", cfg: Config{MaxRangeUploadSize: 10}, status: fiber.StatusRequestEntityTooLarge, code: ErrUploadTooLarge.Code},
+		{name: "max temp size", cfg: Config{MaxTempSize: 10}, status: fiber.StatusInsufficientStorage, code: ErrStorageFull.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.cfg)
+			app := fiber.New()
+			app.Put("/upload/:file_name", Recover(h.UploadRange))
+
+			// Only four bytes are sent, but the file will take all twenty
+			status, body := putRange(t, app, "big.bin", "bytes 0-3/20", []byte("abcd"))
+			if status != tt.status || body["code"] != tt.code {
+				t.Fatalf("status %d: %v, want %d %s", status, body, tt.status, tt.code)
+			}
+			if _, ok := h.ranges.get("big.bin"); ok {
+				t.Error("refused range upload was registered")
+			}
+			if _, err := os.Stat(rangePath("big.bin")); !os.IsNotExist(err) {
+				t.Errorf("refused range upload left its file: %v", err)
+			}
+
+			status, body = putRange(t, app, "small.bin", "bytes 0-3/10", []byte("abcd"))
+			if status != StatusResumeIncomplete {
+				t.Errorf("upload within the limit: status %d: %v, want %d", status, body, StatusResumeIncomplete)
+			}
+		})
+	}
+}
+
+func TestSweepRanges(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := fiber.New()
+	app.Put("/upload/:file_name", Recover(h.UploadRange))
+	for _, fileName := range []string{"idle.bin", "active.bin"} {
+		if status, body := putRange(t, app, fileName, "bytes 0-3/8", []byte("abcd")); status != StatusResumeIncomplete {
+			t.Fatalf("upload of %s: status %d: %v", fileName, status, body)
+		}
+	}
+	// A file left by an upload lost in a restart has no registry entry
+	old := time.Now().Add(-time.Hour)
+	orphan := filepath.Join(TempDir, "orphan.bin.range")
+	if err := os.WriteFile(orphan, []byte("abcd"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{orphan, rangePath("idle.bin"), rangePath("active.bin")} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cutoff := time.Now().Add(-time.Minute)
+	idle, _ := h.ranges.get("idle.bin")
+	idle.updated = old
+
+	if removed := h.sweepRanges(cutoff); removed != 2 {
+		t.Errorf("sweep removed %d files, want the idle and the orphaned one", removed)
+	}
+	for _, path := range []string{orphan, rangePath("idle.bin")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s is left after the sweep: %v", path, err)
+		}
+	}
+	if _, ok := h.ranges.get("idle.bin"); ok {
+		t.Error("idle range upload is still registered")
+	}
+
+	// A used upload is kept, whatever the age of its file
+	if _, ok := h.ranges.get("active.bin"); !ok {
+		t.Fatal("active range upload was swept")
+	}
+	if _, err := os.Stat(rangePath("active.bin")); err != nil {
+		t.Errorf("file of the active range upload: %v", err)
+	}
+	if status, body := putRange(t, app, "active.bin", "bytes 4-7/8", []byte("efgh")); status != fiber.StatusCreated {
+		t.Errorf("completing the active upload: status %d: %v, want 201", status, body)
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// MergeRecorder persists every completed merge so the upload history can be
+// queried without scanning the uploads directory. It is optional; see the
+// recorder/sqlite package for a SQLite implementation.
+type MergeRecorder interface {
+	RecordMerge(record domain.MergeRecord) error
+	// RecentMerges returns up to limit records, newest first.
+	RecentMerges(limit int) ([]domain.MergeRecord, error)
+}
+
+const (
+	defaultRecentLimit = 50
+	maxRecentLimit     = 1000
+)
+
+// recordMerge hands record to the configured recorder. A failing recorder
+// is logged; the file is already stored, so the merge still succeeds.
+func (h *ApiHandler) recordMerge(record domain.MergeRecord) {
+	if h.cfg.MergeRecorder == nil {
+		return
+	}
+
+	if err := h.cfg.MergeRecorder.RecordMerge(record); err != nil {
+		log.Printf("failed to record merge of %s: %v", record.FileName, err)
+	}
+}
+
+// RecentUploads handles GET /uploads/recent?limit=N, listing the latest
+// merges from the recorder.
+func (h *ApiHandler) RecentUploads(c *fiber.Ctx) error {
+	if h.cfg.MergeRecorder == nil {
+		return RespondError(c, ErrNotImplemented.WithMessage("No merge recorder is configured"))
+	}
+
+	limit := defaultRecentLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return RespondError(c, ErrInvalidRequest.WithMessage("limit must be a positive integer"))
+		}
+		limit = min(n, maxRecentLimit)
+	}
+
+	records, err := h.cfg.MergeRecorder.RecentMerges(limit)
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to query merge history").Wrap(err))
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":   false,
+		"uploads": records,
+	})
+}
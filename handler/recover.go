@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Recover wraps a route handler so a panic inside it is logged with its stack
+// trace and answered with the standard error envelope and a 500, instead of
+// taking down the connection with a plain text response. The panic is
+// logged as one structured record with the request's method, path and
+// X-Request-ID, when the client or a proxy sent one, so it can be matched to
+// the request that triggered it.
+func Recover(next fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				attrs := []any{
+					slog.String("method", c.Method()),
+					slog.String("path", c.Path()),
+					slog.String("panic", fmt.Sprint(r)),
+					slog.String("stack", string(debug.Stack())),
+				}
+				if id := c.Get(fiber.HeaderXRequestID); id != "" {
+					attrs = append(attrs, slog.String("request_id", id))
+				}
+				slog.Error("panic while handling request", attrs...)
+				err = RespondError(c, ErrInternal)
+			}
+		}()
+
+		return next(c)
+	}
+}
+
+// RecoverMiddleware is Recover for the whole app. Registered first, it also
+// covers the middlewares after it, which route wrappers do not.
+func RecoverMiddleware(c *fiber.Ctx) error {
+	return Recover((*fiber.Ctx).Next)(c)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRecoverRespondsWithEnvelope(t *testing.T) {
+	app := fiber.New()
+	app.Get("/panic", Recover(func(c *fiber.Ctx) error {
+		panic("handler bug")
+	}))
+
+	status, body := send(t, app, httptest.NewRequest(fiber.MethodGet, "/panic", nil))
+	if status != fiber.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", status)
+	}
+	if body["error"] != true || body["code"] != ErrInternal.Code || body["message"] != ErrInternal.Message {
+		t.Errorf("body = %v, want the %s envelope", body, ErrInternal.Code)
+	}
+	if len(body) != 3 {
+		t.Errorf("body = %v, want only error, code and message", body)
+	}
+}
+
+func TestRecoverLogsStack(t *testing.T) {
+	output := captureLog(t)
+	app := fiber.New()
+	app.Get("/panic", Recover(func(c *fiber.Ctx) error {
+		panic("handler bug")
+	}))
+
+	req := httptest.NewRequest(fiber.MethodGet, "/panic", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "req-42")
+	if status, _ := send(t, app, req); status != fiber.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", status)
+	}
+
+	logged := output.String()
+	for _, want := range []string{"goroutine ", "runtime/debug.Stack", "path=/panic", "request_id=req-42", `panic="handler bug"`} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log lacks %q:\n%s", want, logged)
+		}
+	}
+}
+
+// captureLog redirects the standard logger, which slog's default handler
+// writes through too, to the returned buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	output := new(bytes.Buffer)
+	previous := log.Writer()
+	log.SetOutput(output)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return output
+}
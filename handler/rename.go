@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// RenameFile handles POST /files/rename, giving a merged file and its
+// metadata sidecar a new name within the uploads directory. An existing file
+// at the new name is handled by the collision policy, like a merge would.
+func (h *ApiHandler) RenameFile(c *fiber.Ctx) error {
+	if err := h.checkMaintenance(c); err != nil {
+		return RespondError(c, err)
+	}
+
+	body := new(domain.RenameFileRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+	if !validFileName(body.FileName) || !validFileName(body.NewName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+	// The new name is subject to the same naming policy as a merged one
+	newName, nameErr := h.storedName(body.NewName)
+	if nameErr != nil {
+		return RespondError(c, nameErr)
+	}
+	if newName == body.FileName {
+		return RespondError(c, ErrInvalidRequest.WithMessage("new_name must differ from file_name"))
+	}
+	// Renames are atomic within a directory only, and the destinations may
+	// be on different volumes
+	if h.fileDir(newName) != h.fileDir(body.FileName) {
+		return RespondError(c, ErrInvalidRequest.WithMessage("new_name is stored in another directory; renames cannot change a file's storage route"))
+	}
+
+	// Hold both locks, always taken in name order so two opposite renames
+	// cannot deadlock, so no merge writes either file meanwhile. A rename
+	// that only changes case under case-insensitive names takes one lock
+	first, second := body.FileName, newName
+	if h.cfg.CaseInsensitiveNames {
+		first, second = strings.ToLower(first), strings.ToLower(second)
+	}
+	if second < first {
+		first, second = second, first
+	}
+	unlockFirst := h.lockFile(first)
+	defer unlockFirst()
+	if second != first {
+		unlockSecond := h.lockFile(second)
+		defer unlockSecond()
+	}
+
+	info, err := os.Stat(h.filePath(body.FileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return RespondError(c, ErrFileNotFound.With(fiber.Map{
+				"file": body.FileName,
+			}))
+		}
+		return storageError(c, "Failed to read file", err)
+	}
+	// Read the sidecar first: a file without one is hashed under its old name
+	meta, err := h.storedMetadata(body.FileName, info.Size())
+	if err != nil {
+		return storageError(c, "Failed to read file metadata", err)
+	}
+
+	finalName, err := h.moveFile(body.FileName, newName)
+	if errors.Is(err, errFileExists) {
+		return RespondError(c, fileExistsError(newName, err))
+	}
+	if err != nil {
+		return storageError(c, "Failed to rename file", err)
+	}
+
+	if err := h.moveMetadata(meta, body.FileName, finalName); err != nil {
+		return storageError(c, "File renamed but its metadata was not", err)
+	}
+
+	h.audit(domain.AuditEvent{
+		Time:     time.Now(),
+		Action:   domain.AuditRename,
+		FileName: finalName,
+		Bytes:    meta.Size,
+		Client:   clientIdentity(c),
+		Status:   domain.MergeStatusSuccess,
+	})
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":        false,
+		"message":      "File renamed successfully",
+		"file":         finalName,
+		"renamed_from": body.FileName,
+		"size":         meta.Size,
+		"checksum":     meta.Checksum,
+		"metadata":     meta.Metadata,
+	})
+}
+
+// moveFile renames the stored file fileName to newName and returns the name
+// it ended up with. With the overwrite policy an existing newName is replaced
+// by a plain rename. The other policies hard link first, which fails
+// atomically when the name is taken, and only then remove the old name.
+func (h *ApiHandler) moveFile(fileName, newName string) (string, error) {
+	// The file itself is no conflict, so its name's case can be changed
+	names, err := h.storedNames(newName)
+	if err != nil {
+		return "", err
+	}
+	delete(names, strings.ToLower(fileName))
+	if existing, ok := caseConflict(names, newName); ok {
+		return "", &caseConflictError{existing: existing}
+	}
+
+	source := h.filePath(fileName)
+	if h.cfg.CollisionPolicy == CollisionOverwrite {
+		return newName, os.Rename(source, h.filePath(newName))
+	}
+
+	candidate := newName
+	for n := 1; ; n++ {
+		err := os.ErrExist
+		if _, ok := caseConflict(names, candidate); !ok {
+			err = os.Link(source, h.filePath(candidate))
+		}
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+		if h.cfg.CollisionPolicy == CollisionError {
+			return "", errFileExists
+		}
+		if n > maxRenameAttempts {
+			return "", fmt.Errorf("no free name for %s after %d attempts", newName, maxRenameAttempts)
+		}
+		candidate = numberedName(newName, n)
+	}
+
+	return candidate, os.Remove(source)
+}
+
+// moveMetadata writes meta, the sidecar of fileName, under newName and
+// removes the old one. Files stored before sidecars existed get one now.
+func (h *ApiHandler) moveMetadata(meta *domain.FileMetadata, fileName, newName string) error {
+	meta.FileName = newName
+	if err := h.writeMetadata(meta); err != nil {
+		return err
+	}
+	if err := os.Remove(h.metadataPath(fileName)); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove metadata of renamed file %s: %v", fileName, err)
+	}
+	if err := h.moveMergeLog(fileName, newName); err != nil {
+		log.Printf("failed to move merge log of renamed file %s: %v", fileName, err)
+	}
+
+	return nil
+}
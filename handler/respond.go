@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// MIMEApplicationMsgPack is the media type clients put in Accept to receive
+// MessagePack instead of JSON.
+const MIMEApplicationMsgPack = "application/msgpack"
+
+// Respond writes body with status, encoded as MessagePack when the Accept
+// header asks for it and as JSON otherwise. Every endpoint answers through it
+// so both encodings always carry the same fields, and error details are
+// hidden consistently when Config.HideErrorDetails is set.
+func Respond(c *fiber.Ctx, status int, body any) error {
+	body = hideDetails(c, status, body)
+	c.Vary(fiber.HeaderAccept)
+	c.Status(status)
+
+	switch c.Accepts(fiber.MIMEApplicationJSON, MIMEApplicationMsgPack, "application/x-msgpack") {
+	case MIMEApplicationMsgPack, "application/x-msgpack":
+		data, err := encodeMsgPack(body)
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, MIMEApplicationMsgPack)
+		return c.Send(data)
+	default:
+		return c.JSON(body)
+	}
+}
+
+// encodeMsgPack encodes body as MessagePack. The value goes through its JSON
+// form first so field names and omitempty rules match the JSON responses.
+func encodeMsgPack(body any) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return msgp.AppendIntf(nil, generic)
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// StorageRoutes parses "ext=dir" entries, such as "jpg=/mnt/images", into
+// Config.StorageRoutes. Several extensions may share a directory; repeating
+// an extension keeps the last entry. Malformed entries are logged and
+// ignored.
+func StorageRoutes(entries []string) map[string]string {
+	routes := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		ext, dir, ok := strings.Cut(entry, "=")
+		ext, dir = routeExtension(strings.TrimSpace(ext)), strings.TrimSpace(dir)
+		if !ok || ext == "." || dir == "" {
+			log.Printf("ignoring malformed storage route %q", entry)
+			continue
+		}
+		routes[ext] = dir
+	}
+	if len(routes) == 0 {
+		return nil
+	}
+
+	return routes
+}
+
+// routeExtension returns ext in the form routes are keyed by: lower case,
+// with its leading dot.
+func routeExtension(ext string) string {
+	return "." + strings.TrimPrefix(strings.ToLower(ext), ".")
+}
+
+// fileDir returns the directory the stored file name lives in: the
+// destination Config.StorageRoutes has for its extension, or UploadDir.
+// Extensions are compared in lower case, so every spelling of a name lands
+// in the same directory.
+func (h *ApiHandler) fileDir(name string) string {
+	if ext := filepath.Ext(name); ext != "" {
+		if dir, ok := h.cfg.StorageRoutes[routeExtension(ext)]; ok {
+			return dir
+		}
+	}
+	return UploadDir
+}
+
+// filePath returns the path of the stored file name.
+func (h *ApiHandler) filePath(name string) string {
+	return filepath.Join(h.fileDir(name), name)
+}
+
+// storageDirs returns UploadDir and every routed destination, each once.
+func (h *ApiHandler) storageDirs() []string {
+	dirs := []string{UploadDir}
+	for _, dir := range h.cfg.StorageRoutes {
+		if !containsDir(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func containsDir(dirs []string, dir string) bool {
+	for _, d := range dirs {
+		if filepath.Clean(d) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// moveAcross renames src to dst, copying it instead when a routed destination
+// is on another filesystem than src.
+func moveAcross(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := openNoFollow(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,52 @@
+package handler
+
+import "sync"
+
+// sequenceRegistry remembers the highest chunk sequence number seen per
+// upload. Sequences are optional; uploads that never send one are not tracked.
+type sequenceRegistry struct {
+	mu      sync.Mutex
+	highest map[string]int64
+	// locks serializes the requests of an upload carrying a sequence, from
+	// the check to the chunk being stored
+	locks *keyedMutex
+}
+
+func newSequenceRegistry() *sequenceRegistry {
+	return &sequenceRegistry{highest: make(map[string]int64), locks: newKeyedMutex()}
+}
+
+// lock takes the sequence lock of key and returns the function releasing it.
+// A sequence is checked under it and recorded before it is released, so no
+// other request of the upload passes the check with the same sequence.
+func (r *sequenceRegistry) lock(key string) func() {
+	return r.locks.Lock(key)
+}
+
+// check reports whether sequence is greater than every sequence recorded for
+// key, along with the highest one recorded.
+func (r *sequenceRegistry) check(key string, sequence int64) (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	highest, seen := r.highest[key]
+	return highest, !seen || sequence > highest
+}
+
+// advance records sequence for key once its chunk is stored.
+func (r *sequenceRegistry) advance(key string, sequence int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if highest, seen := r.highest[key]; !seen || sequence > highest {
+		r.highest[key] = sequence
+	}
+}
+
+// reset forgets key, after its upload was merged or abandoned.
+func (r *sequenceRegistry) reset(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.highest, key)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// uploadSequenced uploads data as chunk index of fileName with sequence.
+func uploadSequenced(t *testing.T, app *fiber.App, fileName string, index int, sequence int64, data []byte) (int, map[string]any) {
+	t.Helper()
+	fields := map[string]string{"chunk_index": strconv.Itoa(index), "sequence": strconv.FormatInt(sequence, 10)}
+	return send(t, app, multipartRequest(t, fields, testFile{name: fileName, data: data}))
+}
+
+func TestUploadFileSequenceConsumedOnceStored(t *testing.T) {
+	// Room for the retry and the chunk journal, but not for the first attempt
+	h := newTestHandler(t, Config{MaxTempSize: 512})
+	app := newTestApp(h)
+
+	status, body := uploadSequenced(t, app, "seq.bin", 0, 1, make([]byte, 1024))
+	if status != fiber.StatusInsufficientStorage {
+		t.Fatalf("first attempt: status %d: %v, want 507", status, body)
+	}
+	if status, body := uploadSequenced(t, app, "seq.bin", 0, 1, []byte("ok")); status != fiber.StatusOK {
+		t.Fatalf("retry with the sequence of the failed attempt: status %d: %v, want 200", status, body)
+	}
+	status, body = uploadSequenced(t, app, "seq.bin", 1, 1, []byte("ok"))
+	if status != fiber.StatusConflict || body["code"] != ErrStaleSequence.Code || body["highest_sequence"] != float64(1) {
+		t.Errorf("replay of a stored sequence: status %d: %v, want 409 %s", status, body, ErrStaleSequence.Code)
+	}
+}
+
+func TestUploadFileConcurrentSequence(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := newTestApp(h)
+
+	const requests = 8
+	statuses := make([]int, requests)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i], _ = uploadSequenced(t, app, "seq.bin", i, 5, []byte("chunk"))
+		}()
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, status := range statuses {
+		if status == fiber.StatusOK {
+			accepted++
+		} else if status != fiber.StatusConflict {
+			t.Errorf("status %d, want 200 or 409", status)
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("%d requests with the same sequence were accepted, want 1", accepted)
+	}
+}
+
+func TestStoreChunkSequence(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	ctx := context.Background()
+	store := func(index int, sequence int64) error {
+		_, err := h.StoreChunk(ctx, domain.StoreChunkRequest{FileName: "seq.bin", ChunkIndex: index, Data: []byte("chunk"), Sequence: &sequence})
+		return err
+	}
+
+	if err := store(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, sequence := range []int64{2, 1} {
+		if err := store(1, sequence); !errors.Is(err, ErrStaleSequence) {
+			t.Errorf("sequence %d after 2: err = %v, want %s", sequence, err, ErrStaleSequence.Code)
+		}
+	}
+	if err := store(1, 3); err != nil {
+		t.Errorf("sequence 3 after 2: %v", err)
+	}
+}
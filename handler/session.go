@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// IDGenerator creates the IDs of upload sessions.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc adapts a plain function, e.g. a deterministic one in
+// tests, to IDGenerator.
+type IDGeneratorFunc func() string
+
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// UUIDGenerator issues random UUIDv4 IDs. It is the default generator.
+type UUIDGenerator struct{}
+
+func (UUIDGenerator) NewID() string {
+	return uuid.NewString()
+}
+
+// uploadSession is an upload announced through POST /upload/init.
+type uploadSession struct {
+	FileName  string    `json:"file_name"`
+	ChunkSize int64     `json:"chunk_size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// sessionRegistry holds the upload sessions keyed by upload ID.
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{sessions: make(map[string]*uploadSession)}
+}
+
+func (r *sessionRegistry) get(uploadID string) (*uploadSession, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[uploadID]
+	return session, ok
+}
+
+func (r *sessionRegistry) remove(uploadID string) {
+	r.mu.Lock()
+	delete(r.sessions, uploadID)
+	r.mu.Unlock()
+}
+
+// resolveUpload returns the file name an upload targets and the key its
+// chunks are stored under. Without an upload ID both are the client's file
+// name; with one the chunks are namespaced by the ID and the name comes from
+// the session. A fileName that contradicts the session is rejected. The
+// errors are *Error sentinels, ready for RespondError.
+func (h *ApiHandler) resolveUpload(uploadID, fileName string) (string, string, error) {
+	if uploadID == "" {
+		if h.cfg.RequireUploadID {
+			return "", "", ErrSessionRequired
+		}
+		return fileName, fileName, nil
+	}
+
+	session, ok := h.sessions.get(uploadID)
+	if !ok {
+		return "", "", ErrSessionNotFound
+	}
+	if fileName != "" && fileName != session.FileName {
+		return "", "", ErrSessionMismatch
+	}
+
+	return session.FileName, uploadID, nil
+}
+
+// sessionChunkSize returns the chunk size negotiated for uploadID, or 0 when
+// the upload has no session.
+func (h *ApiHandler) sessionChunkSize(uploadID string) int64 {
+	if session, ok := h.sessions.get(uploadID); ok {
+		return session.ChunkSize
+	}
+	return 0
+}
+
+// unalignedChunks returns the indices of the chunks, other than the last,
+// whose size differs from chunkSize.
+func unalignedChunks(sizes []int64, base int, chunkSize int64) []int {
+	unaligned := []int{}
+	for i, size := range sizes[:max(len(sizes)-1, 0)] {
+		if size != chunkSize {
+			unaligned = append(unaligned, base+i)
+		}
+	}
+	return unaligned
+}
+
+// InitUpload handles POST /upload/init, opening an upload session and
+// returning its ID.
+func (h *ApiHandler) InitUpload(c *fiber.Ctx) error {
+	if err := h.checkMaintenance(c); err != nil {
+		return RespondError(c, err)
+	}
+
+	body := new(domain.InitUploadRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+	if !validFileName(body.FileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+
+	// The ID names the session's part files, so it must be a safe file name
+	uploadID := h.cfg.IDGenerator.NewID()
+	if !validFileName(uploadID) {
+		return RespondError(c, ErrInternal.WithMessage("Failed to create upload session").Wrap(fmt.Errorf("generated upload ID %q is not a valid file name", uploadID)))
+	}
+	h.sessions.mu.Lock()
+	h.sessions.sessions[uploadID] = &uploadSession{
+		FileName:  body.FileName,
+		ChunkSize: h.cfg.ChunkSize,
+		CreatedAt: time.Now(),
+	}
+	h.sessions.mu.Unlock()
+
+	return Respond(c, fiber.StatusCreated, fiber.Map{
+		"error":      false,
+		"message":    "Upload session created",
+		"upload_id":  uploadID,
+		"file_name":  body.FileName,
+		"chunk_size": h.cfg.ChunkSize,
+	})
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+const (
+	// defaultSignedURLTTL is how long a signed download URL stays valid when
+	// the request names no expiry.
+	defaultSignedURLTTL = time.Hour
+	// maxSignedURLTTL bounds the validity of a signed download URL.
+	maxSignedURLTTL = 7 * 24 * time.Hour
+)
+
+// signDownload returns the hex encoded HMAC-SHA256 of fileName and the expiry
+// under key. The newline keeps "a1" expiring at 23 apart from "a" at 123.
+func signDownload(key string, fileName string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(fileName + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RequireDownloadAuth returns a middleware for the download route that lets
+// requests through with one of keys in the X-API-Key header, or with an
+// unexpired "expires" and "signature" pair from SignDownload in the query.
+// Tampered or expired signatures get 403, requests with neither 401. Without
+// a signing key downloads stay open to everyone, as before signed URLs.
+func RequireDownloadAuth(keys []string, signingKey string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if signingKey == "" || validAPIKey(keys, c.Get(APIKeyHeader)) {
+			return c.Next()
+		}
+
+		signature, expiresParam := c.Query("signature"), c.Query("expires")
+		if signature == "" && expiresParam == "" {
+			return RespondError(c, ErrUnauthorized)
+		}
+		expires, err := strconv.ParseInt(expiresParam, 10, 64)
+		if err != nil {
+			return RespondError(c, ErrSignatureInvalid)
+		}
+		expected := signDownload(signingKey, c.Params("file_name"), expires)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			return RespondError(c, ErrSignatureInvalid)
+		}
+		// Only checked once the signature holds, so a forged expiry is
+		// reported as tampering rather than expiry
+		if time.Now().Unix() > expires {
+			return RespondError(c, ErrSignatureExpired)
+		}
+
+		return c.Next()
+	}
+}
+
+// SignDownload handles POST /download/sign, returning a URL that downloads
+// a stored file without an API key until it expires, after expires_in
+// seconds (default one hour, at most seven days).
+func (h *ApiHandler) SignDownload(c *fiber.Ctx) error {
+	if h.cfg.DownloadSigningKey == "" {
+		return RespondError(c, ErrNotImplemented.WithMessage("No download signing key is configured"))
+	}
+
+	body := new(domain.SignDownloadRequest)
+	if err := c.BodyParser(body); err != nil {
+		return RespondError(c, ErrInvalidRequest.Wrap(err))
+	}
+	if !validFileName(body.FileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+	ttl := defaultSignedURLTTL
+	if body.ExpiresIn != 0 {
+		ttl = time.Duration(body.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > maxSignedURLTTL {
+		return RespondError(c, ErrInvalidRequest.WithMessage("expires_in must be between 1 second and 7 days"))
+	}
+
+	if _, err := os.Stat(h.filePath(body.FileName)); err != nil {
+		if os.IsNotExist(err) {
+			return RespondError(c, ErrFileNotFound.With(fiber.Map{
+				"file": body.FileName,
+			}))
+		}
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file").Wrap(err))
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	expires := expiresAt.Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {signDownload(h.cfg.DownloadSigningKey, body.FileName, expires)},
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":      false,
+		"file":       body.FileName,
+		"url":        "/download/" + url.PathEscape(body.FileName) + "?" + query.Encode(),
+		"expires_at": expiresAt.UTC(),
+	})
+}
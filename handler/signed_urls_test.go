@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testSigningKey = "download-secret"
+
+// newSigningApp returns an app signing download URLs with testSigningKey and
+// serving downloads behind RequireDownloadAuth, with a.txt and b.txt stored.
+func newSigningApp(t *testing.T) *fiber.App {
+	t.Helper()
+	h := newTestHandler(t, Config{DownloadSigningKey: testSigningKey})
+	for _, fileName := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(h.filePath(fileName), []byte(fileName), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := fiber.New()
+	app.Post("/download/sign", h.SignDownload)
+	app.Get("/download/:file_name", RequireDownloadAuth([]string{"admin-key"}, testSigningKey), h.Download)
+	return app
+}
+
+// getSigned downloads target with the query values and returns the status
+// and, for errors, the error code.
+func getSigned(t *testing.T, app *fiber.App, target string, query url.Values, headers ...string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, target+"?"+query.Encode(), nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < fiber.StatusBadRequest {
+		return resp.StatusCode, ""
+	}
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	code, _ := body["code"].(string)
+	return resp.StatusCode, code
+}
+
+func TestSignedDownloadURLs(t *testing.T) {
+	app := newSigningApp(t)
+	status, body := postJSON(t, app, "/download/sign", map[string]any{"file_name": "a.txt"})
+	if status != fiber.StatusOK {
+		t.Fatalf("sign: status %d: %v", status, body)
+	}
+	signed, err := url.Parse(body["url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := signed.Query()
+	with := func(key, value string) url.Values {
+		query := url.Values{"expires": valid["expires"], "signature": valid["signature"]}
+		query.Set(key, value)
+		return query
+	}
+	expires, _ := strconv.ParseInt(valid.Get("expires"), 10, 64)
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name    string
+		target  string
+		query   url.Values
+		headers []string
+		status  int
+		code    string
+	}{
+		{name: "signed", target: signed.Path, query: valid, status: fiber.StatusOK},
+		{name: "api key", target: "/download/b.txt", headers: []string{APIKeyHeader, "admin-key"}, status: fiber.StatusOK},
+		{name: "neither", target: "/download/a.txt", status: fiber.StatusUnauthorized, code: ErrUnauthorized.Code},
+		{name: "tampered signature", target: signed.Path, query: with("signature", signDownload("other-key", "a.txt", expires)), status: fiber.StatusForbidden, code: ErrSignatureInvalid.Code},
+		{name: "extended expiry", target: signed.Path, query: with("expires", strconv.FormatInt(expires+3600, 10)), status: fiber.StatusForbidden, code: ErrSignatureInvalid.Code},
+		{name: "malformed expiry", target: signed.Path, query: with("expires", "tomorrow"), status: fiber.StatusForbidden, code: ErrSignatureInvalid.Code},
+		{name: "other file", target: "/download/b.txt", query: valid, status: fiber.StatusForbidden, code: ErrSignatureInvalid.Code},
+		{
+			name:   "expired",
+			target: signed.Path,
+			query:  url.Values{"expires": {strconv.FormatInt(expired, 10)}, "signature": {signDownload(testSigningKey, "a.txt", expired)}},
+			status: fiber.StatusForbidden,
+			code:   ErrSignatureExpired.Code,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := getSigned(t, app, tt.target, tt.query, tt.headers...)
+			if status != tt.status || code != tt.code {
+				t.Errorf("status %d %q, want %d %q", status, code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestSignDownloadRefuses(t *testing.T) {
+	app := newSigningApp(t)
+	tests := []struct {
+		name    string
+		request map[string]any
+		status  int
+		code    string
+	}{
+		{name: "missing file", request: map[string]any{"file_name": "missing.txt"}, status: fiber.StatusNotFound, code: ErrFileNotFound.Code},
+		{name: "negative expiry", request: map[string]any{"file_name": "a.txt", "expires_in": -1}, status: fiber.StatusBadRequest, code: ErrInvalidRequest.Code},
+		{name: "expiry past seven days", request: map[string]any{"file_name": "a.txt", "expires_in": int(maxSignedURLTTL/time.Second) + 1}, status: fiber.StatusBadRequest, code: ErrInvalidRequest.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := postJSON(t, app, "/download/sign", tt.request)
+			if status != tt.status || body["code"] != tt.code {
+				t.Errorf("status %d: %v, want %d %s", status, body, tt.status, tt.code)
+			}
+		})
+	}
+}
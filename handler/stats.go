@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// storageStats caches the number and total size of the stored files and of
+// the temp directory's chunks for GET /stats, so a dashboard polling it does
+// not walk both directories on every request. Like tempUsage, the counts
+// follow the chunks and files stored and are recomputed from disk by
+// startRefresher, which accounts for deleted and renamed files. Between
+// refreshes they are approximate.
+type storageStats struct {
+	// dirs are the directories stored files are counted in
+	dirs       []string
+	files      atomic.Int64
+	fileBytes  atomic.Int64
+	chunks     atomic.Int64
+	tempBytes  atomic.Int64
+	measuredAt atomic.Int64 // Unix nanoseconds of the last refresh
+}
+
+func newStorageStats(dirs []string) *storageStats {
+	s := &storageStats{dirs: dirs}
+	if err := s.refresh(); err != nil {
+		log.Printf("failed to measure storage: %v", err)
+	}
+
+	return s
+}
+
+// chunkStored accounts for a chunk of size bytes written to the temp
+// directory, replacing a part file of replaced bytes when replacing is set.
+func (s *storageStats) chunkStored(size int64, replacing bool, replaced int64) {
+	if !replacing {
+		s.chunks.Add(1)
+	}
+	s.tempBytes.Add(size - replaced)
+}
+
+// chunkRemoved accounts for a part file of size bytes removed from the temp
+// directory.
+func (s *storageStats) chunkRemoved(size int64) {
+	s.chunks.Add(-1)
+	s.tempBytes.Add(-size)
+}
+
+// fileStored accounts for a file of size bytes stored in the uploads
+// directory, replacing a stored file of replaced bytes when replacing is set,
+// as overwrites and appends do.
+func (s *storageStats) fileStored(size int64, replacing bool, replaced int64) {
+	if !replacing {
+		s.files.Add(1)
+	}
+	s.fileBytes.Add(size - replaced)
+}
+
+// refresh recomputes every count from the storage and temp directories.
+// Sidecar files are not counted as stored files; the temp bytes include
+// everything in the temp directory, as MaxTempSize does.
+func (s *storageStats) refresh() error {
+	var uploads []os.DirEntry
+	for _, dir := range s.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		uploads = append(uploads, entries...)
+	}
+	temp, err := os.ReadDir(TempDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var files, fileBytes, chunks, tempBytes int64
+	for _, entry := range uploads {
+		if isSidecarName(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			files++
+			fileBytes += info.Size()
+		}
+	}
+	for _, entry := range temp {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), partSuffix) {
+			chunks++
+		}
+		tempBytes += info.Size()
+	}
+
+	s.files.Store(files)
+	s.fileBytes.Store(fileBytes)
+	s.chunks.Store(chunks)
+	s.tempBytes.Store(tempBytes)
+	s.measuredAt.Store(time.Now().UnixNano())
+
+	return nil
+}
+
+// Stats handles GET /stats, a summary of storage usage for dashboards: the
+// stored files and their size, the chunks waiting in the temp directory and
+// the directory's size, and the uploads in progress.
+func (h *ApiHandler) Stats(c *fiber.Ctx) error {
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error": false,
+		"stats": domain.StorageStats{
+			Files:             h.stats.files.Load(),
+			FileBytes:         h.stats.fileBytes.Load(),
+			TempChunks:        h.stats.chunks.Load(),
+			TempBytes:         h.stats.tempBytes.Load(),
+			UploadsInProgress: h.chunks.keys() + h.ranges.count(),
+			MeasuredAt:        time.Unix(0, h.stats.measuredAt.Load()).UTC(),
+		},
+	})
+}
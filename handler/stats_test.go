@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// getStats returns the stats GET /stats reports.
+func getStats(t *testing.T, app *fiber.App) map[string]any {
+	t.Helper()
+	status, body := send(t, app, httptest.NewRequest(fiber.MethodGet, "/stats", nil))
+	if status != fiber.StatusOK {
+		t.Fatalf("stats: status %d: %v", status, body)
+	}
+	return body["stats"].(map[string]any)
+}
+
+func TestStatsCountReplacedFilesOnce(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		merges []map[string]any
+		size   int
+	}{
+		{name: "overwrite", merges: []map[string]any{{}, {}}, size: len("content")},
+		{name: "append", merges: []map[string]any{{}, {"append": true}}, size: 2 * len("content")},
+		// Renamed merges are new files
+		{name: "rename", cfg: Config{CollisionPolicy: CollisionRename}, merges: []map[string]any{{}, {}}, size: 2 * len("content")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.cfg)
+			app := newTestApp(h)
+			app.Get("/stats", h.Stats)
+			for _, merge := range tt.merges {
+				if status, body := uploadChunk(t, app, "stats.bin", 0, []byte("content")); status != fiber.StatusOK {
+					t.Fatalf("upload: status %d: %v", status, body)
+				}
+				merge["file_name"] = "stats.bin"
+				merge["total_chunks"] = 1
+				if status, body := postJSON(t, app, "/merge-chunk", merge); status != fiber.StatusOK {
+					t.Fatalf("merge: status %d: %v", status, body)
+				}
+			}
+
+			tracked := getStats(t, app)
+			if err := h.stats.refresh(); err != nil {
+				t.Fatal(err)
+			}
+			measured := getStats(t, app)
+			for _, field := range []string{"files", "file_bytes"} {
+				if tracked[field] != measured[field] {
+					t.Errorf("%s = %v before the refresh, %v on disk", field, tracked[field], measured[field])
+				}
+			}
+			if measured["file_bytes"] != float64(tt.size) {
+				t.Errorf("file_bytes = %v, want %d", measured["file_bytes"], tt.size)
+			}
+		})
+	}
+}
+
+func TestStatsCountRangeUploads(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	app := newTestApp(h)
+	app.Get("/stats", h.Stats)
+	app.Put("/upload/:file_name", Recover(h.UploadRange))
+	if status, body := uploadChunk(t, app, "chunked.bin", 0, []byte("chunk")); status != fiber.StatusOK {
+		t.Fatalf("upload: status %d: %v", status, body)
+	}
+	if status, body := putRange(t, app, "ranged.bin", "bytes 0-3/8", []byte("abcd")); status != StatusResumeIncomplete {
+		t.Fatalf("range upload: status %d: %v", status, body)
+	}
+
+	if stats := getStats(t, app); stats["uploads_in_progress"] != float64(2) {
+		t.Errorf("uploads_in_progress = %v, want the chunked and the range upload", stats["uploads_in_progress"])
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// notWritable reports whether err means the storage refuses writes, e.g.
+// because the volume was remounted read-only.
+func notWritable(err error) bool {
+	return errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+// tooManyOpenFiles reports whether err means the process or the system ran
+// out of file descriptors.
+func tooManyOpenFiles(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// filesExhausted answers a request that failed for lack of file descriptors.
+// The condition passes once other requests close their files, so clients are
+// told to retry instead of getting a 500.
+func filesExhausted(c *fiber.Ctx, err error) error {
+	c.Set(fiber.HeaderRetryAfter, "1")
+	return RespondError(c, ErrTooManyOpenFiles.Wrap(err))
+}
+
+// storageError answers a failed write to the storage directories. Storage
+// that has become read-only is reported as 503 so clients can tell it apart
+// from a one-off failure, as is running out of file descriptors.
+func storageError(c *fiber.Ctx, message string, err error) error {
+	if tooManyOpenFiles(err) {
+		return filesExhausted(c, err)
+	}
+	return RespondError(c, storageFailure(message, err))
+}
+
+// storageFailure returns the error storageError answers with, for callers
+// outside of an HTTP request.
+func storageFailure(message string, err error) *Error {
+	switch {
+	case tooManyOpenFiles(err):
+		return ErrTooManyOpenFiles.Wrap(err)
+	case notWritable(err):
+		return ErrStorageUnavailable.Wrap(err)
+	}
+	return ErrInternal.WithMessage(message).Wrap(err)
+}
+
+// checkWritable creates and removes a probe file in dir.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	probe, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+
+	return os.Remove(probe.Name())
+}
+
+// Ready handles GET /readyz. It fails with 503 while the temp directory or
+// one of the storage directories is not writable so orchestrators stop
+// routing uploads here.
+func (h *ApiHandler) Ready(c *fiber.Ctx) error {
+	for _, dir := range append([]string{TempDir}, h.storageDirs()...) {
+		if err := checkWritable(dir); err != nil {
+			return RespondError(c, ErrStorageUnavailable.Wrap(err).With(fiber.Map{
+				"ready": false,
+			}))
+		}
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error": false,
+		"ready": true,
+	})
+}
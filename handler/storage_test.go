@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUploadFileReadOnlyTempDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions do not restrict root")
+	}
+	h := newTestHandler(t, Config{})
+	app := newTestApp(h)
+	app.Get("/readyz", Recover(h.Ready))
+
+	if err := os.Chmod(TempDir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(TempDir, 0o755) })
+
+	status, body := uploadChunk(t, app, "photo.jpg", 0, []byte("chunk"))
+	if status != fiber.StatusServiceUnavailable {
+		t.Fatalf("upload to a read-only temp dir: status %d: %v", status, body)
+	}
+	if body["error"] != true || body["code"] != ErrStorageUnavailable.Code {
+		t.Errorf("upload to a read-only temp dir answered %v, want the %s envelope", body, ErrStorageUnavailable.Code)
+	}
+	if parts := partFiles(t); len(parts) != 0 {
+		t.Errorf("part files stored in a read-only temp dir: %v", parts)
+	}
+
+	status, body = send(t, app, httptest.NewRequest(fiber.MethodGet, "/readyz", nil))
+	if status != fiber.StatusServiceUnavailable || body["ready"] != false {
+		t.Errorf("readiness with a read-only temp dir: status %d: %v", status, body)
+	}
+}
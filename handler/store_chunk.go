@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// StoreChunk stores a chunk that arrived over a transport other than HTTP,
+// such as the gRPC service, with the checks of POST /upload-file: it lands
+// in the same temp directory, counts towards the upload's progress and is
+// merged with POST /merge-chunk. Errors are *Error values, with internal
+// details already removed when Config.HideErrorDetails is set.
+func (h *ApiHandler) StoreChunk(ctx context.Context, req domain.StoreChunkRequest) (domain.StoredChunk, error) {
+	_, span := h.tracer.Start(ctx, "StoreChunk")
+	defer span.End()
+
+	stored, err := h.storeChunkRequest(req)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && h.cfg.HideErrorDetails && apiErr.Err != nil {
+		log.Printf("chunk upload of %s failed: %v", req.FileName, err)
+		err = apiErr.Wrap(nil)
+	}
+	return stored, err
+}
+
+func (h *ApiHandler) storeChunkRequest(req domain.StoreChunkRequest) (domain.StoredChunk, error) {
+	if err := h.maintenanceError(); err != nil {
+		return domain.StoredChunk{}, err
+	}
+	if req.ChunkIndex < h.cfg.ChunkBase {
+		return domain.StoredChunk{}, ErrInvalidRequest.WithMessage(fmt.Sprintf("chunk_index must be at least %d", h.cfg.ChunkBase))
+	}
+	if req.UploadID == "" && !validFileName(req.FileName) {
+		return domain.StoredChunk{}, ErrInvalidFileName
+	}
+	size := int64(len(req.Data))
+	if h.cfg.MaxChunkSize > 0 && size > h.cfg.MaxChunkSize {
+		return domain.StoredChunk{}, ErrChunkTooLarge.With(fiber.Map{"max_chunk_size": h.cfg.MaxChunkSize})
+	}
+	if err := h.verifyChunk(req.Signature, req.FileName, int64(req.ChunkIndex), bytes.NewReader(req.Data)); err != nil {
+		return domain.StoredChunk{}, err
+	}
+
+	fileName, chunkKey, err := h.resolveUpload(req.UploadID, req.FileName)
+	if err != nil {
+		return domain.StoredChunk{}, err
+	}
+	if chunkSize := h.sessionChunkSize(req.UploadID); chunkSize > 0 && size > chunkSize {
+		return domain.StoredChunk{}, ErrInvalidRequest.WithMessage("Chunk exceeds the upload's chunk size").With(fiber.Map{
+			"chunk_size": chunkSize,
+		})
+	}
+	if h.cfg.MultipartStorage != nil {
+		return domain.StoredChunk{}, ErrNotImplemented.WithMessage("Multipart storage takes chunks over HTTP only")
+	}
+
+	// Like UploadFile, make sure the merge finds both storage directories
+	for _, dir := range []string{UploadDir, TempDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return domain.StoredChunk{}, storageFailure("Failed to create storage directory", err)
+		}
+	}
+
+	release, err := h.checkSequence(req.Sequence, chunkKey)
+	if err != nil {
+		return domain.StoredChunk{}, err
+	}
+	defer release()
+
+	body := &domain.UploadFileRequest{ChunkIndex: req.ChunkIndex, UploadID: req.UploadID, Sequence: req.Sequence}
+	stored, apiErr := h.saveChunk(bytes.NewReader(req.Data), size, body, fileName, chunkKey, req.Client, nil)
+	if apiErr != nil {
+		return domain.StoredChunk{}, apiErr
+	}
+	return stored, nil
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// startChunkSweeper periodically removes part files older than the configured
+// chunk retention, until the handler is closed.
+func (h *ApiHandler) startChunkSweeper() {
+	interval := max(h.cfg.ChunkRetention/2, time.Second)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.closed:
+				return
+			case <-ticker.C:
+			}
+			removed, err := h.sweepChunks(time.Now().Add(-h.cfg.ChunkRetention))
+			if err != nil {
+				log.Printf("chunk sweep failed: %v", err)
+				continue
+			}
+
+			// Swept uploads are abandoned, so their progress and sequences are dropped too
+			for fileName := range removed {
+				h.progress.reset(fileName)
+				h.sequences.reset(fileName)
+			}
+			if len(removed) > 0 {
+				log.Printf("chunk sweep removed expired chunks of %d files", len(removed))
+			}
+			if n := h.sweepRanges(time.Now().Add(-h.cfg.ChunkRetention)); n > 0 {
+				log.Printf("chunk sweep removed %d idle range uploads", n)
+			}
+		}
+	}()
+}
+
+// sweepChunks removes the part files last modified before cutoff and returns
+// the keys of the uploads they belonged to.
+func (h *ApiHandler) sweepChunks(cutoff time.Time) (map[string]bool, error) {
+	entries, err := os.ReadDir(TempDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	removed := make(map[string]bool)
+	for _, entry := range entries {
+		part := strings.HasSuffix(entry.Name(), partSuffix)
+		leftover := strings.HasSuffix(entry.Name(), ".tmp") || strings.HasSuffix(entry.Name(), ManifestSuffix)
+		if !part && !leftover {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue // Already gone or still fresh
+		}
+		// Staging files left by interrupted chunk uploads and manifests of
+		// abandoned uploads are removed silently
+		if err := os.Remove(filepath.Join(TempDir, entry.Name())); err != nil {
+			continue
+		}
+		if !part {
+			h.stats.tempBytes.Add(-info.Size())
+			continue
+		}
+		h.stats.chunkRemoved(info.Size())
+		if key, ok := h.chunks.forgetPart(entry.Name()); ok {
+			removed[key] = true
+		}
+	}
+
+	return removed, nil
+}
+
+// sweepRanges abandons the range uploads last used before cutoff and removes
+// their sparse files, as well as files older than cutoff left by uploads lost
+// in a restart. It returns the number of files removed.
+func (h *ApiHandler) sweepRanges(cutoff time.Time) int {
+	candidates := make(map[string]bool)
+	for _, fileName := range h.ranges.idle(cutoff) {
+		candidates[fileName] = true
+	}
+	entries, err := os.ReadDir(TempDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("range sweep failed: %v", err)
+	}
+	for _, entry := range entries {
+		fileName, ok := strings.CutSuffix(entry.Name(), ".range")
+		if !ok {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			candidates[fileName] = true
+		}
+	}
+
+	removed := 0
+	for fileName := range candidates {
+		// Requests register an upload under its file lock before writing, so
+		// an upload unknown here has no request writing its file either
+		unlock := h.lockFile(fileName)
+		if h.ranges.expire(fileName, cutoff) {
+			err := os.Remove(rangePath(fileName))
+			switch {
+			case err == nil:
+				removed++
+			case !os.IsNotExist(err):
+				log.Printf("failed to remove range upload %s: %v", fileName, err)
+			}
+		}
+		unlock()
+	}
+
+	return removed
+}
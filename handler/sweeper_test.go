@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSweepChunksFreesActiveUploads(t *testing.T) {
+	h := newTestHandler(t, Config{MaxActiveUploads: 1})
+	app := newTestApp(h)
+	if status, body := uploadChunk(t, app, "abandoned.bin", 0, []byte("first")); status != fiber.StatusOK {
+		t.Fatalf("upload: status %d: %v", status, body)
+	}
+	status, body := uploadChunk(t, app, "next.bin", 0, []byte("first"))
+	if status != ErrTooManyUploads.Status || body["code"] != ErrTooManyUploads.Code {
+		t.Fatalf("upload past the cap: status %d: %v, want %d %s", status, body, ErrTooManyUploads.Status, ErrTooManyUploads.Code)
+	}
+
+	removed, err := h.sweepChunks(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !removed["abandoned.bin"] {
+		t.Fatalf("sweep removed %v, want abandoned.bin", removed)
+	}
+	if keys := h.chunks.keys(); keys != 0 {
+		t.Errorf("%d uploads still active after the sweep", keys)
+	}
+	if status, body := uploadChunk(t, app, "next.bin", 0, []byte("first")); status != fiber.StatusOK {
+		t.Errorf("upload after the sweep: status %d: %v, want 200", status, body)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package handler
+
+import "os"
+
+// openNoFollow is os.OpenFile for a file in a storage directory, refusing
+// to open a symbolic link. Without O_NOFOLLOW the path is checked before it
+// is opened.
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	if err := refuseSymlink(path); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return checkOpened(file)
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// plantSymlink makes path a symbolic link to a file outside the storage
+// directories and returns that file, holding "outside".
+func plantSymlink(t *testing.T, path string) string {
+	t.Helper()
+	target := filepath.Join(t.TempDir(), "outside")
+	if err := os.WriteFile(target, []byte("outside"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+// assertUntouched fails unless target still holds what plantSymlink wrote.
+func assertUntouched(t *testing.T, target string) {
+	t.Helper()
+	if data, err := os.ReadFile(target); err != nil || string(data) != "outside" {
+		t.Errorf("link target holds %q, %v, want it untouched", data, err)
+	}
+}
+
+func TestOpenNoFollow(t *testing.T) {
+	tests := []struct {
+		name string
+		flag int
+	}{
+		{name: "append", flag: os.O_CREATE | os.O_WRONLY | os.O_APPEND},
+		{name: "truncate", flag: os.O_CREATE | os.O_WRONLY | os.O_TRUNC},
+		{name: "write at", flag: os.O_CREATE | os.O_WRONLY},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "link")
+			target := plantSymlink(t, path)
+
+			file, err := openNoFollow(path, tt.flag, 0o644)
+			if err == nil {
+				file.Close()
+			}
+			if !errors.Is(err, errSymlink) {
+				t.Errorf("err = %v, want %v", err, errSymlink)
+			}
+			assertUntouched(t, target)
+		})
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		if _, err := openNoFollow(t.TempDir(), os.O_RDONLY, 0); err == nil {
+			t.Error("opened a directory")
+		}
+	})
+}
+
+func TestSymlinkedStoragePathsRefused(t *testing.T) {
+	t.Run("merge output", func(t *testing.T) {
+		h := newTestHandler(t, Config{MergeRetries: -1})
+		app := newTestApp(h)
+		target := plantSymlink(t, h.filePath("linked.bin"))
+		if status, body := uploadChunk(t, app, "linked.bin", 0, []byte("chunk")); status != fiber.StatusOK {
+			t.Fatalf("upload: status %d: %v", status, body)
+		}
+
+		status, body := postJSON(t, app, "/merge-chunk", map[string]any{"file_name": "linked.bin", "total_chunks": 1, "append": true})
+		if status != fiber.StatusInternalServerError {
+			t.Errorf("append through a link: status %d: %v, want 500", status, body)
+		}
+		assertUntouched(t, target)
+	})
+
+	t.Run("range upload temp file", func(t *testing.T) {
+		h := newTestHandler(t, Config{})
+		app := fiber.New()
+		app.Put("/upload/:file_name", Recover(h.UploadRange))
+		target := plantSymlink(t, rangePath("linked.bin"))
+
+		status, body := putRange(t, app, "linked.bin", "bytes 0-3/8", []byte("abcd"))
+		if status != fiber.StatusInternalServerError {
+			t.Errorf("range written through a link: status %d: %v, want 500", status, body)
+		}
+		assertUntouched(t, target)
+	})
+
+	t.Run("mirror", func(t *testing.T) {
+		storage := DirStorage{Dir: t.TempDir()}
+		target := plantSymlink(t, filepath.Join(storage.Dir, "linked.bin"))
+
+		w, err := storage.Create("linked.bin")
+		if err == nil {
+			w.Close()
+		}
+		if !errors.Is(err, errSymlink) {
+			t.Errorf("err = %v, want %v", err, errSymlink)
+		}
+		assertUntouched(t, target)
+	})
+
+	t.Run("audit log", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		target := plantSymlink(t, path)
+
+		if err := NewFileAuditSink(path).Record(domain.AuditEvent{FileName: "linked.bin"}); !errors.Is(err, errSymlink) {
+			t.Errorf("err = %v, want %v", err, errSymlink)
+		}
+		assertUntouched(t, target)
+	})
+}
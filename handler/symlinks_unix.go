@@ -0,0 +1,24 @@
+//go:build unix
+
+package handler
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// openNoFollow is os.OpenFile for a file in a storage directory, refusing
+// to open a symbolic link. O_NOFOLLOW makes the open itself fail on a link,
+// so a link planted between a check and the open cannot slip through.
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(path, flag|syscall.O_NOFOLLOW, perm)
+	// Linux and macOS report a link with ELOOP, FreeBSD with EMLINK
+	if errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.EMLINK) {
+		return nil, symlinkError(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return checkOpened(file)
+}
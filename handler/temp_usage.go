@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// tempUsageRefreshInterval is how often the cached temp directory size is
+// recomputed from disk.
+const tempUsageRefreshInterval = 30 * time.Second
+
+// errTempFull is returned when storing a chunk would exceed MaxTempSize.
+var errTempFull = errors.New("temp directory size limit reached")
+
+// tempUsage caches the total size of the temp directory so chunk uploads can
+// be checked against the limit without walking the directory every time.
+// The count grows as chunks are stored and is corrected from disk by
+// startRefresher and whenever it says the limit is reached, since merges and
+// sweeps remove files without reporting back. The limit is approximate.
+type tempUsage struct {
+	limit int64
+	bytes atomic.Int64
+}
+
+// newTempUsage returns the usage tracker for limit, or nil when there is no
+// limit. A nil tracker accepts everything.
+func newTempUsage(limit int64) *tempUsage {
+	if limit <= 0 {
+		return nil
+	}
+
+	u := &tempUsage{limit: limit}
+	if err := u.refresh(); err != nil {
+		log.Printf("failed to measure temp directory: %v", err)
+	}
+
+	return u
+}
+
+// startRefresher recomputes the cached temp usage and storage stats from
+// disk every tempUsageRefreshInterval, on one goroutine for both, until the
+// handler is closed.
+func (h *ApiHandler) startRefresher() {
+	go func() {
+		ticker := time.NewTicker(tempUsageRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.closed:
+				return
+			case <-ticker.C:
+			}
+			if h.tempUsage != nil {
+				if err := h.tempUsage.refresh(); err != nil {
+					log.Printf("failed to measure temp directory: %v", err)
+				}
+			}
+			if err := h.stats.refresh(); err != nil {
+				log.Printf("failed to measure storage: %v", err)
+			}
+		}
+	}()
+}
+
+// reserve accounts for n more bytes and reports whether they fit under the
+// limit. When they do not, the cached size is recomputed once before giving up.
+func (u *tempUsage) reserve(n int64) bool {
+	if u == nil {
+		return true
+	}
+	if u.tryReserve(n) {
+		return true
+	}
+	if err := u.refresh(); err != nil {
+		log.Printf("failed to measure temp directory: %v", err)
+	}
+
+	return u.tryReserve(n)
+}
+
+func (u *tempUsage) tryReserve(n int64) bool {
+	for {
+		current := u.bytes.Load()
+		if current+n > u.limit {
+			return false
+		}
+		if u.bytes.CompareAndSwap(current, current+n) {
+			return true
+		}
+	}
+}
+
+// release returns n reserved bytes, e.g. after a failed write.
+func (u *tempUsage) release(n int64) {
+	if u != nil && n != 0 {
+		u.bytes.Add(-n)
+	}
+}
+
+// refresh recomputes the cached size from the files in the temp directory.
+func (u *tempUsage) refresh() error {
+	entries, err := os.ReadDir(TempDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+	}
+	u.bytes.Store(total)
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans of this package.
+const tracerName = "github.com/mohammadanang/uploads-api/handler"
+
+// Span attribute keys.
+const (
+	attrFileName    = attribute.Key("upload.file_name")
+	attrUploadID    = attribute.Key("upload.id")
+	attrChunkIndex  = attribute.Key("upload.chunk_index")
+	attrChunkSize   = attribute.Key("upload.chunk_size")
+	attrTotalChunks = attribute.Key("upload.total_chunks")
+	attrSize        = attribute.Key("upload.size")
+)
+
+// startSpan starts a span named name for the request and makes it the parent
+// of the spans started further down through c.UserContext().
+func (h *ApiHandler) startSpan(c *fiber.Ctx, name string) trace.Span {
+	ctx, span := h.tracer.Start(c.UserContext(), name, trace.WithSpanKind(trace.SpanKindServer))
+	c.SetUserContext(ctx)
+	return span
+}
+
+// endSpan records the response status of the request on span and ends it.
+// Server errors mark the span as failed.
+func endSpan(c *fiber.Ctx, span trace.Span) {
+	status := c.Response().StatusCode()
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, utils.StatusMessage(status))
+	}
+	span.End()
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"mime/multipart"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// MIMEApplicationNDJSON is the media type of progress streams: one JSON
+// object per line.
+const MIMEApplicationNDJSON = "application/x-ndjson"
+
+// progressStep is the percentage of a chunk between two progress lines.
+const progressStep = 10
+
+// progressWriter counts the bytes of a chunk as they are written and emits a
+// progress line each time another progressStep percent is done.
+type progressWriter struct {
+	w        *bufio.Writer
+	total    int64
+	written  int64
+	reported int64 // Last reported percentage
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	if p.total <= 0 {
+		return len(b), nil
+	}
+
+	percent := p.written * 100 / p.total
+	if percent >= p.reported+progressStep && percent < 100 {
+		p.reported = percent - percent%progressStep
+		writeLine(p.w, fiber.Map{"progress": p.reported, "written": p.written, "total": p.total})
+	}
+
+	return len(b), nil
+}
+
+// uploadWithProgress stores a chunk like UploadFile but streams the response
+// as NDJSON: progress lines while the chunk is written, then a final line
+// with the usual result, or the error that stopped the upload. The status is
+// 200 as soon as streaming starts, so clients must check the final line's
+// "error" field; it carries the status the request would otherwise have had.
+// release is called once the chunk is stored or has failed.
+func (h *ApiHandler) uploadWithProgress(c *fiber.Ctx, body *domain.UploadFileRequest, fileName, chunkKey string, file *multipart.FileHeader, release func()) error {
+	// The stream writer runs after the handler returns, when c is no longer valid
+	client := clientIdentity(c)
+
+	c.Set(fiber.HeaderContentType, MIMEApplicationNDJSON)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer release()
+		defer w.Flush()
+
+		progress := &progressWriter{w: w, total: file.Size}
+		stored, apiErr := h.writeChunk(file, body, fileName, chunkKey, client, progress)
+		if apiErr != nil {
+			if h.cfg.HideErrorDetails && apiErr.Err != nil {
+				log.Printf("chunk upload of %s failed: %v", fileName, apiErr)
+				apiErr = apiErr.Wrap(nil)
+			}
+			line := apiErr.body()
+			line["status"] = apiErr.Status
+			writeLine(w, line)
+			return
+		}
+
+		writeLine(w, fiber.Map{
+			"error":          false,
+			"status":         fiber.StatusOK,
+			"message":        "File uploaded successfully",
+			"file":           fileName,
+			"progress":       100,
+			"received_bytes": stored.ReceivedBytes,
+			"checksum":       stored.Checksum,
+			"next_chunk":     stored.NextChunk,
+			"complete":       stored.Complete,
+		})
+	})
+
+	return nil
+}
+
+// writeLine writes v as one NDJSON line and flushes it to the client.
+func writeLine(w *bufio.Writer, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	w.Write(append(data, '\n'))
+	w.Flush()
+}
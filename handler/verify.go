@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// VerifyFile handles POST /verify/:file_name, re-hashing a stored file and
+// comparing it with the size and digests recorded in its sidecar when it
+// was stored, to detect silent corruption of files kept for a long time.
+// The file is streamed through the hashes, never loaded, and every recorded
+// digest the server still computes is compared. A corrupt file is answered
+// with 200 and "intact": false, so a scrub can go through all files.
+func (h *ApiHandler) VerifyFile(c *fiber.Ctx) error {
+	fileName := c.Params("file_name")
+	if !validFileName(fileName) {
+		return RespondError(c, ErrInvalidFileName)
+	}
+
+	// A merge replacing the file would be reported as corruption
+	unlock := h.lockFile(fileName)
+	defer unlock()
+
+	meta, err := h.readMetadata(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, statErr := os.Stat(h.filePath(fileName)); os.IsNotExist(statErr) {
+			return RespondError(c, ErrFileNotFound.With(fiber.Map{
+				"file": fileName,
+			}))
+		}
+		return RespondError(c, ErrConflict.WithMessage("File has no recorded checksum to verify against").With(fiber.Map{
+			"file": fileName,
+		}))
+	}
+	if err != nil {
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file metadata").Wrap(err))
+	}
+
+	size, sums, err := h.digestFile(h.filePath(fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return RespondError(c, ErrFileNotFound.With(fiber.Map{
+				"file": fileName,
+			}))
+		}
+		return RespondError(c, ErrInternal.WithMessage("Failed to read file").Wrap(err))
+	}
+
+	// Sidecars written before extra digests existed only have the checksum
+	expected := map[string]string{HashSHA256: meta.Checksum}
+	for algorithm, digest := range meta.Digests {
+		expected[algorithm] = digest
+	}
+	mismatched := []string{}
+	for algorithm, digest := range expected {
+		if actual, ok := sums[algorithm]; ok && !strings.EqualFold(actual, digest) {
+			mismatched = append(mismatched, algorithm)
+		}
+	}
+	slices.Sort(mismatched)
+
+	intact := size == meta.Size && len(mismatched) == 0
+	if !intact {
+		log.Printf("verification of %s failed: %d bytes, expected %d; mismatched digests %v", fileName, size, meta.Size, mismatched)
+	}
+
+	return Respond(c, fiber.StatusOK, fiber.Map{
+		"error":              false,
+		"file":               fileName,
+		"intact":             intact,
+		"size":               size,
+		"expected_size":      meta.Size,
+		"checksum":           sums[HashSHA256],
+		"expected_checksum":  meta.Checksum,
+		"mismatched_digests": mismatched,
+		"stored_at":          meta.StoredAt,
+	})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the webhook body,
+// prefixed with "sha256=".
+const SignatureHeader = "X-Signature-256"
+
+// notifyWebhook delivers event to the configured webhook in the background.
+// Delivery is best-effort: failures are logged and never reach the client.
+func (h *ApiHandler) notifyWebhook(event domain.MergeEvent) {
+	if h.cfg.WebhookURL == "" {
+		return
+	}
+
+	go func() {
+		if err := h.deliverWebhook(event); err != nil {
+			log.Printf("webhook delivery for %s failed: %v", event.FileName, err)
+		}
+	}()
+}
+
+func (h *ApiHandler) deliverWebhook(event domain.MergeEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	client := &http.Client{Timeout: h.cfg.WebhookTimeout}
+	for attempt := 0; ; attempt++ {
+		err = postWebhook(client, h.cfg.WebhookURL, h.cfg.WebhookSecret, payload)
+		if err == nil || attempt >= h.cfg.WebhookRetries {
+			return err
+		}
+
+		// Back off a little longer after every failed attempt
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+}
+
+func postWebhook(client *http.Client, url, secret string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+signPayload(secret, payload))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 of payload keyed by secret.
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
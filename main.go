@@ -1,46 +1,221 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/mohammadanang/uploads-api/handler"
 )
 
-func main() {
-	app := fiber.New()
-	app.Use(cors.New())
+// Build information, injected at build time with
+// -ldflags "-X main.version=<version> -X main.commit=<sha> -X main.buildTime=<time>"
+var (
+	version   = "dev"
+	commit    = "dev"
+	buildTime = "dev"
+)
+
+const (
 	// 3 requests per 10 seconds max
-	app.Use(limiter.New(limiter.Config{
-		Expiration: 10 * time.Second,
-		Max:        3,
+	rateLimitMax    = 3
+	rateLimitWindow = 10 * time.Second
+)
+
+func main() {
+	flag.Parse()
+	cfg := loadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *catUpload != "" {
+		os.Exit(runCat(cfg))
+	}
+	// Requiring signatures nobody can verify would refuse every chunk
+	if cfg.RequireChunkSignatures && cfg.ChunkSigningKey == "" {
+		log.Fatal("REQUIRE_CHUNK_SIGNATURES needs a CHUNK_SIGNING_KEY")
+	}
+	if path := os.Getenv("MERGE_DB_PATH"); path != "" {
+		recorder, err := openMergeRecorder(path)
+		if err != nil {
+			log.Fatalf("failed to open merge database: %v", err)
+		}
+		cfg.MergeRecorder = recorder
+	}
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		storage, err := openMultipartStorage(bucket, os.Getenv("S3_PREFIX"))
+		if err != nil {
+			log.Fatalf("failed to set up S3 storage: %v", err)
+		}
+		cfg.MultipartStorage = storage
+	}
+	// Tracing stays a no-op unless an OTLP endpoint is configured
+	if tracingEnabled() {
+		provider, err := openTracerProvider()
+		if err != nil {
+			log.Fatalf("failed to set up tracing: %v", err)
+		}
+		cfg.TracerProvider = provider
+	}
+	port := envString("PORT", "3000")
+	apiKeys := envList("API_KEYS")
+	trustedProxies := envList("TRUSTED_PROXIES")
+	logConfig(cfg, port, apiKeys, trustedProxies)
+
+	// Raise the body limit when chunks may exceed it, leaving room for the
+	// multipart envelope; the handler enforces MAX_CHUNK_SIZE and CHUNK_SIZE
+	// itself
+	bodyLimit := fiber.DefaultBodyLimit
+	if limit := int(max(cfg.MaxChunkSize, cfg.ChunkSize)) + 1024*1024; limit > bodyLimit {
+		bodyLimit = limit
+	}
+
+	// Bounded timeouts keep slow or idle clients from holding connections
+	// forever; a zero value disables the respective timeout
+	readTimeout, writeTimeout, idleTimeout := serverTimeouts()
+	// The routing policy is set explicitly rather than left to fiber's
+	// defaults, so it is logged and documented like every other setting
+	strictRouting, caseSensitiveRoutes := routingPolicy()
+	fiberConfig := fiber.Config{
+		BodyLimit:     bodyLimit,
+		ReadTimeout:   readTimeout,
+		WriteTimeout:  writeTimeout,
+		IdleTimeout:   idleTimeout,
+		StrictRouting: strictRouting,
+		CaseSensitive: caseSensitiveRoutes,
+	}
+	// fasthttp keeps up to 16 MB of a multipart file in memory before it
+	// spills to disk; to pick another threshold the bodies are streamed and
+	// handler.StreamedBody parses the forms and enforces the body limit
+	if cfg.MultipartMemory > 0 {
+		fiberConfig.StreamRequestBody = true
+		fiberConfig.DisablePreParseMultipartForm = true
+	}
+	// Behind a reverse proxy, take the client IP from the proxy's header so
+	// the rate limiter, logs and audit trail see the real client. The header
+	// is only trusted on requests coming from TRUSTED_PROXIES
+	if len(trustedProxies) > 0 {
+		fiberConfig.EnableTrustedProxyCheck = true
+		fiberConfig.TrustedProxies = trustedProxies
+		fiberConfig.ProxyHeader = envString("PROXY_HEADER", fiber.HeaderXForwardedFor)
+		fiberConfig.EnableIPValidation = true
+	}
+
+	app := fiber.New(fiberConfig)
+	// Panics in middlewares are logged with their stack and answered with
+	// the JSON error envelope, like those in route handlers
+	app.Use(handler.RecoverMiddleware)
+	// Browsers only let scripts read the progress headers when exposed
+	app.Use(cors.New(cors.Config{
+		ExposeHeaders: handler.ReceivedChunksHeader + "," + handler.TotalBytesHeader + "," + handler.SkippedFilesHeader,
 	}))
-	app.Use(logger.New(logger.Config{
-		Format: "${time} | ${status} | ${method} | ${path} | ${latency}\n",
+	app.Use(limiter.New(limiter.Config{
+		// Probes and build information must stay reachable under load
+		Next: func(c *fiber.Ctx) bool {
+			return sameRoute(c.Path(), "/version", strictRouting, caseSensitiveRoutes) ||
+				sameRoute(c.Path(), "/readyz", strictRouting, caseSensitiveRoutes)
+		},
+		Expiration: rateLimitWindow,
+		Max:        rateLimitMax,
+		LimitReached: func(c *fiber.Ctx) error {
+			return handler.RespondError(c, handler.ErrRateLimited)
+		},
 	}))
+	app.Use(requestLogger(envFloat("LOG_SAMPLE_RATE", 1)))
+	if cfg.MultipartMemory > 0 {
+		app.Use(handler.StreamedBody(bodyLimit, cfg.MultipartMemory))
+	}
+	// Compressed bodies are decoded within limits here rather than in full
+	// by fiber, which a small zip bomb could exhaust memory with
+	maxDecompressed := cfg.MaxDecompressedSize
+	if maxDecompressed == 0 {
+		maxDecompressed = int64(bodyLimit)
+	}
+	app.Use(handler.LimitDecompression(maxDecompressed, cfg.MaxCompressionRatio, cfg.MultipartMemory))
 
-	app.Get("/", func(c *fiber.Ctx) error {
+	// Every route handler is wrapped so a panic still returns the JSON error envelope
+	safe := handler.Recover
+
+	app.Get("/", safe(func(c *fiber.Ctx) error {
 		return c.SendString("Hello, World!")
-	})
+	}))
 
-	apiHandler := handler.NewAPIHandler()
-	app.Post("/upload-file", apiHandler.UploadFile)
-	app.Post("/merge-chunk", apiHandler.MergeChunks)
+	app.Get("/version", safe(func(c *fiber.Ctx) error {
+		return handler.Respond(c, fiber.StatusOK, fiber.Map{
+			"version":    version,
+			"commit":     commit,
+			"build_time": buildTime,
+			"go_version": runtime.Version(),
+		})
+	}))
 
-	// Define an error handler
-	app.Use(func(c *fiber.Ctx) error {
-		if err := recover(); err != nil {
-			// Handle the error and respond with an error message
-			return c.Status(500).SendString("Internal Server Error")
-		}
+	apiHandler := handler.NewAPIHandler(cfg)
+	app.Use(apiHandler.Middleware)
+	// Uploads of content types outside ALLOWED_CONTENT_TYPES are turned away
+	// before the handler writes anything
+	allowContentTypes := handler.AllowContentTypes(cfg.AllowedContentTypes)
+	app.Get("/readyz", safe(apiHandler.Ready))
+	app.Get("/capabilities", safe(apiHandler.Capabilities))
+	app.Post("/upload/init", safe(apiHandler.InitUpload))
+	app.Post("/upload/fail", safe(apiHandler.FailUpload))
+	app.Post("/upload-file", allowContentTypes, safe(apiHandler.UploadFile))
+	app.Post("/manifest", safe(apiHandler.UploadManifest))
+	app.Post("/merge-chunk", safe(apiHandler.MergeChunks))
+	app.Put("/upload/:file_name", allowContentTypes, safe(apiHandler.UploadRange))
+	app.Get("/upload/:file_name", safe(apiHandler.RangeStatus))
+	app.Get("/files/:file_name", safe(apiHandler.FileInfo))
+	app.Get("/merge-report/:file_name", safe(apiHandler.MergeReport))
+	app.Get("/exists/:file_name", safe(apiHandler.FileExists))
+
+	// With DOWNLOAD_SIGNING_KEY set, downloads take an API key or a signed URL
+	requireDownloadAuth := handler.RequireDownloadAuth(apiKeys, cfg.DownloadSigningKey)
+	app.Get("/download/:file_name", requireDownloadAuth, safe(apiHandler.Download)) // Also answers HEAD
+	app.Get("/objects/:checksum", requireDownloadAuth, safe(apiHandler.DownloadObject))
+	app.Post("/download/zip", requireDownloadAuth, safe(apiHandler.DownloadZip))
+
+	// Endpoints below require one of the API_KEYS in the X-API-Key header
+	requireAPIKey := handler.RequireAPIKey(apiKeys)
+	app.Post("/download/sign", requireAPIKey, safe(apiHandler.SignDownload))
+	app.Get("/audit/:file_name", requireAPIKey, safe(apiHandler.AuditLog))
+	app.Get("/uploads/recent", requireAPIKey, safe(apiHandler.RecentUploads))
+	app.Get("/uploads/active", requireAPIKey, safe(apiHandler.ActiveUploads))
+	app.Get("/stats", requireAPIKey, safe(apiHandler.Stats))
+	app.Post("/verify/:file_name", requireAPIKey, safe(apiHandler.VerifyFile))
+	app.Post("/files/delete", requireAPIKey, safe(apiHandler.DeleteFiles))
+	app.Post("/files/rename", requireAPIKey, safe(apiHandler.RenameFile))
+	app.Post("/merge-external", requireAPIKey, safe(apiHandler.MergeExternal))
+	app.Get("/maintenance", requireAPIKey, safe(apiHandler.Maintenance))
+	app.Post("/maintenance", requireAPIKey, safe(apiHandler.SetMaintenance))
 
-		return c.Next()
-	})
+	// Service-to-service chunk uploads over gRPC, on a port of their own;
+	// messages carry whole chunks, so they get the HTTP body limit
+	if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+		go func() {
+			log.Fatalf("gRPC server failed: %v", serveGRPC(apiHandler, ":"+grpcPort, bodyLimit))
+		}()
+	}
+
+	// SIGINT and SIGTERM stop the server taking connections and let the
+	// requests in progress finish before the handler's background work stops
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		if err := app.Shutdown(); err != nil {
+			log.Printf("failed to shut down: %v", err)
+		}
+	}()
 
 	// Start the server
-	log.Fatal(app.Listen(":3000"))
+	if err := app.Listen(":" + port); err != nil {
+		log.Fatal(err)
+	}
+	apiHandler.Close()
 }
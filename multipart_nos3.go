@@ -0,0 +1,13 @@
+//go:build !s3
+
+package main
+
+import (
+	"errors"
+
+	"github.com/mohammadanang/uploads-api/handler"
+)
+
+func openMultipartStorage(string, string) (handler.MultipartStorage, error) {
+	return nil, errors.New("built without S3 support, rebuild with -tags s3")
+}
@@ -0,0 +1,14 @@
+//go:build s3
+
+package main
+
+import (
+	"context"
+
+	"github.com/mohammadanang/uploads-api/handler"
+	"github.com/mohammadanang/uploads-api/storage/s3"
+)
+
+func openMultipartStorage(bucket, prefix string) (handler.MultipartStorage, error) {
+	return s3.New(context.Background(), bucket, prefix)
+}
@@ -0,0 +1,78 @@
+// Package redis publishes stored file events to a Redis list, which workers
+// consume as a queue with BLPOP/BRPOP. It speaks the Redis protocol directly
+// and has no dependencies.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mohammadanang/uploads-api/domain"
+)
+
+// Publisher implements handler.Publisher by pushing every event, encoded as
+// JSON, onto the Redis list Key.
+type Publisher struct {
+	// Addr is the host:port of the Redis server.
+	Addr string
+	// Password is sent with AUTH when set.
+	Password string
+	// Key is the list the events are pushed to.
+	Key string
+}
+
+// Publish opens a connection, pushes event with RPUSH and closes it again.
+// Merges are infrequent enough that a pooled connection is not worth its
+// reconnect logic.
+func (p *Publisher) Publish(ctx context.Context, event domain.FileStoredEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	reader := bufio.NewReader(conn)
+	if p.Password != "" {
+		if err := command(conn, reader, "AUTH", p.Password); err != nil {
+			return fmt.Errorf("AUTH failed: %w", err)
+		}
+	}
+
+	return command(conn, reader, "RPUSH", p.Key, string(payload))
+}
+
+// command sends args as a RESP array and reads the single line reply.
+func command(conn net.Conn, reader *bufio.Reader, args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return err
+	}
+
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(reply, "-") {
+		return errors.New(strings.TrimSpace(reply[1:]))
+	}
+
+	return nil
+}
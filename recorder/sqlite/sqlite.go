@@ -0,0 +1,80 @@
+//go:build sqlite
+
+// Package sqlite records completed merges in a SQLite database. It is only
+// built with the "sqlite" build tag so the default build has no SQLite
+// dependency.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/mohammadanang/uploads-api/domain"
+	_ "modernc.org/sqlite"
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS merges (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	file_name TEXT    NOT NULL,
+	size      INTEGER NOT NULL,
+	checksum  TEXT    NOT NULL,
+	merged_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS merges_merged_at ON merges (merged_at);`
+
+// Recorder implements handler.MergeRecorder on top of a SQLite database.
+type Recorder struct {
+	db *sql.DB
+}
+
+// Open opens (creating if needed) the database at path.
+func Open(path string) (*Recorder, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	// SQLite allows a single writer; one connection avoids "database is locked"
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	return &Recorder{db: db}, nil
+}
+
+func (r *Recorder) RecordMerge(record domain.MergeRecord) error {
+	_, err := r.db.Exec(
+		`INSERT INTO merges (file_name, size, checksum, merged_at) VALUES (?, ?, ?, ?)`,
+		record.FileName, record.Size, record.Checksum, record.MergedAt.UTC(),
+	)
+	return err
+}
+
+func (r *Recorder) RecentMerges(limit int) ([]domain.MergeRecord, error) {
+	rows, err := r.db.Query(
+		`SELECT file_name, size, checksum, merged_at FROM merges ORDER BY merged_at DESC, id DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []domain.MergeRecord{}
+	for rows.Next() {
+		var record domain.MergeRecord
+		if err := rows.Scan(&record.FileName, &record.Size, &record.Checksum, &record.MergedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// Close closes the database.
+func (r *Recorder) Close() error {
+	return r.db.Close()
+}
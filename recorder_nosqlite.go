@@ -0,0 +1,13 @@
+//go:build !sqlite
+
+package main
+
+import (
+	"errors"
+
+	"github.com/mohammadanang/uploads-api/handler"
+)
+
+func openMergeRecorder(string) (handler.MergeRecorder, error) {
+	return nil, errors.New("built without SQLite support, rebuild with -tags sqlite")
+}
@@ -0,0 +1,12 @@
+//go:build sqlite
+
+package main
+
+import (
+	"github.com/mohammadanang/uploads-api/handler"
+	"github.com/mohammadanang/uploads-api/recorder/sqlite"
+)
+
+func openMergeRecorder(path string) (handler.MergeRecorder, error) {
+	return sqlite.Open(path)
+}
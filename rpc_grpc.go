@@ -0,0 +1,20 @@
+//go:build grpc
+
+package main
+
+import (
+	"net"
+
+	"github.com/mohammadanang/uploads-api/handler"
+	"github.com/mohammadanang/uploads-api/transport/grpc"
+)
+
+// serveGRPC serves the gRPC upload service on addr until it fails.
+func serveGRPC(h handler.Handler, addr string, maxMessageSize int) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return grpc.NewServer(h, maxMessageSize).Serve(listener)
+}
@@ -0,0 +1,13 @@
+//go:build !grpc
+
+package main
+
+import (
+	"errors"
+
+	"github.com/mohammadanang/uploads-api/handler"
+)
+
+func serveGRPC(handler.Handler, string, int) error {
+	return errors.New("built without gRPC support, rebuild with -tags grpc")
+}
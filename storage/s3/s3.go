@@ -0,0 +1,100 @@
+//go:build s3
+
+// Package s3 streams chunks into S3 multipart uploads. It is only built with
+// the "s3" build tag so the default build has no AWS SDK dependency.
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mohammadanang/uploads-api/handler"
+)
+
+// Storage implements handler.MultipartStorage on an S3 bucket. Objects are
+// stored under Prefix.
+type Storage struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// New creates a Storage for bucket using the default AWS credential chain
+// (environment, shared config, instance role).
+func New(ctx context.Context, bucket, prefix string) (*Storage, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	return &Storage{client: s3.NewFromConfig(cfg), bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *Storage) key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+func (s *Storage) CreateUpload(ctx context.Context, name string) (string, error) {
+	out, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(out.UploadId), nil
+}
+
+func (s *Storage) UploadPart(ctx context.Context, name, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(s.key(name)),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(int32(partNumber)),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(out.ETag), nil
+}
+
+func (s *Storage) CompleteUpload(ctx context.Context, name, uploadID string, parts []handler.CompletedPart) (string, error) {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(int32(part.Number)),
+		}
+	}
+
+	out, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(s.key(name)),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(out.ETag), nil
+}
+
+func (s *Storage) AbortUpload(ctx context.Context, name, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(s.key(name)),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !otel
+
+package main
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func openTracerProvider() (trace.TracerProvider, error) {
+	return nil, errors.New("built without OpenTelemetry support, rebuild with -tags otel")
+}
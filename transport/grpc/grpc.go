@@ -0,0 +1,139 @@
+//go:build grpc
+
+// Package grpc serves chunk uploads over gRPC next to the HTTP API, for
+// services that would rather stream chunks than build multipart requests.
+// It is only built with the "grpc" build tag so the default build carries no
+// gRPC server.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/mohammadanang/uploads-api/domain"
+	"github.com/mohammadanang/uploads-api/handler"
+	"github.com/mohammadanang/uploads-api/uploadpb"
+)
+
+// ChunkStore stores the chunks received over gRPC. handler.Handler
+// implements it, so the chunks end up where those of POST /upload-file do.
+type ChunkStore interface {
+	StoreChunk(ctx context.Context, req domain.StoreChunkRequest) (domain.StoredChunk, error)
+}
+
+// NewServer returns a gRPC server offering the upload service, accepting
+// messages, and so chunks, of up to maxMessageSize bytes.
+func NewServer(store ChunkStore, maxMessageSize int) *grpclib.Server {
+	server := grpclib.NewServer(grpclib.MaxRecvMsgSize(maxMessageSize))
+	uploadpb.RegisterUploadServiceServer(server, &service{store: store})
+	return server
+}
+
+type service struct {
+	uploadpb.UnimplementedUploadServiceServer
+	store ChunkStore
+}
+
+// Upload stores the chunks of the stream one by one as they arrive. All of
+// them must belong to the same upload, named by the first one.
+func (s *service) Upload(stream grpclib.ClientStreamingServer[uploadpb.Chunk, uploadpb.UploadResult]) error {
+	ctx := stream.Context()
+	client := clientAddress(ctx)
+	result := &uploadpb.UploadResult{}
+
+	var first *uploadpb.Chunk
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(result)
+		}
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = chunk
+		} else if chunk.GetFileName() != first.GetFileName() || chunk.GetUploadId() != first.GetUploadId() {
+			return status.Errorf(codes.InvalidArgument, "chunk %d: a stream carries the chunks of one upload", chunk.GetIndex())
+		}
+
+		stored, err := s.store.StoreChunk(ctx, domain.StoreChunkRequest{
+			FileName:   chunk.GetFileName(),
+			UploadID:   chunk.GetUploadId(),
+			ChunkIndex: int(chunk.GetIndex()),
+			Data:       chunk.GetData(),
+			Signature:  chunk.GetSignature(),
+			Sequence:   chunk.Sequence,
+			Client:     client,
+		})
+		if err != nil {
+			return statusError(chunk.GetIndex(), err)
+		}
+
+		result.FileName = stored.FileName
+		result.Chunks = append(result.Chunks, &uploadpb.StoredChunk{
+			Index:    int32(stored.ChunkIndex),
+			Size:     stored.Size,
+			Checksum: stored.Checksum,
+		})
+		result.ReceivedBytes = stored.ReceivedBytes
+		result.NextChunk = int32(stored.NextChunk)
+	}
+}
+
+// clientAddress identifies the sender for the audit log by its IP, like
+// the HTTP API does for requests without an API key.
+func clientAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// statusError turns the error storing chunk index failed with into a gRPC
+// status. The message leads with the error's stable code, e.g.
+// "chunk_too_large: Chunk is too large".
+func statusError(index int32, err error) error {
+	var apiErr *handler.Error
+	if !errors.As(err, &apiErr) {
+		apiErr = handler.ErrInternal.Wrap(err)
+	}
+	return status.Errorf(grpcCode(apiErr.Status), "chunk %d: %s: %s", index, apiErr.Code, apiErr.Error())
+}
+
+// grpcCode maps the HTTP status of an error to the closest gRPC code.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}